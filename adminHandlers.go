@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+// adminSearchLimit caps how many users a search returns
+const adminSearchLimit = 25
+
+// adminSearchUsers finds users by email prefix or Cognito username for
+// support cases.
+func (c *config) adminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	users, err := database.SearchUsers(query, adminSearchLimit)
+	if err != nil {
+		http.Error(w, "Failed to search users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+	log.Printf("Admin %s searched users for %q", principal.Username, query)
+
+	jsonData, err := json.Marshal(users)
+	if err != nil {
+		http.Error(w, "Failed to serialize users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// adminGetUser returns a user with a summary of their trackers. Log contents
+// are left out; support only needs to see what exists.
+func (c *config) adminGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	user, err := database.GetUserByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	trackers, err := database.GetTrackerSummariesByUserID(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get trackers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+	log.Printf("Admin %s looked up user %d", principal.Username, user.ID)
+
+	type Response struct {
+		User     db.User             `json:"user"`
+		Trackers []db.TrackerSummary `json:"trackers"`
+	}
+
+	jsonData, err := json.Marshal(Response{User: user, Trackers: trackers})
+	if err != nil {
+		http.Error(w, "Failed to serialize user data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
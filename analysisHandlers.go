@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/analysis"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+)
+
+func (c *config) getTrackerTriggers(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+	windowHours, err := queryFloat(r, "window_hours", 24)
+	if err != nil || windowHours <= 0 {
+		http.Error(w, "window_hours must be a positive number", http.StatusBadRequest)
+		return
+	}
+	minSupport, err := queryInt(r, "min_support", 2)
+	if err != nil || minSupport < 1 {
+		http.Error(w, "min_support must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	minSeverity, err := queryFloat(r, "min_severity", 0)
+	if err != nil || minSeverity < 0 {
+		http.Error(w, "min_severity must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker, owner := access.tracker, access.owner
+
+	symptomLogs, err := database.GetSymptomLogsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := analysis.FindTriggers(
+		analysis.ParseLogs(symptomLogs, owner.Location()),
+		c.categorizer,
+		analysis.TriggerOptions{
+			Window:       time.Duration(windowHours * float64(time.Hour)),
+			MinSupport:   minSupport,
+			HighSeverity: minSeverity,
+		},
+	)
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Failed to serialize triggers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) getTrackerStats(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker, owner := access.tracker, access.owner
+
+	type distribution struct {
+		Label        string   `json:"label"`
+		Logs         int      `json:"logs"`
+		MeanSeverity *float64 `json:"mean_severity"`
+	}
+
+	type Response struct {
+		TrackerID                int                     `json:"tracker_id"`
+		TotalLogs                int                     `json:"total_logs"`
+		Daily                    []db.PeriodStat         `json:"daily"`
+		Weekly                   []db.PeriodStat         `json:"weekly"`
+		Monthly                  []db.PeriodStat         `json:"monthly"`
+		TopSymptoms              []analysis.SymptomCount `json:"top_symptoms"`
+		CoOccurrence             analysis.CoOccurrence   `json:"co_occurrence"`
+		LongestSymptomFreeStreak analysis.Streak         `json:"longest_symptom_free_streak"`
+		DayOfWeek                []distribution          `json:"day_of_week"`
+		HourOfDay                []distribution          `json:"hour_of_day"`
+		// CyclePhases is only set for users who track their cycle
+		CyclePhases []analysis.PhaseStat `json:"cycle_phases,omitempty"`
+	}
+
+	response := Response{TrackerID: tracker.ID}
+
+	// Frequency and severity trends are aggregated by MySQL
+	periods := map[string]*[]db.PeriodStat{
+		"day":   &response.Daily,
+		"week":  &response.Weekly,
+		"month": &response.Monthly,
+	}
+	for period, target := range periods {
+		stats, err := database.GetLogStatsByPeriod(tracker.ID, owner.TimeZone, period)
+		if err != nil {
+			http.Error(w, "Failed to get log stats: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*target = stats
+	}
+
+	distributions := map[string]*[]distribution{
+		"day_of_week": &response.DayOfWeek,
+		"hour":        &response.HourOfDay,
+	}
+	for unit, target := range distributions {
+		stats, err := database.GetLogDistribution(tracker.ID, owner.TimeZone, unit)
+		if err != nil {
+			http.Error(w, "Failed to get log distribution: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*target = []distribution{}
+		for _, stat := range stats {
+			*target = append(*target, distribution{
+				Label:        distributionLabel(unit, stat.Bucket),
+				Logs:         stat.Logs,
+				MeanSeverity: stat.MeanSeverity,
+			})
+		}
+	}
+
+	// Symptoms are stored as a comma separated list, so they're counted here
+	symptomLogs, err := database.GetSymptomLogsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	symptomLists := make([][]string, len(symptomLogs))
+	for i, symptomLog := range symptomLogs {
+		symptomLists[i] = openai.SplitSymptoms(symptomLog.Symptoms)
+	}
+	response.TotalLogs = len(symptomLogs)
+	response.TopSymptoms, response.CoOccurrence = analysis.SymptomFrequencies(symptomLists)
+
+	// Cycles belong to the owner, not the tracker, so grantees don't see them
+	var cycles []db.Cycle
+	if access.isOwner() {
+		cycles, err = database.GetCyclesByUserID(owner.ID)
+		if err != nil {
+			http.Error(w, "Failed to get cycles: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(cycles) > 0 {
+		response.CyclePhases = analysis.CyclePhaseStats(
+			analysis.ParseLogs(symptomLogs, owner.Location()),
+			analysis.ParseCycles(cycles),
+		)
+	}
+
+	loggedDays := make([]string, len(response.Daily))
+	for i, day := range response.Daily {
+		loggedDays[i] = day.Period
+	}
+	response.LongestSymptomFreeStreak = analysis.LongestGap(loggedDays, time.Now().In(owner.Location()))
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to serialize tracker stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// distributionLabel names a GetLogDistribution bucket: MySQL's DAYOFWEEK
+// (1 is Sunday) or an hour of the day.
+func distributionLabel(unit string, bucket int) string {
+	if unit == "day_of_week" {
+		dayNames := []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+		return dayNames[(bucket+6)%7]
+	}
+	return fmt.Sprintf("%02d:00", bucket)
+}
+
+func (c *config) getTrackerFlares(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker, owner := access.tracker, access.owner
+
+	// Flares are re-detected on every new log; refresh forces it now
+	if r.URL.Query().Get("refresh") == "true" {
+		if !access.isOwner() {
+			http.Error(w, "Only the tracker's owner can refresh flares", http.StatusForbidden)
+			return
+		}
+		if err := c.detectFlares(database, tracker.ID, owner.Location()); err != nil {
+			http.Error(w, "Failed to detect flares: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	flares, err := database.GetFlareEventsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get flares: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(flares)
+	if err != nil {
+		http.Error(w, "Failed to serialize flares", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// detectFlares reruns flare detection over a tracker's logs, bucketing days in
+// loc, and stores the result.
+func (c *config) detectFlares(database *db.Database, trackerID int, loc *time.Location) error {
+	symptomLogs, err := database.GetSymptomLogsByTrackerID(trackerID)
+	if err != nil {
+		return err
+	}
+
+	flares := analysis.DetectFlares(analysis.ParseLogs(symptomLogs, loc), c.flareOptions)
+	events := make([]db.FlareEvent, len(flares))
+	for i, flare := range flares {
+		events[i] = db.FlareEvent{
+			TrackerID:    trackerID,
+			StartDate:    flare.Start,
+			EndDate:      flare.End,
+			Reason:       flare.Reason,
+			PeakLogs:     flare.PeakLogs,
+			PeakSeverity: flare.PeakSeverity,
+			Score:        flare.Score,
+		}
+	}
+	return database.ReplaceFlareEvents(trackerID, events)
+}
+
+// queryInt reads an integer query parameter, returning fallback when unset.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// queryFloat reads a numeric query parameter, returning fallback when unset.
+func queryFloat(r *http.Request, name string, fallback float64) (float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
@@ -1,17 +1,15 @@
 package main
 
 import (
-	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/session"
 )
 
 type User struct {
@@ -35,16 +33,15 @@ func (cfg *config) signUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Call the SignUp method from CognitoClient
 	err := cfg.AuthClient.SignUp(
-		context.Background(),
+		r.Context(),
 		user.Username,
 		user.FirstName,
 		user.LastName,
 		user.Password,
 	)
 	if err != nil {
-		http.Error(w, "Failed to sign up user: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to sign up user: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
@@ -62,28 +59,10 @@ func (c *config) ConfirmSignup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		req.Email,
-	)
-	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		log.Printf("Failed to calculate secret hash: %v", err)
-		return
-	}
 
-	_, err = c.AuthClient.ConfirmSignUp(
-		context.TODO(),
-		&cognitoidentityprovider.ConfirmSignUpInput{
-			ClientId:         &c.AuthClient.AppClientID,
-			Username:         &req.Email,
-			SecretHash:       &secretHash,
-			ConfirmationCode: &req.ConfirmationCode,
-		},
-	)
+	err := c.AuthClient.ConfirmSignUp(r.Context(), req.Email, req.ConfirmationCode)
 	if err != nil {
-		http.Error(w, "Failed to confirm signup", http.StatusInternalServerError)
+		http.Error(w, "Failed to confirm signup", identityErrorStatus(err))
 		log.Printf("Failed to confirm signup: %v", err)
 		return
 	}
@@ -97,26 +76,9 @@ func (c *config) RequestVerificationCode(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		req.Email,
-	)
-	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		return
-	}
 
-	_, err = c.AuthClient.ResendConfirmationCode(
-		context.TODO(),
-		&cognitoidentityprovider.ResendConfirmationCodeInput{
-			SecretHash: &secretHash,
-			ClientId:   &c.AuthClient.AppClientID,
-			Username:   &req.Email,
-		},
-	)
-	if err != nil {
-		http.Error(w, "Failed to resend confirmation code", http.StatusInternalServerError)
+	if err := c.AuthClient.ResendConfirmationCode(r.Context(), req.Email); err != nil {
+		http.Error(w, "Failed to resend confirmation code", identityErrorStatus(err))
 		return
 	}
 
@@ -136,86 +98,62 @@ func (c *config) SignIn(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		user.Username,
-	)
-	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		return
-	}
-	obj, err := c.AuthClient.AdminInitiateAuth(
-		context.TODO(),
-		&cognitoidentityprovider.AdminInitiateAuthInput{
-			AuthFlow:   "ADMIN_USER_PASSWORD_AUTH",
-			ClientId:   &c.AuthClient.AppClientID,
-			UserPoolId: &c.AuthClient.UserPoolID,
-			AuthParameters: map[string]string{
-				"USERNAME":    user.Username,
-				"PASSWORD":    user.Password,
-				"SECRET_HASH": secretHash,
-			},
-		},
-	)
+	result, err := c.AuthClient.SignIn(r.Context(), user.Username, user.Password)
 	if err != nil {
-		error := "Failed to authenticate user: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+		http.Error(w, "Failed to authenticate user: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
-	// get the sub value from the id token by decoding it
-	// store the sub value in a cookie
-	// Decode the JWT (ID token)
-	idToken := *obj.AuthenticationResult.IdToken
-	parts := strings.Split(idToken, ".")
-	if len(parts) != 3 {
-		http.Error(w, "Invalid ID token", http.StatusInternalServerError)
-		return
-	}
+	c.writeAuthResult(w, r, result)
+}
 
-	// Decode the payload (the second part of the JWT)
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		http.Error(w, "Failed to decode ID token", http.StatusInternalServerError)
-		return
-	}
+type SignInChallenge struct {
+	ChallengeName       string            `json:"challengeName"`
+	Session             string            `json:"session"`
+	ChallengeParameters map[string]string `json:"challengeParameters"`
+}
 
-	// Unmarshal the payload into a map to extract the "sub" claim
-	var claims map[string]interface{}
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		http.Error(w, "Failed to parse ID token", http.StatusInternalServerError)
+// writeAuthResult sends the challenge the client must answer next, or
+// completes the sign-in when Cognito has issued tokens.
+func (c *config) writeAuthResult(w http.ResponseWriter, r *http.Request, result auth.AuthResult) {
+	if result.Challenge != nil {
+		response := &SignInChallenge{
+			ChallengeName:       result.Challenge.Name,
+			Session:             result.Challenge.Session,
+			ChallengeParameters: result.Challenge.Parameters,
+		}
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
 		return
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok {
-		http.Error(w, "Failed to extract 'sub' from ID token", http.StatusInternalServerError)
+	c.completeSignIn(w, r, result.Tokens)
+}
+
+// completeSignIn starts a server-side session holding the refresh token and
+// sends the access and ID tokens.
+func (c *config) completeSignIn(w http.ResponseWriter, r *http.Request, tokens *auth.Tokens) {
+	if err := c.startSession(w, r, tokens); err != nil {
+		log.Printf("Failed to start session: %v", err)
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
-		Value:    *obj.AuthenticationResult.RefreshToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "userSub",
-		Value:    sub, // Replace with the actual email value
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-	})
+	writeTokens(w, tokens)
+}
 
+// writeTokens sends the tokens the client keeps in memory.
+func writeTokens(w http.ResponseWriter, tokens *auth.Tokens) {
 	response := &SignInResponse{
-		AccessToken: obj.AuthenticationResult.AccessToken,
-		ExpiresIn:   obj.AuthenticationResult.ExpiresIn,
-		TokenType:   obj.AuthenticationResult.TokenType,
-		IDToken:     obj.AuthenticationResult.IdToken,
+		AccessToken: &tokens.AccessToken,
+		ExpiresIn:   tokens.ExpiresIn,
+		TokenType:   &tokens.TokenType,
+		IDToken:     &tokens.IDToken,
 	}
 
 	jsonData, err := json.Marshal(response)
@@ -228,104 +166,246 @@ func (c *config) SignIn(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(jsonData))
 }
 
-func (c *config) RefreshToken(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := r.Cookie("refreshToken")
-	if err != nil {
-		http.Error(w, "Failed to retrieve refresh token", http.StatusInternalServerError)
+func (c *config) RespondToChallenge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username      string `json:"username"`
+		ChallengeName string `json:"challengeName"`
+		Session       string `json:"session"`
+		Code          string `json:"code"`
+		NewPassword   string `json:"newPassword"`
+		MFAType       string `json:"mfaType"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.ChallengeName == "" || req.Session == "" {
+		http.Error(w, "username, challengeName and session are required", http.StatusBadRequest)
 		return
 	}
-	userSub, err := r.Cookie("userSub")
+
+	result, err := c.AuthClient.RespondToChallenge(r.Context(), auth.ChallengeResponse{
+		Name:        req.ChallengeName,
+		Session:     req.Session,
+		Username:    req.Username,
+		Code:        req.Code,
+		NewPassword: req.NewPassword,
+		MFAType:     req.MFAType,
+	})
 	if err != nil {
-		http.Error(w, "Failed to retrieve user email", http.StatusInternalServerError)
+		http.Error(w, "Failed to respond to challenge: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		userSub.Value,
-	)
+	c.writeAuthResult(w, r, result)
+}
+
+// AssociateTOTP starts authenticator app enrollment. A signed-in user sends
+// their access token as a bearer token; a user answering an MFA_SETUP
+// challenge sends its session instead.
+func (c *config) AssociateTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Session  string `json:"session"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	accessToken := bearerToken(r)
+	if accessToken == "" && req.Session == "" {
+		http.Error(w, "An access token or session is required", http.StatusBadRequest)
+		return
+	}
+
+	mfa, ok := c.AuthClient.(auth.SoftwareTokenMFA)
+	if !ok {
+		http.Error(w, "Authenticator apps are not supported", http.StatusNotImplemented)
+		return
+	}
+	secret, session, err := mfa.AssociateSoftwareToken(r.Context(), accessToken, req.Session)
 	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
+		http.Error(w, "Failed to start authenticator setup: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
-	obj, err := c.AuthClient.AdminInitiateAuth(
-		context.TODO(),
-		&cognitoidentityprovider.AdminInitiateAuthInput{
-			AuthFlow:   "REFRESH_TOKEN_AUTH",
-			ClientId:   &c.AuthClient.AppClientID,
-			UserPoolId: &c.AuthClient.UserPoolID,
-			AuthParameters: map[string]string{
-				"REFRESH_TOKEN": refreshToken.Value,
-				"SECRET_HASH":   secretHash,
-			},
-		},
-	)
+	response := struct {
+		SecretCode string `json:"secretCode"`
+		OTPAuthURI string `json:"otpauthUri"`
+		Session    string `json:"session,omitempty"`
+	}{
+		SecretCode: secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, req.Username, secret),
+		Session:    session,
+	}
+	jsonData, err := json.Marshal(response)
 	if err != nil {
-		error := "Failed to refresh token: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
 
-	response := &SignInResponse{
-		AccessToken: obj.AuthenticationResult.AccessToken,
-		ExpiresIn:   obj.AuthenticationResult.ExpiresIn,
-		TokenType:   obj.AuthenticationResult.TokenType,
-		IDToken:     obj.AuthenticationResult.IdToken,
+// VerifyTOTP checks the first code from the authenticator app. Signed-in
+// users then have TOTP turned on as their preferred MFA; during MFA_SETUP
+// the returned session completes the challenge via respond-to-challenge.
+func (c *config) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Session    string `json:"session"`
+		Code       string `json:"code"`
+		DeviceName string `json:"deviceName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	accessToken := bearerToken(r)
+	if accessToken == "" && req.Session == "" {
+		http.Error(w, "An access token or session is required", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	mfa, ok := c.AuthClient.(auth.SoftwareTokenMFA)
+	if !ok {
+		http.Error(w, "Authenticator apps are not supported", http.StatusNotImplemented)
+		return
+	}
+	session, err := mfa.VerifySoftwareToken(r.Context(), accessToken, req.Session, req.Code, req.DeviceName)
+	if err != nil {
+		http.Error(w, "Failed to verify authenticator code: "+err.Error(), identityErrorStatus(err))
+		return
+	}
+	if accessToken != "" {
+		if err := mfa.EnableSoftwareTokenMFA(r.Context(), accessToken); err != nil {
+			http.Error(w, "Failed to enable authenticator MFA: "+err.Error(), identityErrorStatus(err))
+			return
+		}
 	}
 
+	response := struct {
+		Status  string `json:"status"`
+		Session string `json:"session,omitempty"`
+	}{
+		Status:  "SUCCESS",
+		Session: session,
+	}
 	jsonData, err := json.Marshal(response)
 	if err != nil {
 		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 		return
 	}
-
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(jsonData))
+	w.Write(jsonData)
 }
 
-func (c *config) SignOut(w http.ResponseWriter, r *http.Request) {
-	userSub, err := r.Cookie("userSub")
+// totpIssuer labels the account in authenticator apps
+const totpIssuer = "Health Trackers"
+
+// bearerToken returns the token from an "Authorization: Bearer" header, if
+// any.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "Bearer" {
+		return ""
+	}
+	return token
+}
+
+// identityErrorStatus maps identity provider errors the client can fix to
+// 4xx codes.
+func identityErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrNotAuthorized), errors.Is(err, auth.ErrCodeMismatch):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrUserNotConfirmed), errors.Is(err, auth.ErrEmailNotVerified):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrUserExists):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrInvalidRequest):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// RefreshToken issues new access and ID tokens for the session cookie. The
+// identity comes from the stored session, never from the client.
+func (c *config) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	database, err := c.openSessions()
 	if err != nil {
-		http.Error(w, "Failed to retrieve user email", http.StatusInternalServerError)
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
 		return
 	}
-	sub := userSub.Value
+	defer database.Close()
 
-	_, err = c.AuthClient.AdminUserGlobalSignOut(context.TODO(),
-		&cognitoidentityprovider.AdminUserGlobalSignOutInput{
-			Username:   &sub,
-			UserPoolId: &c.AuthClient.UserPoolID,
-		},
-	)
+	current, err := c.currentSession(r, database)
+	if errors.Is(err, errNoSession) {
+		clearCookie(w, sessionCookie)
+		http.Error(w, "No active session", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to sign out user", http.StatusInternalServerError)
+		http.Error(w, "Failed to get session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		Expires:  time.Unix(0, 0), // Set expiration to a past time
-		MaxAge:   -1,              // Ensure the cookie is removed immediately
-	})
+	refreshToken, err := c.sessionCipher.Open(current.RefreshToken, current.TokenHash)
+	if err == nil {
+		var result auth.AuthResult
+		result, err = c.AuthClient.Refresh(r.Context(), current.Subject, refreshToken)
+		if err == nil {
+			if err := database.TouchSession(current.ID, truncate(r.UserAgent(), 255), clientIP(r), time.Now()); err != nil {
+				log.Printf("Failed to update session %d: %v", current.ID, err)
+			}
+			writeTokens(w, result.Tokens)
+			return
+		}
+	}
+	if !errors.Is(err, session.ErrDecrypt) && !errors.Is(err, auth.ErrNotAuthorized) {
+		http.Error(w, "Failed to refresh token: "+err.Error(), identityErrorStatus(err))
+		return
+	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "userSub",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		Expires:  time.Unix(0, 0), // Set expiration to a past time
-		MaxAge:   -1,              // Ensure the cookie is removed immediately
-	})
+	// The refresh token was revoked, expired or can't be read, so the
+	// session is no use any more
+	if err := database.RevokeSession(current.ID, time.Now()); err != nil {
+		log.Printf("Failed to revoke session %d: %v", current.ID, err)
+	}
+	clearCookie(w, sessionCookie)
+	http.Error(w, "Session expired", http.StatusUnauthorized)
+}
 
+// SignOut ends the current device's session. Signing out of every device is
+// DELETE /db/sessions.
+func (c *config) SignOut(w http.ResponseWriter, r *http.Request) {
+	database, err := c.openSessions()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	current, err := c.currentSession(r, database)
+	if err != nil && !errors.Is(err, errNoSession) {
+		http.Error(w, "Failed to get session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := c.endSession(r, database, current); err != nil {
+			http.Error(w, "Failed to sign out: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearCookie(w, sessionCookie)
+	clearCookie(w, "refreshToken")
+	clearCookie(w, "userSub")
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -338,27 +418,8 @@ func (c *config) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		req.Email,
-	)
-	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = c.AuthClient.ForgotPassword(
-		context.TODO(),
-		&cognitoidentityprovider.ForgotPasswordInput{
-			ClientId:   &c.AuthClient.AppClientID,
-			Username:   &req.Email,
-			SecretHash: &secretHash,
-		},
-	)
-	if err != nil {
-		error := "Failed to request password reset: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+	if err := c.AuthClient.ForgotPassword(r.Context(), req.Email); err != nil {
+		http.Error(w, "Failed to request password reset: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
@@ -375,28 +436,10 @@ func (c *config) ConfirmForgottenPassword(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	secretHash, err := auth.CalculateSecretHash(
-		c.AuthClient.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		req.Email,
-	)
-	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		return
-	}
 
-	_, err = c.AuthClient.ConfirmForgotPassword(
-		context.TODO(),
-		&cognitoidentityprovider.ConfirmForgotPasswordInput{
-			ClientId:         &c.AuthClient.AppClientID,
-			Username:         &req.Email,
-			ConfirmationCode: &req.ConfirmationCode,
-			Password:         &req.Password,
-			SecretHash:       &secretHash,
-		},
-	)
+	err := c.AuthClient.ConfirmForgotPassword(r.Context(), req.Email, req.ConfirmationCode, req.Password)
 	if err != nil {
-		http.Error(w, "Failed to confirm forgotten password", http.StatusInternalServerError)
+		http.Error(w, "Failed to confirm forgotten password", identityErrorStatus(err))
 		return
 	}
 
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/analysis"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+var cycleFlows = map[string]bool{
+	"":         true,
+	"none":     true,
+	"spotting": true,
+	"light":    true,
+	"medium":   true,
+	"heavy":    true,
+}
+
+// cycleUpdate is the body of PATCH /cycles/{id}. Fields left out are
+// unchanged; an empty end_date reopens the period.
+type cycleUpdate struct {
+	StartDate *string `json:"start_date"`
+	EndDate   *string `json:"end_date"`
+	Flow      *string `json:"flow"`
+}
+
+func (c *config) getCycles(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	cycles, err := database.GetCyclesByUserID(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get cycles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type Response struct {
+		Cycles     []db.Cycle               `json:"cycles"`
+		Prediction analysis.CyclePrediction `json:"prediction"`
+		// CurrentDay and CurrentPhase are today's position, if known
+		CurrentDay   int    `json:"current_day,omitempty"`
+		CurrentPhase string `json:"current_phase,omitempty"`
+	}
+
+	parsed := analysis.ParseCycles(cycles)
+	response := Response{
+		Cycles:     cycles,
+		Prediction: analysis.PredictNextCycle(parsed),
+	}
+	if position, ok := analysis.PositionOf(time.Now().In(user.Location()), parsed, response.Prediction); ok {
+		response.CurrentDay = position.Day
+		response.CurrentPhase = position.Phase
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to serialize cycles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createCycle(w http.ResponseWriter, r *http.Request, user db.User) {
+	var cycle db.Cycle
+	if err := json.NewDecoder(r.Body).Decode(&cycle); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateCycle(cycle); err != "" {
+		http.Error(w, err, http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	cycle.UserID = user.ID
+
+	cycle.ID, err = database.CreateCycle(cycle)
+	if err != nil {
+		http.Error(w, "Failed to create cycle: "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	jsonData, err := json.Marshal(cycle)
+	if err != nil {
+		http.Error(w, "Failed to serialize cycle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+func (c *config) updateCycle(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid cycle id", http.StatusBadRequest)
+		return
+	}
+
+	var update cycleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	cycle, err := database.GetCycleByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Cycle not found", http.StatusNotFound)
+		return
+	}
+
+	if update.StartDate != nil {
+		cycle.StartDate = *update.StartDate
+	}
+	if update.EndDate != nil {
+		cycle.EndDate = *update.EndDate
+	}
+	if update.Flow != nil {
+		cycle.Flow = *update.Flow
+	}
+	if err := validateCycle(cycle); err != "" {
+		http.Error(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := database.UpdateCycle(cycle); err != nil {
+		http.Error(w, "Failed to update cycle: "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	jsonData, err := json.Marshal(cycle)
+	if err != nil {
+		http.Error(w, "Failed to serialize cycle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) deleteCycle(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid cycle id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	cycle, err := database.GetCycleByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Cycle not found", http.StatusNotFound)
+		return
+	}
+
+	if err := database.DeleteCycle(cycle.ID); err != nil {
+		http.Error(w, "Failed to delete cycle: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCycle returns a message describing what's wrong with cycle, or ""
+// if it's valid.
+func validateCycle(cycle db.Cycle) string {
+	start, err := time.Parse(time.DateOnly, cycle.StartDate)
+	if err != nil {
+		return "start_date must be YYYY-MM-DD"
+	}
+	if cycle.EndDate != "" {
+		end, err := time.Parse(time.DateOnly, cycle.EndDate)
+		if err != nil {
+			return "end_date must be YYYY-MM-DD"
+		}
+		if end.Before(start) {
+			return "end_date must not be before start_date"
+		}
+	}
+	if !cycleFlows[cycle.Flow] {
+		return "flow must be none, spotting, light, medium or heavy"
+	}
+	return ""
+}
+
+// cycleDatabase is the part of *db.Database annotateCycles uses.
+type cycleDatabase interface {
+	GetCyclesByUserID(userID int) ([]db.Cycle, error)
+}
+
+// annotateCycles tags logs with the user's cycle day and phase. Failures are
+// logged and the logs are returned without cycle information.
+func annotateCycles(database cycleDatabase, user db.User, logs []db.SymptomLog) {
+	cycles, err := database.GetCyclesByUserID(user.ID)
+	if err != nil {
+		log.Printf("Failed to get cycles for user %d: %v", user.ID, err)
+		return
+	}
+	analysis.AnnotateCycles(logs, analysis.ParseCycles(cycles), user.Location())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+func (c *config) getTrackerFields(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker := access.tracker
+
+	fields, err := database.GetTrackerFieldsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get tracker fields: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(fields)
+	if err != nil {
+		http.Error(w, "Failed to serialize tracker fields", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createTrackerField(w http.ResponseWriter, r *http.Request, user db.User) {
+	var field db.TrackerField
+	if err := json.NewDecoder(r.Body).Decode(&field); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := field.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	tracker, err := database.GetTrackerByIDAndUserID(field.TrackerID, user.ID)
+	if err != nil {
+		http.Error(w, "Tracker not found", http.StatusNotFound)
+		return
+	}
+	field.TrackerID = tracker.ID
+
+	field.ID, err = database.CreateTrackerField(field)
+	if err != nil {
+		http.Error(w, "Failed to create tracker field: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(field)
+	if err != nil {
+		http.Error(w, "Failed to serialize tracker field", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+func (c *config) deleteTrackerField(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid field id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	err = database.DeleteTrackerField(id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Tracker field not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete tracker field: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,27 +1,21 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
 	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
 )
 
-func (c *config) getUser(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
-	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
-		return
-	}
-
+func (c *config) getUser(w http.ResponseWriter, r *http.Request, user db.User) {
 	// Connect to the database
 	database, err := db.New()
 	if err != nil {
@@ -30,19 +24,15 @@ func (c *config) getUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer database.Close()
 
-	// Check if user exists in the database
-	user, err := database.GetUserBySub(sub)
-	if err != nil {
-		http.Error(w, "Failed to get user: "+err.Error(), http.StatusNotFound)
-		return
-	}
-
 	// Define response struct with trackers and their symptoms
 	type trackerResponse struct {
-		ID          int             `json:"id"`
-		TrackerName string          `json:"tracker_name"`
-		Symptoms    []db.Symptom    `json:"symptoms"`
-		Logs        []db.SymptomLog `json:"logs"`
+		ID            int               `json:"id"`
+		TrackerName   string            `json:"tracker_name"`
+		Symptoms      []db.Symptom      `json:"symptoms"`
+		Logs          []db.SymptomLog   `json:"logs"`
+		Fields        []db.TrackerField `json:"fields"`
+		Interventions []db.Intervention `json:"interventions"`
+		Intakes       []db.IntakeLog    `json:"intakes"`
 	}
 
 	type Response struct {
@@ -73,13 +63,35 @@ func (c *config) getUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		fields, err := database.GetTrackerFieldsByTrackerID(tracker.ID)
+		if err != nil {
+			http.Error(w, "Failed to get tracker fields: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		interventions, err := database.GetInterventionsByTrackerID(tracker.ID)
+		if err != nil {
+			http.Error(w, "Failed to get interventions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		intakes, err := database.GetIntakeLogsByTrackerID(tracker.ID)
+		if err != nil {
+			http.Error(w, "Failed to get intake logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		db.LocalizeIntakeLogs(intakes, user.Location())
+
 		// Create tracker response with symptoms
 		trackerRes := trackerResponse{
-			ID:          tracker.ID,
-			TrackerName: tracker.TrackerName,
-			Symptoms:    symptoms, // Attach symptoms to the tracker
-			Logs:        logs,
+			ID:            tracker.ID,
+			TrackerName:   tracker.TrackerName,
+			Symptoms:      symptoms, // Attach symptoms to the tracker
+			Logs:          logs,
+			Fields:        fields,
+			Interventions: interventions,
+			Intakes:       intakes,
 		}
+		db.LocalizeLogs(trackerRes.Logs, user.Location())
+		annotateCycles(database, user, trackerRes.Logs)
 
 		// Append to the response
 		responseTrackers = append(responseTrackers, trackerRes)
@@ -104,19 +116,13 @@ func (c *config) getUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *config) createUser(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
+	// Local users are keyed by the Cognito username
+	principal, ok := auth.PrincipalFrom(r.Context())
 	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
 		return
 	}
+	sub := principal.Username
 
 	// Parse request body
 	var user db.CompleteUser
@@ -125,50 +131,73 @@ func (c *config) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create user in the database
-	database, err := db.New()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+	// Default to UTC until the user picks a time zone
+	pickedTimeZone := user.TimeZone != ""
+	if !pickedTimeZone {
+		user.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(user.TimeZone); err != nil {
+		http.Error(w, "Invalid time zone", http.StatusBadRequest)
 		return
 	}
-	defer database.Close()
 
-	err = database.CreateUser(user.Email, sub)
+	// The first tracker can come from a template
+	resolved, err := c.resolveTracker(user.Tracker, user.Symptoms, user.TemplateID)
 	if err != nil {
-		error := "Failed to create user: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get the created user from the database
-	createdUser, err := database.GetUserBySub(sub)
+	// Create user in the database
+	database, err := db.New()
 	if err != nil {
-		error := "Failed to get user: " + err.Error()
-		http.Error(w, error, http.StatusNotFound)
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
 		return
 	}
+	defer database.Close()
 
-	err = database.CreateTracker(user.Tracker, createdUser.ID)
+	// Only store an email the identity provider has verified; share
+	// invitations are matched against it
+	email, err := auth.VerifiedEmail(r.Context(), c.AuthClient, sub)
 	if err != nil {
-		error := "Failed to create tracker: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+		http.Error(w, "Failed to get verified email: "+err.Error(), identityErrorStatus(err))
 		return
 	}
 
-	createdTracker, err := database.GetTrackerByNameAndUserID(user.Tracker, createdUser.ID)
+	// Social logins are provisioned on first sign-in, so the row may exist
+	createdUser, created, err := c.provisionUser(r, database, email, sub, user.TimeZone)
 	if err != nil {
-		error := "Failed to get tracker: " + err.Error()
+		error := "Failed to create user: " + err.Error()
 		http.Error(w, error, http.StatusInternalServerError)
 		return
 	}
-
-	for _, symptom := range user.Symptoms {
-		err := database.CreateSymptom(symptom, createdTracker.ID)
+	if !created {
+		// Social logins provision the row without a tracker, and make-user
+		// then finishes onboarding. Anyone else has already been through it.
+		trackers, err := database.GetTrackerByUserID(createdUser.ID)
 		if err != nil {
-			error := "Failed to create symptom: " + err.Error()
-			http.Error(w, error, http.StatusInternalServerError)
+			http.Error(w, "Failed to get trackers: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(trackers) > 0 {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+	}
+	if !created && pickedTimeZone && createdUser.TimeZone != user.TimeZone {
+		if err := database.UpdateUserTimeZone(createdUser.ID, user.TimeZone); err != nil {
+			http.Error(w, "Failed to update time zone: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		createdUser.TimeZone = user.TimeZone
+		c.users.invalidate(sub)
+	}
+
+	createdTracker, err := createResolvedTracker(database, createdUser.ID, resolved)
+	if err != nil {
+		error := "Failed to create tracker: " + err.Error()
+		http.Error(w, error, http.StatusInternalServerError)
+		return
 	}
 
 	type Response struct {
@@ -180,7 +209,7 @@ func (c *config) createUser(w http.ResponseWriter, r *http.Request) {
 	response := Response{
 		UserID:   createdUser.ID,
 		Tracker:  createdTracker,
-		Symptoms: user.Symptoms,
+		Symptoms: resolved.symptoms,
 	}
 
 	jsonData, err := json.Marshal(response)
@@ -194,18 +223,51 @@ func (c *config) createUser(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
-func (c *config) createTracker(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
+// provisionUser returns the users row for username, creating it and seeding
+// the profile from the identity provider the first time. created reports
+// whether the row is new.
+func (c *config) provisionUser(
+	r *http.Request,
+	database *db.Database,
+	email, username, timeZone string,
+) (user db.User, created bool, err error) {
+	user, err = database.GetUserBySub(username)
+	if err == nil {
+		return user, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, false, err
+	}
+
+	if err := database.CreateUser(email, username, timeZone); err != nil {
+		// A concurrent first request may have created the row already
+		if user, lookupErr := database.GetUserBySub(username); lookupErr == nil {
+			return user, false, nil
+		}
+		return db.User{}, false, err
+	}
+	user, err = database.GetUserBySub(username)
+	if err != nil {
+		return db.User{}, false, err
+	}
+	c.seedProfile(r, database, user)
+	return user, true, nil
+}
+
+func (c *config) updateTimeZone(w http.ResponseWriter, r *http.Request, user db.User) {
+	type Request struct {
+		TimeZone string `json:"time_zone"`
+	}
+
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
-	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
+	// Only IANA names like "America/Denver" follow daylight saving changes
+	if _, err := time.LoadLocation(request.TimeZone); err != nil || request.TimeZone == "" {
+		http.Error(w, "Invalid time zone", http.StatusBadRequest)
 		return
 	}
 
@@ -216,12 +278,30 @@ func (c *config) createTracker(w http.ResponseWriter, r *http.Request) {
 	}
 	defer database.Close()
 
-	// Get User ID from the database
-	user, err := database.GetUserBySub(sub)
+	if err := database.UpdateUserTimeZone(user.ID, request.TimeZone); err != nil {
+		http.Error(w, "Failed to update time zone: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.users.invalidate(user.CognitoSub)
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		http.Error(w, "Failed to serialize time zone", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createTracker(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
 		return
 	}
+	defer database.Close()
 
 	// Check Tracker Count
 	trackers, err := database.GetTrackerByUserID(user.ID)
@@ -243,49 +323,24 @@ func (c *config) createTracker(w http.ResponseWriter, r *http.Request) {
 	}
 	tracker.UserID = user.ID
 
-	// Create tracker in the database
-	err = database.CreateTracker(tracker.TrackerName, tracker.UserID)
+	resolved, err := c.resolveTracker(tracker.TrackerName, tracker.Symptoms, tracker.TemplateID)
 	if err != nil {
-		error := "Failed to create tracker: " + err.Error()
-		http.Error(w, error, http.StatusConflict)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get the created tracker from the database
-	createdTracker, err := database.GetTrackerByNameAndUserID(tracker.TrackerName, tracker.UserID)
+	// Create tracker in the database
+	_, err = createResolvedTracker(database, tracker.UserID, resolved)
 	if err != nil {
-		error := "Failed to get tracker: " + err.Error()
-		http.Error(w, error, http.StatusInternalServerError)
+		error := "Failed to create tracker: " + err.Error()
+		http.Error(w, error, http.StatusConflict)
 		return
 	}
 
-	for _, symptom := range tracker.Symptoms {
-		err := database.CreateSymptom(symptom, createdTracker.ID)
-		if err != nil {
-			error := "Failed to create symptom: " + err.Error()
-			http.Error(w, error, http.StatusInternalServerError)
-			return
-		}
-	}
-
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (c *config) createSymptoms(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
-	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
-		return
-	}
-
+func (c *config) createSymptoms(w http.ResponseWriter, r *http.Request, user db.User) {
 	database, err := db.New()
 	if err != nil {
 		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
@@ -293,19 +348,6 @@ func (c *config) createSymptoms(w http.ResponseWriter, r *http.Request) {
 	}
 	defer database.Close()
 
-	// Get User ID from the database
-	user, err := database.GetUserBySub(sub)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
-	// Validate request
-	if user.CognitoSub != sub {
-		http.Error(w, "User ID mismatch", http.StatusBadRequest)
-		return
-	}
-
 	type SymptomRequestBody struct {
 		TrackerID int          `json:"tracker_id"`
 		Symptoms  []db.Symptom `json:"symptoms"`
@@ -331,21 +373,7 @@ func (c *config) createSymptoms(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (c *config) createSymptomLog(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
-	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
-		return
-	}
-
+func (c *config) createSymptomLog(w http.ResponseWriter, r *http.Request, user db.User) {
 	database, err := db.New()
 	if err != nil {
 		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
@@ -353,13 +381,6 @@ func (c *config) createSymptomLog(w http.ResponseWriter, r *http.Request) {
 	}
 	defer database.Close()
 
-	// Get User ID from the database
-	user, err := database.GetUserBySub(sub)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
 	// Parse request body
 	var symptomLog db.SymptomLogRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&symptomLog); err != nil {
@@ -376,21 +397,72 @@ func (c *config) createSymptomLog(w http.ResponseWriter, r *http.Request) {
 
 	symptomLog.TrackerID = tracker.ID
 
+	// Numeric severities must be on the tracker's scale
+	if severity, ok := openai.ParseSeverity(symptomLog.Severity); ok {
+		if severity < float64(tracker.SeverityMin) || severity > float64(tracker.SeverityMax) {
+			error := fmt.Sprintf("severity must be from %d to %d", tracker.SeverityMin, tracker.SeverityMax)
+			http.Error(w, error, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Logs default to now in the user's zone; an explicit log_time keeps its offset
+	symptomLog.LoggedAt = time.Now().In(user.Location())
+	if symptomLog.LogTime != "" {
+		loggedAt, err := time.Parse(time.RFC3339, symptomLog.LogTime)
+		if err != nil {
+			http.Error(w, "log_time must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		symptomLog.LoggedAt = loggedAt
+	}
+
+	// Tag the log with the keywords found in its notes
+	var tags []db.LogTag
+	for _, tag := range c.categorizer.Categorize(symptomLog.Notes) {
+		tags = append(tags, db.LogTag{
+			Category: tag.Category,
+			Keyword:  tag.Keyword,
+			Negated:  tag.Negated,
+		})
+	}
+
+	// Custom field values are validated against the tracker's field types
+	fields, err := database.GetTrackerFieldsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get tracker fields: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	values, err := db.ParseFieldValues(fields, symptomLog.Fields)
+	if err != nil {
+		http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Create symptom log in the database
-	err = database.CreateSymptomLog(symptomLog)
+	logID, err := database.CreateSymptomLog(symptomLog, tags, values)
 	if err != nil {
 		error := "Failed to create symptom log: " + err.Error()
 		http.Error(w, error, http.StatusInternalServerError)
 		return
 	}
 
-	// Get the created symptom log from the database where time is the closest to the current time
-	createdSymptomLog, err := database.GetSymptomLogByTrackerIDAndCurrentTime(tracker.ID)
+	// Keep the tracker's flare events up to date with the new log
+	if err := c.detectFlares(database, tracker.ID, user.Location()); err != nil {
+		log.Printf("Failed to detect flares for tracker %d: %v", tracker.ID, err)
+	}
+
+	// Get the created symptom log from the database
+	createdSymptomLog, err := database.GetSymptomLogByID(logID)
 	if err != nil {
 		error := "Failed to get symptom log: " + err.Error()
 		http.Error(w, error, http.StatusInternalServerError)
 		return
 	}
+	createdSymptomLog.LocalTime = createdSymptomLog.LogTimeIn(user.Location())
+	createdLogs := []db.SymptomLog{createdSymptomLog}
+	annotateCycles(database, user, createdLogs)
+	createdSymptomLog = createdLogs[0]
 
 	jsonData, err := json.Marshal(createdSymptomLog)
 	if err != nil {
@@ -403,47 +475,72 @@ func (c *config) createSymptomLog(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
-func (c *config) getSymptomLogs(w http.ResponseWriter, r *http.Request) {
-	// Retrieve claims from context
-	claims, ok := r.Context().Value("User-claims").(map[string]interface{})
-	if !ok {
-		http.Error(w, "Claims not found", http.StatusUnauthorized)
-		return
-	}
+// logDatabase is the part of *db.Database getSymptomLogs uses.
+type logDatabase interface {
+	trackerDatabase
+	cycleDatabase
+	GetSymptomLogsByTag(userID int, filter db.LogTagFilter) ([]db.SymptomLog, error)
+	GetSymptomLogsByTrackerID(trackerID int) ([]db.SymptomLog, error)
+	GetSymptomLogsByUserID(userID int) ([]db.SymptomLog, error)
+	Close() error
+}
 
-	// Extract user info from claims
-	sub, ok := claims["username"].(string)
-	if !ok {
-		http.Error(w, "username claim missing or invalid", http.StatusUnauthorized)
-		return
-	}
+func openLogDatabase() (logDatabase, error) {
+	return db.New()
+}
 
-	database, err := db.New()
+func (c *config) getSymptomLogs(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := c.openLogs()
 	if err != nil {
 		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
 		return
 	}
 	defer database.Close()
 
-	// Get User ID from the database
-	user, err := database.GetUserBySub(sub)
+	// With tracker_id only that tracker's logs are returned, which also lets
+	// grantees read a tracker shared with them
+	trackerID, err := queryInt(r, "tracker_id", 0)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, "tracker_id must be an integer", http.StatusBadRequest)
 		return
 	}
-
-	// Validate request
-	if user.CognitoSub != sub {
-		http.Error(w, "User ID mismatch", http.StatusBadRequest)
-		return
+	owner, isOwner := user, true
+	if trackerID != 0 {
+		access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+		if err != nil {
+			writeTrackerAccessError(w, err)
+			return
+		}
+		owner, isOwner = access.owner, access.isOwner()
+	}
+
+	// Get symptom logs from the database, optionally only those with a tag
+	query := r.URL.Query()
+	var symptomLogs []db.SymptomLog
+	switch {
+	case query.Get("category") != "" || query.Get("keyword") != "":
+		symptomLogs, err = database.GetSymptomLogsByTag(owner.ID, db.LogTagFilter{
+			Category: query.Get("category"),
+			Keyword:  strings.ToLower(query.Get("keyword")),
+			Negated:  query.Get("negated") == "true",
+		})
+		if trackerID != 0 {
+			symptomLogs = filterLogsByTracker(symptomLogs, trackerID)
+		}
+	case trackerID != 0:
+		symptomLogs, err = database.GetSymptomLogsByTrackerID(trackerID)
+	default:
+		symptomLogs, err = database.GetSymptomLogsByUserID(user.ID)
 	}
-
-	// Get symptom logs from the database
-	symptomLogs, err := database.GetSymptomLogsByUserID(user.ID)
 	if err != nil {
 		http.Error(w, "Failed to get symptom logs", http.StatusInternalServerError)
 		return
 	}
+	db.LocalizeLogs(symptomLogs, owner.Location())
+	// Cycles belong to the owner, not the tracker, so grantees don't see them
+	if isOwner {
+		annotateCycles(database, owner, symptomLogs)
+	}
 
 	// Convert the response to JSON
 	jsonData, err := json.Marshal(symptomLogs)
@@ -457,3 +554,14 @@ func (c *config) getSymptomLogs(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(jsonData)
 }
+
+// filterLogsByTracker keeps the logs that belong to trackerID.
+func filterLogsByTracker(symptomLogs []db.SymptomLog, trackerID int) []db.SymptomLog {
+	filtered := []db.SymptomLog{}
+	for _, symptomLog := range symptomLogs {
+		if symptomLog.TrackerID == trackerID {
+			filtered = append(filtered, symptomLog)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,238 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+const (
+	defaultCycleLength  = 28
+	defaultPeriodLength = 5
+	// lutealLength is the fairly constant time from ovulation to the next period
+	lutealLength = 14
+	// Gaps between starts outside this range are treated as missed entries
+	// rather than real cycles
+	minCycleLength = 15
+	maxCycleLength = 60
+	// predictionCycles is how many recent cycles the prediction averages
+	predictionCycles = 6
+)
+
+const (
+	PhaseMenstrual  = "menstrual"
+	PhaseFollicular = "follicular"
+	PhaseOvulatory  = "ovulatory"
+	PhaseLuteal     = "luteal"
+)
+
+// Cycle is a menstrual cycle starting on the first day of a period. Dates are
+// calendar days in the user's time zone; End is the last day of the period
+// and zero until it's recorded.
+type Cycle struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CyclePrediction estimates the next period from the user's own history.
+type CyclePrediction struct {
+	NextStart string `json:"next_start,omitempty"`
+	// AverageLength is the mean cycle length in days, 28 without history
+	AverageLength float64 `json:"average_length"`
+	// Variability is the standard deviation of cycle lengths in days
+	Variability  float64 `json:"variability"`
+	PeriodLength float64 `json:"period_length"`
+	CyclesUsed   int     `json:"cycles_used"`
+}
+
+// CyclePosition is where a day falls in its cycle. Day 1 is the first day of
+// the period.
+type CyclePosition struct {
+	Day   int
+	Phase string
+}
+
+// ParseCycles converts stored cycles, skipping any with an unparseable start.
+func ParseCycles(stored []db.Cycle) []Cycle {
+	var cycles []Cycle
+	for _, cycle := range stored {
+		start, err := time.Parse(time.DateOnly, cycle.StartDate)
+		if err != nil {
+			continue
+		}
+		end, _ := time.Parse(time.DateOnly, cycle.EndDate)
+		cycles = append(cycles, Cycle{Start: start, End: end})
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Start.Before(cycles[j].Start) })
+	return cycles
+}
+
+// AnnotateCycles sets the cycle day and phase of each log, using its local
+// date in loc.
+func AnnotateCycles(logs []db.SymptomLog, cycles []Cycle, loc *time.Location) {
+	if len(cycles) == 0 {
+		return
+	}
+	prediction := PredictNextCycle(cycles)
+	for i := range logs {
+		t, err := time.Parse(time.RFC3339, logs[i].LogTime)
+		if err != nil {
+			continue
+		}
+		if position, ok := PositionOf(t.In(loc), cycles, prediction); ok {
+			logs[i].CycleDay = position.Day
+			logs[i].CyclePhase = position.Phase
+		}
+	}
+}
+
+// PredictNextCycle averages the user's recent cycle and period lengths.
+// cycles must be sorted by start.
+func PredictNextCycle(cycles []Cycle) CyclePrediction {
+	prediction := CyclePrediction{
+		AverageLength: defaultCycleLength,
+		PeriodLength:  averagePeriodLength(cycles),
+	}
+	if len(cycles) == 0 {
+		return prediction
+	}
+
+	lengths := cycleLengths(cycles)
+	if len(lengths) > predictionCycles {
+		lengths = lengths[len(lengths)-predictionCycles:]
+	}
+	if len(lengths) > 0 {
+		mean := meanOf(lengths)
+		variance := 0.0
+		for _, length := range lengths {
+			variance += (length - mean) * (length - mean)
+		}
+		prediction.AverageLength = mean
+		prediction.Variability = math.Sqrt(variance / float64(len(lengths)))
+		prediction.CyclesUsed = len(lengths)
+	}
+
+	last := truncateDay(cycles[len(cycles)-1].Start)
+	next := last.AddDate(0, 0, int(math.Round(prediction.AverageLength)))
+	prediction.NextStart = next.Format(time.DateOnly)
+	return prediction
+}
+
+// PositionOf finds the cycle day and phase of date. It returns false before
+// the first recorded cycle or when the last start is too long ago to trust.
+// cycles must be sorted by start.
+func PositionOf(date time.Time, cycles []Cycle, prediction CyclePrediction) (CyclePosition, bool) {
+	day := truncateDay(date)
+	i := sort.Search(len(cycles), func(i int) bool {
+		return truncateDay(cycles[i].Start).After(day)
+	}) - 1
+	if i < 0 {
+		return CyclePosition{}, false
+	}
+
+	start := truncateDay(cycles[i].Start)
+	cycleDay := daysBetween(start, day) + 1
+	if cycleDay > maxCycleLength {
+		return CyclePosition{}, false
+	}
+
+	length := int(math.Round(prediction.AverageLength))
+	if i+1 < len(cycles) {
+		if actual := daysBetween(start, truncateDay(cycles[i+1].Start)); actual >= minCycleLength && actual <= maxCycleLength {
+			length = actual
+		}
+	}
+	periodLength := int(math.Round(prediction.PeriodLength))
+	if !cycles[i].End.IsZero() {
+		periodLength = daysBetween(start, truncateDay(cycles[i].End)) + 1
+	}
+
+	ovulation := length - lutealLength
+	position := CyclePosition{Day: cycleDay}
+	switch {
+	case cycleDay <= periodLength:
+		position.Phase = PhaseMenstrual
+	case cycleDay < ovulation-1:
+		position.Phase = PhaseFollicular
+	case cycleDay <= ovulation+1:
+		position.Phase = PhaseOvulatory
+	default:
+		position.Phase = PhaseLuteal
+	}
+	return position, true
+}
+
+// PhaseStat summarizes the logs that fell in one cycle phase.
+type PhaseStat struct {
+	Phase        string         `json:"phase"`
+	Logs         int            `json:"logs"`
+	MeanSeverity float64        `json:"mean_severity"`
+	TopSymptoms  []SymptomCount `json:"top_symptoms"`
+}
+
+// CyclePhaseStats groups logs by cycle phase, in cycle order. Logs outside
+// any tracked cycle are left out.
+func CyclePhaseStats(logs []Log, cycles []Cycle) []PhaseStat {
+	prediction := PredictNextCycle(cycles)
+	byPhase := map[string][]Log{}
+	for _, log := range logs {
+		if position, ok := PositionOf(log.Time, cycles, prediction); ok {
+			byPhase[position.Phase] = append(byPhase[position.Phase], log)
+		}
+	}
+
+	stats := []PhaseStat{}
+	for _, phase := range []string{PhaseMenstrual, PhaseFollicular, PhaseOvulatory, PhaseLuteal} {
+		phaseLogs := byPhase[phase]
+		if len(phaseLogs) == 0 {
+			continue
+		}
+		symptomLists := make([][]string, len(phaseLogs))
+		for i, log := range phaseLogs {
+			symptomLists[i] = log.Symptoms
+		}
+		top, _ := SymptomFrequencies(symptomLists)
+		if len(top) > 5 {
+			top = top[:5]
+		}
+		stats = append(stats, PhaseStat{
+			Phase:        phase,
+			Logs:         len(phaseLogs),
+			MeanSeverity: meanSeverity(phaseLogs),
+			TopSymptoms:  top,
+		})
+	}
+	return stats
+}
+
+func cycleLengths(cycles []Cycle) []float64 {
+	var lengths []float64
+	for i := 1; i < len(cycles); i++ {
+		length := daysBetween(truncateDay(cycles[i-1].Start), truncateDay(cycles[i].Start))
+		if length >= minCycleLength && length <= maxCycleLength {
+			lengths = append(lengths, float64(length))
+		}
+	}
+	return lengths
+}
+
+func averagePeriodLength(cycles []Cycle) float64 {
+	total, count := 0, 0
+	for _, cycle := range cycles {
+		if cycle.End.IsZero() {
+			continue
+		}
+		total += daysBetween(truncateDay(cycle.Start), truncateDay(cycle.End)) + 1
+		count++
+	}
+	if count == 0 {
+		return defaultPeriodLength
+	}
+	return float64(total) / float64(count)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	t, _ := time.Parse(time.DateOnly, value)
+	return t
+}
+
+func TestPredictNextCycle(t *testing.T) {
+	cycles := []Cycle{
+		{Start: date("2024-01-01"), End: date("2024-01-05")},
+		{Start: date("2024-01-29"), End: date("2024-02-02")},
+		{Start: date("2024-02-28"), End: date("2024-03-03")},
+		// A 90 day gap is a missed entry, not a cycle
+		{Start: date("2024-05-27")},
+	}
+
+	prediction := PredictNextCycle(cycles)
+	if prediction.CyclesUsed != 2 || prediction.AverageLength != 29 {
+		t.Errorf("Expected 2 cycles averaging 29 days, got %+v", prediction)
+	}
+	if prediction.PeriodLength != 5 {
+		t.Errorf("Expected a 5 day period, got %v", prediction.PeriodLength)
+	}
+	if prediction.NextStart != "2024-06-25" {
+		t.Errorf("Expected next start 2024-06-25, got %s", prediction.NextStart)
+	}
+}
+
+func TestPredictNextCycleWithoutHistory(t *testing.T) {
+	prediction := PredictNextCycle([]Cycle{{Start: date("2024-01-01")}})
+	if prediction.AverageLength != 28 || prediction.NextStart != "2024-01-29" {
+		t.Errorf("Expected the 28 day default, got %+v", prediction)
+	}
+}
+
+func TestPositionOf(t *testing.T) {
+	cycles := []Cycle{
+		{Start: date("2024-01-01"), End: date("2024-01-04")},
+		{Start: date("2024-01-31")},
+	}
+	prediction := PredictNextCycle(cycles)
+
+	tests := []struct {
+		date  string
+		day   int
+		phase string
+	}{
+		{"2024-01-01", 1, PhaseMenstrual},
+		{"2024-01-04", 4, PhaseMenstrual},
+		{"2024-01-05", 5, PhaseFollicular},
+		// The first cycle is 30 days, so ovulation is around day 16
+		{"2024-01-16", 16, PhaseOvulatory},
+		{"2024-01-20", 20, PhaseLuteal},
+		{"2024-01-31", 1, PhaseMenstrual},
+	}
+	for _, test := range tests {
+		position, ok := PositionOf(date(test.date).Add(15*time.Hour), cycles, prediction)
+		if !ok || position.Day != test.day || position.Phase != test.phase {
+			t.Errorf("%s: expected day %d %s, got %+v (%v)", test.date, test.day, test.phase, position, ok)
+		}
+	}
+
+	if _, ok := PositionOf(date("2023-12-31"), cycles, prediction); ok {
+		t.Errorf("Expected no position before the first cycle")
+	}
+	if _, ok := PositionOf(date("2024-06-01"), cycles, prediction); ok {
+		t.Errorf("Expected no position long after the last cycle")
+	}
+}
+
+func TestCyclePhaseStats(t *testing.T) {
+	cycles := []Cycle{{Start: date("2024-01-01"), End: date("2024-01-03")}}
+	logs := []Log{
+		{Time: date("2024-01-02"), Severity: 8, Symptoms: []string{"cramps"}},
+		{Time: date("2024-01-03"), Severity: 6, Symptoms: []string{"cramps", "fatigue"}},
+		{Time: date("2024-01-20"), Severity: 2, Symptoms: []string{"bloating"}},
+	}
+
+	stats := CyclePhaseStats(logs, cycles)
+	if len(stats) != 2 || stats[0].Phase != PhaseMenstrual || stats[1].Phase != PhaseLuteal {
+		t.Fatalf("Expected menstrual and luteal stats, got %+v", stats)
+	}
+	if stats[0].Logs != 2 || stats[0].MeanSeverity != 7 || stats[0].TopSymptoms[0].Symptom != "cramps" {
+		t.Errorf("Unexpected menstrual stats: %+v", stats[0])
+	}
+}
@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBaselineDays   = 28
+	defaultFlareThreshold = 2.0
+	// minBaselineDays of history are needed before a day can be flagged
+	minBaselineDays = 7
+	// minDeviation keeps a near-constant baseline from turning tiny changes
+	// into huge z-scores
+	minDeviation = 0.5
+)
+
+type FlareOptions struct {
+	// BaselineDays is how many days before a day form its rolling baseline
+	BaselineDays int
+	// Threshold is the z-score above the baseline that counts as a flare
+	Threshold float64
+}
+
+// LoadFlareOptions reads FLARE_BASELINE_DAYS and FLARE_Z_THRESHOLD.
+func LoadFlareOptions() FlareOptions {
+	opts := FlareOptions{
+		BaselineDays: defaultBaselineDays,
+		Threshold:    defaultFlareThreshold,
+	}
+	if days, err := strconv.Atoi(os.Getenv("FLARE_BASELINE_DAYS")); err == nil && days >= minBaselineDays {
+		opts.BaselineDays = days
+	}
+	if threshold, err := strconv.ParseFloat(os.Getenv("FLARE_Z_THRESHOLD"), 64); err == nil && threshold > 0 {
+		opts.Threshold = threshold
+	}
+	return opts
+}
+
+// Flare is a run of consecutive days where log frequency or severity was well
+// above the user's rolling baseline.
+type Flare struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Reason is "frequency", "severity" or "frequency and severity"
+	Reason       string  `json:"reason"`
+	PeakLogs     int     `json:"peak_logs"`
+	PeakSeverity float64 `json:"peak_severity"`
+	// Score is the largest z-score reached during the flare
+	Score float64 `json:"score"`
+}
+
+type day struct {
+	date       time.Time
+	logs       int
+	severities []float64
+}
+
+// DetectFlares flags days whose log count or mean severity is at least
+// opts.Threshold standard deviations above the preceding opts.BaselineDays,
+// and merges consecutive flagged days into flares. logs must be sorted by time.
+func DetectFlares(logs []Log, opts FlareOptions) []Flare {
+	flares := []Flare{}
+	if len(logs) == 0 {
+		return flares
+	}
+
+	days := dailySeries(logs)
+
+	var current *Flare
+	for i, d := range days {
+		countZ, severityZ := 0.0, 0.0
+		if i >= minBaselineDays {
+			start := max(0, i-opts.BaselineDays)
+			countZ = countScore(days[start:i], d)
+			severityZ = severityScore(days[start:i], d)
+		}
+
+		frequency := countZ >= opts.Threshold
+		severity := severityZ >= opts.Threshold
+		if !frequency && !severity {
+			if current != nil {
+				flares = append(flares, *current)
+				current = nil
+			}
+			continue
+		}
+
+		reason := "frequency"
+		if frequency && severity {
+			reason = "frequency and severity"
+		} else if severity {
+			reason = "severity"
+		}
+		date := d.date.Format(time.DateOnly)
+		if current == nil {
+			current = &Flare{Start: date, Reason: reason}
+		} else if current.Reason != reason {
+			current.Reason = "frequency and severity"
+		}
+		current.End = date
+		current.PeakLogs = max(current.PeakLogs, d.logs)
+		current.PeakSeverity = math.Max(current.PeakSeverity, maxOf(d.severities))
+		current.Score = math.Max(current.Score, math.Max(countZ, severityZ))
+	}
+	if current != nil {
+		flares = append(flares, *current)
+	}
+	return flares
+}
+
+// dailySeries buckets logs by calendar day, including days without logs.
+func dailySeries(logs []Log) []day {
+	first := truncateDay(logs[0].Time)
+	last := truncateDay(logs[len(logs)-1].Time)
+
+	days := make([]day, int(last.Sub(first).Hours()/24)+1)
+	for i := range days {
+		days[i].date = first.AddDate(0, 0, i)
+	}
+	for _, log := range logs {
+		i := int(truncateDay(log.Time).Sub(first).Hours() / 24)
+		days[i].logs++
+		days[i].severities = append(days[i].severities, log.Severity)
+	}
+	return days
+}
+
+// truncateDay returns t's local calendar date as midnight UTC, so that days are
+// always 24 hours apart regardless of daylight saving changes.
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func countScore(baseline []day, d day) float64 {
+	counts := make([]float64, len(baseline))
+	for i, b := range baseline {
+		counts[i] = float64(b.logs)
+	}
+	mean, deviation := meanAndDeviation(counts)
+	return (float64(d.logs) - mean) / deviation
+}
+
+func severityScore(baseline []day, d day) float64 {
+	if len(d.severities) == 0 {
+		return 0
+	}
+	var severities []float64
+	for _, b := range baseline {
+		severities = append(severities, b.severities...)
+	}
+	if len(severities) < 3 {
+		return 0
+	}
+	mean, deviation := meanAndDeviation(severities)
+	return (meanOf(d.severities) - mean) / deviation
+}
+
+func meanAndDeviation(values []float64) (float64, float64) {
+	mean := meanOf(values)
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	variance /= float64(len(values))
+	return mean, math.Max(math.Sqrt(variance), minDeviation)
+}
+
+func meanOf(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total / float64(len(values))
+}
+
+func maxOf(values []float64) float64 {
+	result := 0.0
+	for _, value := range values {
+		result = math.Max(result, value)
+	}
+	return result
+}
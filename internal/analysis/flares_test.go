@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectFlares(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	var logs []Log
+	for i := 0; i < 30; i++ {
+		logs = append(logs, Log{Time: start.AddDate(0, 0, i), Severity: 3})
+	}
+	// Days 20 and 21 have several severe logs each
+	for i := 20; i <= 21; i++ {
+		for hour := 1; hour <= 3; hour++ {
+			logs = append(logs, Log{Time: start.AddDate(0, 0, i).Add(time.Duration(hour) * time.Hour), Severity: 8})
+		}
+	}
+	sortLogsByTime(logs)
+
+	flares := DetectFlares(logs, FlareOptions{BaselineDays: 14, Threshold: 2})
+	if len(flares) != 1 {
+		t.Fatalf("Expected 1 flare, got %+v", flares)
+	}
+	flare := flares[0]
+	if flare.Start != "2024-05-21" || flare.End != "2024-05-22" {
+		t.Errorf("Expected flare from 2024-05-21 to 2024-05-22, got %s to %s", flare.Start, flare.End)
+	}
+	if flare.Reason != "frequency and severity" || flare.PeakLogs != 4 || flare.PeakSeverity != 8 {
+		t.Errorf("Unexpected flare details: %+v", flare)
+	}
+}
+
+func TestDetectFlaresNeedsHistory(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	logs := []Log{
+		{Time: start, Severity: 1},
+		{Time: start.AddDate(0, 0, 1), Severity: 10},
+	}
+
+	if flares := DetectFlares(logs, FlareOptions{BaselineDays: 14, Threshold: 2}); len(flares) != 0 {
+		t.Errorf("Expected no flares without a baseline, got %+v", flares)
+	}
+}
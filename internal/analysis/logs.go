@@ -0,0 +1,50 @@
+// Package analysis computes deterministic statistics and insights from
+// symptom logs, without calling out to a language model.
+package analysis
+
+import (
+	"sort"
+	"time"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+)
+
+// Log is a symptom log with its time and severity already parsed.
+type Log struct {
+	Time     time.Time
+	Severity float64
+	Symptoms []string
+	Notes    string
+}
+
+// ParseLogs converts stored logs sorted by time, skipping logs without a
+// parseable time or numeric severity. Times are converted to loc so that days
+// are bucketed in the user's time zone.
+func ParseLogs(symptomLogs []db.SymptomLog, loc *time.Location) []Log {
+	var logs []Log
+	for _, symptomLog := range symptomLogs {
+		t, ok := openai.ParseLogTime(symptomLog.LogTime)
+		if !ok {
+			continue
+		}
+		severity, ok := openai.ParseSeverity(symptomLog.Severity)
+		if !ok {
+			continue
+		}
+		logs = append(logs, Log{
+			Time:     t.In(loc),
+			Severity: severity,
+			Symptoms: openai.SplitSymptoms(symptomLog.Symptoms),
+			Notes:    symptomLog.Notes,
+		})
+	}
+	sortLogsByTime(logs)
+	return logs
+}
+
+func sortLogsByTime(logs []Log) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+}
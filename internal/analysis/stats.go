@@ -0,0 +1,114 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+)
+
+type SymptomCount struct {
+	Symptom string `json:"symptom"`
+	Count   int    `json:"count"`
+}
+
+// CoOccurrence counts how often two symptoms are logged together.
+// Matrix[i][j] is the number of logs with both Symptoms[i] and Symptoms[j];
+// the diagonal is each symptom's own count.
+type CoOccurrence struct {
+	Symptoms []string `json:"symptoms"`
+	Matrix   [][]int  `json:"matrix"`
+}
+
+// SymptomFrequencies returns symptoms ordered by how many logs mention them
+// and their co-occurrence matrix, in the same order.
+func SymptomFrequencies(symptomLists [][]string) ([]SymptomCount, CoOccurrence) {
+	counts := map[string]int{}
+	for _, symptoms := range symptomLists {
+		for _, symptom := range unique(symptoms) {
+			counts[symptom]++
+		}
+	}
+
+	frequencies := make([]SymptomCount, 0, len(counts))
+	for symptom, count := range counts {
+		frequencies = append(frequencies, SymptomCount{Symptom: symptom, Count: count})
+	}
+	sort.Slice(frequencies, func(i, j int) bool {
+		if frequencies[i].Count != frequencies[j].Count {
+			return frequencies[i].Count > frequencies[j].Count
+		}
+		return frequencies[i].Symptom < frequencies[j].Symptom
+	})
+
+	index := make(map[string]int, len(frequencies))
+	coOccurrence := CoOccurrence{
+		Symptoms: make([]string, len(frequencies)),
+		Matrix:   make([][]int, len(frequencies)),
+	}
+	for i, frequency := range frequencies {
+		index[frequency.Symptom] = i
+		coOccurrence.Symptoms[i] = frequency.Symptom
+		coOccurrence.Matrix[i] = make([]int, len(frequencies))
+	}
+	for _, symptoms := range symptomLists {
+		symptoms = unique(symptoms)
+		for _, a := range symptoms {
+			for _, b := range symptoms {
+				coOccurrence.Matrix[index[a]][index[b]]++
+			}
+		}
+	}
+
+	return frequencies, coOccurrence
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Streak is a run of consecutive days.
+type Streak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// LongestGap finds the longest run of days without a log between the first
+// logged day and until, inclusive. days are dates formatted as YYYY-MM-DD.
+func LongestGap(days []string, until time.Time) Streak {
+	var logged []time.Time
+	for _, day := range days {
+		t, err := time.Parse(time.DateOnly, day)
+		if err == nil {
+			logged = append(logged, t)
+		}
+	}
+	if len(logged) == 0 {
+		return Streak{}
+	}
+	sort.Slice(logged, func(i, j int) bool { return logged[i].Before(logged[j]) })
+
+	end := time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, time.UTC)
+	// A sentinel the day after until closes a gap running up to today
+	logged = append(logged, end.AddDate(0, 0, 1))
+
+	var longest Streak
+	for i := 1; i < len(logged); i++ {
+		gap := int(logged[i].Sub(logged[i-1]).Hours()/24) - 1
+		if gap > longest.Days {
+			longest = Streak{
+				Days:  gap,
+				Start: logged[i-1].AddDate(0, 0, 1).Format(time.DateOnly),
+				End:   logged[i].AddDate(0, 0, -1).Format(time.DateOnly),
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLongestGap(t *testing.T) {
+	until := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	denver, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatalf("Failed to load zone: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		days  []string
+		until time.Time
+		want  Streak
+	}{
+		{"no logs", nil, until, Streak{}},
+		{"unparseable days", []string{"yesterday", ""}, until, Streak{}},
+		{"single log today", []string{"2024-03-10"}, until, Streak{}},
+		{
+			"single log runs to today",
+			[]string{"2024-03-07"},
+			until,
+			Streak{Days: 3, Start: "2024-03-08", End: "2024-03-10"},
+		},
+		{"same day twice", []string{"2024-03-10", "2024-03-10"}, until, Streak{}},
+		{
+			"same day before a gap",
+			[]string{"2024-03-01", "2024-03-01", "2024-03-05", "2024-03-06", "2024-03-07", "2024-03-08", "2024-03-09", "2024-03-10"},
+			until,
+			Streak{Days: 3, Start: "2024-03-02", End: "2024-03-04"},
+		},
+		{
+			"unsorted",
+			[]string{"2024-03-09", "2024-03-01", "2024-03-10"},
+			until,
+			Streak{Days: 7, Start: "2024-03-02", End: "2024-03-08"},
+		},
+		{
+			"ties keep the earliest",
+			[]string{"2024-03-01", "2024-03-04", "2024-03-07", "2024-03-08", "2024-03-09", "2024-03-10"},
+			until,
+			Streak{Days: 2, Start: "2024-03-02", End: "2024-03-03"},
+		},
+		{
+			// Still March 9 for the user, so the 10th isn't counted yet
+			"until in the user's zone",
+			[]string{"2024-03-07"},
+			time.Date(2024, 3, 9, 23, 30, 0, 0, denver),
+			Streak{Days: 2, Start: "2024-03-08", End: "2024-03-09"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LongestGap(tt.days, tt.until); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSymptomFrequencies(t *testing.T) {
+	tests := []struct {
+		name             string
+		symptomLists     [][]string
+		wantFrequencies  []SymptomCount
+		wantCoOccurrence CoOccurrence
+	}{
+		{
+			"no logs",
+			nil,
+			[]SymptomCount{},
+			CoOccurrence{Symptoms: []string{}, Matrix: [][]int{}},
+		},
+		{
+			"single log repeating a symptom",
+			[][]string{{"headache", "nausea", "headache"}},
+			[]SymptomCount{{"headache", 1}, {"nausea", 1}},
+			CoOccurrence{
+				Symptoms: []string{"headache", "nausea"},
+				Matrix:   [][]int{{1, 1}, {1, 1}},
+			},
+		},
+		{
+			"ordered by count then name",
+			[][]string{{"nausea"}, {"fatigue", "nausea"}, {"headache"}, {}},
+			[]SymptomCount{{"nausea", 2}, {"fatigue", 1}, {"headache", 1}},
+			CoOccurrence{
+				Symptoms: []string{"nausea", "fatigue", "headache"},
+				Matrix:   [][]int{{2, 1, 0}, {1, 1, 0}, {0, 0, 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frequencies, coOccurrence := SymptomFrequencies(tt.symptomLists)
+			if !reflect.DeepEqual(frequencies, tt.wantFrequencies) {
+				t.Errorf("Expected frequencies %+v, got %+v", tt.wantFrequencies, frequencies)
+			}
+			if !reflect.DeepEqual(coOccurrence, tt.wantCoOccurrence) {
+				t.Errorf("Expected co-occurrence %+v, got %+v", tt.wantCoOccurrence, coOccurrence)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+)
+
+type TriggerOptions struct {
+	// Window is how long after a log a later high-severity log still counts
+	Window time.Duration
+	// MinSupport is how many logs must mention a keyword before it's ranked
+	MinSupport int
+	// HighSeverity is the severity at or above which a log counts as high.
+	// Zero means anything above the tracker's mean severity.
+	HighSeverity float64
+}
+
+// Trigger is a note keyword and how often it precedes high-severity logs.
+type Trigger struct {
+	Category string `json:"category"`
+	Keyword  string `json:"keyword"`
+	// Occurrences is the number of logs mentioning the keyword
+	Occurrences int `json:"occurrences"`
+	// FollowedByHigh is how many of those had a high-severity log in the window
+	FollowedByHigh int `json:"followed_by_high"`
+	// Confidence is FollowedByHigh / Occurrences
+	Confidence float64 `json:"confidence"`
+	// Lift is Confidence relative to the base rate; above 1 means the keyword
+	// is followed by high severity more often than logs in general
+	Lift float64 `json:"lift"`
+}
+
+type TriggerReport struct {
+	Logs         int       `json:"logs"`
+	WindowHours  float64   `json:"window_hours"`
+	HighSeverity float64   `json:"high_severity"`
+	BaseRate     float64   `json:"base_rate"`
+	Triggers     []Trigger `json:"triggers"`
+}
+
+// FindTriggers ranks the keywords extracted from notes by how much more often
+// than usual they precede a high-severity log within opts.Window. logs must be
+// sorted by time. Negated keywords ("no coffee") are not counted.
+func FindTriggers(logs []Log, categorizer *openai.Categorizer, opts TriggerOptions) TriggerReport {
+	report := TriggerReport{
+		Logs:        len(logs),
+		WindowHours: opts.Window.Hours(),
+		Triggers:    []Trigger{},
+	}
+	if len(logs) == 0 {
+		return report
+	}
+
+	threshold := opts.HighSeverity
+	high := func(severity float64) bool { return severity >= threshold }
+	if threshold == 0 {
+		threshold = meanSeverity(logs)
+		high = func(severity float64) bool { return severity > threshold }
+	}
+	report.HighSeverity = threshold
+
+	// followed[i] is whether a high log falls within (logs[i].Time, +Window].
+	// Only strictly later logs count, so a high log isn't its own follow-up
+	// and logs at the same instant can't precede each other.
+	followed := make([]bool, len(logs))
+	nextHigh := -1
+	for end := len(logs) - 1; end >= 0; {
+		start := end
+		for start > 0 && logs[start-1].Time.Equal(logs[end].Time) {
+			start--
+		}
+		for i := start; i <= end; i++ {
+			followed[i] = nextHigh >= 0 && logs[nextHigh].Time.Sub(logs[i].Time) <= opts.Window
+		}
+		for i := end; i >= start; i-- {
+			if high(logs[i].Severity) {
+				nextHigh = i
+			}
+		}
+		end = start - 1
+	}
+
+	followedCount := 0
+	type key struct{ category, keyword string }
+	counts := map[key]*Trigger{}
+	for i, log := range logs {
+		if followed[i] {
+			followedCount++
+		}
+		seen := map[key]bool{}
+		for _, tag := range categorizer.Categorize(log.Notes) {
+			k := key{tag.Category, tag.Keyword}
+			if tag.Negated || seen[k] {
+				continue
+			}
+			seen[k] = true
+
+			trigger, ok := counts[k]
+			if !ok {
+				trigger = &Trigger{Category: tag.Category, Keyword: tag.Keyword}
+				counts[k] = trigger
+			}
+			trigger.Occurrences++
+			if followed[i] {
+				trigger.FollowedByHigh++
+			}
+		}
+	}
+	report.BaseRate = float64(followedCount) / float64(len(logs))
+
+	for _, trigger := range counts {
+		if trigger.Occurrences < opts.MinSupport {
+			continue
+		}
+		trigger.Confidence = float64(trigger.FollowedByHigh) / float64(trigger.Occurrences)
+		if report.BaseRate > 0 {
+			trigger.Lift = trigger.Confidence / report.BaseRate
+		}
+		report.Triggers = append(report.Triggers, *trigger)
+	}
+
+	sort.Slice(report.Triggers, func(i, j int) bool {
+		a, b := report.Triggers[i], report.Triggers[j]
+		if a.Lift != b.Lift {
+			return a.Lift > b.Lift
+		}
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.Occurrences != b.Occurrences {
+			return a.Occurrences > b.Occurrences
+		}
+		return a.Keyword < b.Keyword
+	})
+	return report
+}
+
+func meanSeverity(logs []Log) float64 {
+	total := 0.0
+	for _, log := range logs {
+		total += log.Severity
+	}
+	return total / float64(len(logs))
+}
@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+)
+
+func TestFindTriggers(t *testing.T) {
+	categorizer := openai.NewCategorizer(map[string][]string{
+		"Food":     {"coffee", "spicy"},
+		"Activity": {"yoga"},
+	})
+
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	var logs []Log
+	for day := 0; day < 10; day++ {
+		morning := start.AddDate(0, 0, day)
+		note, evening := "yoga before work", 2.0
+		if day%2 == 0 {
+			note, evening = "spicy lunch and coffee", 8.0
+		}
+		logs = append(logs,
+			Log{Time: morning, Severity: 2, Notes: note},
+			Log{Time: morning.Add(10 * time.Hour), Severity: evening, Notes: "no coffee"},
+		)
+	}
+
+	report := FindTriggers(logs, categorizer, TriggerOptions{
+		Window:     12 * time.Hour,
+		MinSupport: 2,
+	})
+
+	if len(report.Triggers) != 3 {
+		t.Fatalf("Expected 3 triggers, got %+v", report.Triggers)
+	}
+	top := report.Triggers[0]
+	if top.Keyword != "coffee" && top.Keyword != "spicy" {
+		t.Errorf("Expected coffee or spicy to rank first, got %s", top.Keyword)
+	}
+	if top.Confidence != 1 || top.Occurrences != 5 {
+		t.Errorf("Expected 5 occurrences all followed by high severity, got %+v", top)
+	}
+	last := report.Triggers[2]
+	if last.Keyword != "yoga" || last.FollowedByHigh != 0 || last.Lift != 0 {
+		t.Errorf("Expected yoga to rank last with no lift, got %+v", last)
+	}
+}
+
+func TestFindTriggersOnlyCountsLaterLogs(t *testing.T) {
+	categorizer := openai.NewCategorizer(map[string][]string{
+		"Food": {"coffee", "dairy"},
+	})
+
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	var logs []Log
+	for day := 0; day < 4; day++ {
+		morning := start.AddDate(0, 0, day)
+		logs = append(logs,
+			// dairy is only ever noted in the high-severity logs themselves
+			Log{Time: morning, Severity: 8, Notes: "flare after dairy"},
+			// coffee is noted alongside them, at the same instant
+			Log{Time: morning, Severity: 2, Notes: "coffee"},
+		)
+	}
+
+	report := FindTriggers(logs, categorizer, TriggerOptions{
+		Window:     time.Hour,
+		MinSupport: 1,
+	})
+
+	for _, trigger := range report.Triggers {
+		if trigger.FollowedByHigh != 0 {
+			t.Errorf("Expected %s not to precede a high-severity log, got %+v", trigger.Keyword, trigger)
+		}
+	}
+	if report.BaseRate != 0 {
+		t.Errorf("Expected a base rate of 0 with no later high logs, got %v", report.BaseRate)
+	}
+}
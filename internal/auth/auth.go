@@ -5,11 +5,9 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,9 +16,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 )
 
+// CognitoClient is the IdentityProvider backed by a Cognito user pool.
 type CognitoClient struct {
-	AppClientID string
-	UserPoolID  string
+	AppClientID  string
+	UserPoolID   string
+	ClientSecret string
 	*cip.Client
 }
 
@@ -31,9 +31,10 @@ func Init() *CognitoClient {
 		log.Fatalf("unable to load SDK config, %v", err)
 	}
 	return &CognitoClient{
-		AppClientID: os.Getenv("COGNITO_APP_CLIENT_ID"),
-		Client:      cip.NewFromConfig(cfg),
-		UserPoolID:  os.Getenv("COGNITO_USER_POOL_ID"),
+		AppClientID:  os.Getenv("COGNITO_APP_CLIENT_ID"),
+		Client:       cip.NewFromConfig(cfg),
+		UserPoolID:   os.Getenv("COGNITO_USER_POOL_ID"),
+		ClientSecret: os.Getenv("COGNITO_CLIENT_SECRET"),
 	}
 }
 
@@ -42,9 +43,9 @@ func (c *CognitoClient) SignUp(
 	ctx context.Context,
 	email, firstName, lastName, password string,
 ) error {
-	secretHash, err := CalculateSecretHash(c.AppClientID, os.Getenv("COGNITO_CLIENT_SECRET"), email)
+	secretHash, err := c.secretHash(email)
 	if err != nil {
-		return errors.New("failed to calculate secret hash: " + err.Error())
+		return err
 	}
 
 	input := &cip.SignUpInput{
@@ -71,7 +72,7 @@ func (c *CognitoClient) SignUp(
 	// Call the Cognito SignUp API
 	_, err = c.Client.SignUp(ctx, input)
 	if err != nil {
-		return errors.New("failed to sign up user: " + err.Error())
+		return cognitoError("failed to sign up user", err)
 	}
 
 	return nil
@@ -93,39 +94,178 @@ func CalculateSecretHash(clientID, clientSecret, username string) (string, error
 	return secretHash, nil
 }
 
-type ConfirmSignupRequest struct {
-	Username         string `json:"username"`
-	ConfirmationCode string `json:"confirmationCode"`
+// GetUserAttributes returns a user's Cognito attributes by name, such as
+// "email", "name" (first name) and "family_name".
+func (c *CognitoClient) GetUserAttributes(ctx context.Context, username string) (map[string]string, error) {
+	out, err := c.Client.AdminGetUser(ctx, &cip.AdminGetUserInput{
+		UserPoolId: aws.String(c.UserPoolID),
+		Username:   aws.String(username),
+	})
+	if err != nil {
+		return nil, cognitoError("failed to get user attributes", err)
+	}
+
+	attributes := make(map[string]string, len(out.UserAttributes))
+	for _, attribute := range out.UserAttributes {
+		attributes[aws.ToString(attribute.Name)] = aws.ToString(attribute.Value)
+	}
+	return attributes, nil
 }
 
-func (c *CognitoClient) ConfirmSignup(w http.ResponseWriter, r *http.Request) {
-	var req ConfirmSignupRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+func (c *CognitoClient) ConfirmSignUp(ctx context.Context, username, code string) error {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return err
 	}
-	secretHash, err := CalculateSecretHash(
-		c.AppClientID,
-		os.Getenv("COGNITO_CLIENT_SECRET"),
-		req.Username,
-	)
+	_, err = c.Client.ConfirmSignUp(ctx, &cip.ConfirmSignUpInput{
+		ClientId:         aws.String(c.AppClientID),
+		Username:         aws.String(username),
+		SecretHash:       aws.String(secretHash),
+		ConfirmationCode: aws.String(code),
+	})
 	if err != nil {
-		http.Error(w, "Failed to calculate secret hash", http.StatusInternalServerError)
-		log.Printf("Failed to calculate secret hash: %v", err)
-		return
+		return cognitoError("failed to confirm sign up", err)
 	}
+	return nil
+}
 
-	_, err = c.Client.ConfirmSignUp(context.TODO(), &cip.ConfirmSignUpInput{
+func (c *CognitoClient) ResendConfirmationCode(ctx context.Context, username string) error {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.ResendConfirmationCode(ctx, &cip.ResendConfirmationCodeInput{
+		ClientId:   aws.String(c.AppClientID),
+		Username:   aws.String(username),
+		SecretHash: aws.String(secretHash),
+	})
+	if err != nil {
+		return cognitoError("failed to resend confirmation code", err)
+	}
+	return nil
+}
+
+// Refresh runs the REFRESH_TOKEN_AUTH flow. The secret hash must be computed
+// from the username Cognito knows the user by, such as their sub.
+func (c *CognitoClient) Refresh(ctx context.Context, username, refreshToken string) (AuthResult, error) {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	out, err := c.Client.AdminInitiateAuth(ctx, &cip.AdminInitiateAuthInput{
+		AuthFlow:   types.AuthFlowTypeRefreshTokenAuth,
+		ClientId:   aws.String(c.AppClientID),
+		UserPoolId: aws.String(c.UserPoolID),
+		AuthParameters: map[string]string{
+			"REFRESH_TOKEN": refreshToken,
+			"SECRET_HASH":   secretHash,
+		},
+	})
+	if err != nil {
+		return AuthResult{}, cognitoError("failed to refresh token", err)
+	}
+	if out.AuthenticationResult == nil {
+		return AuthResult{}, fmt.Errorf("%w: no tokens returned", ErrNotAuthorized)
+	}
+	return newAuthResult(out.AuthenticationResult, "", nil, nil)
+}
+
+func (c *CognitoClient) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	input := &cip.RevokeTokenInput{
+		ClientId: aws.String(c.AppClientID),
+		Token:    aws.String(refreshToken),
+	}
+	if c.ClientSecret != "" {
+		input.ClientSecret = aws.String(c.ClientSecret)
+	}
+	if _, err := c.Client.RevokeToken(ctx, input); err != nil {
+		return cognitoError("failed to revoke refresh token", err)
+	}
+	return nil
+}
+
+func (c *CognitoClient) SignOut(ctx context.Context, username string) error {
+	_, err := c.Client.AdminUserGlobalSignOut(ctx, &cip.AdminUserGlobalSignOutInput{
+		UserPoolId: aws.String(c.UserPoolID),
+		Username:   aws.String(username),
+	})
+	if err != nil {
+		return cognitoError("failed to sign out user", err)
+	}
+	return nil
+}
+
+func (c *CognitoClient) ForgotPassword(ctx context.Context, username string) error {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.ForgotPassword(ctx, &cip.ForgotPasswordInput{
+		ClientId:   aws.String(c.AppClientID),
+		Username:   aws.String(username),
+		SecretHash: aws.String(secretHash),
+	})
+	if err != nil {
+		return cognitoError("failed to request password reset", err)
+	}
+	return nil
+}
+
+func (c *CognitoClient) ConfirmForgotPassword(ctx context.Context, username, code, password string) error {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.ConfirmForgotPassword(ctx, &cip.ConfirmForgotPasswordInput{
 		ClientId:         aws.String(c.AppClientID),
-		Username:         aws.String(req.Username),
+		Username:         aws.String(username),
+		ConfirmationCode: aws.String(code),
+		Password:         aws.String(password),
 		SecretHash:       aws.String(secretHash),
-		ConfirmationCode: aws.String(req.ConfirmationCode),
 	})
 	if err != nil {
-		http.Error(w, "Failed to confirm signup", http.StatusInternalServerError)
-		log.Printf("Failed to confirm signup: %v", err)
-		return
+		return cognitoError("failed to confirm forgotten password", err)
+	}
+	return nil
+}
+
+func (c *CognitoClient) secretHash(username string) (string, error) {
+	secretHash, err := CalculateSecretHash(c.AppClientID, c.ClientSecret, username)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate secret hash: %w", err)
 	}
+	return secretHash, nil
+}
 
-	w.WriteHeader(http.StatusOK)
+// cognitoError wraps err with the provider-agnostic sentinel matching its
+// Cognito exception, if any.
+func cognitoError(message string, err error) error {
+	var (
+		notAuthorized   *types.NotAuthorizedException
+		userNotFound    *types.UserNotFoundException
+		codeMismatch    *types.CodeMismatchException
+		expiredCode     *types.ExpiredCodeException
+		enableMFA       *types.EnableSoftwareTokenMFAException
+		usernameExists  *types.UsernameExistsException
+		notConfirmed    *types.UserNotConfirmedException
+		invalidPassword *types.InvalidPasswordException
+		invalidParam    *types.InvalidParameterException
+		mfaNotFound     *types.SoftwareTokenMFANotFoundException
+	)
+	var sentinel error
+	switch {
+	case errors.As(err, &notAuthorized), errors.As(err, &userNotFound):
+		sentinel = ErrNotAuthorized
+	case errors.As(err, &codeMismatch), errors.As(err, &expiredCode), errors.As(err, &enableMFA):
+		sentinel = ErrCodeMismatch
+	case errors.As(err, &usernameExists):
+		sentinel = ErrUserExists
+	case errors.As(err, &notConfirmed):
+		sentinel = ErrUserNotConfirmed
+	case errors.As(err, &invalidPassword), errors.As(err, &invalidParam), errors.As(err, &mfaNotFound):
+		sentinel = ErrInvalidRequest
+	default:
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	return fmt.Errorf("%s: %w: %w", message, sentinel, err)
 }
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how often the signing keys are refetched
+	// in the background
+	DefaultJWKSRefreshInterval = time.Hour
+	// minUnknownKeyRefetch limits how often a token with an unknown key ID can
+	// trigger a refetch, so random key IDs can't hammer the JWKS host
+	minUnknownKeyRefetch = 30 * time.Second
+	// fetchTimeout bounds a synchronous fetch made while serving a request
+	fetchTimeout = 5 * time.Second
+)
+
+// ErrNoSigningKeys means the JWKS has never been fetched successfully, so no
+// token can be verified.
+var ErrNoSigningKeys = errors.New("signing keys unavailable")
+
+// JWKS caches a JSON Web Key Set, refreshing it in the background and when a
+// token is signed with a key it hasn't seen yet.
+type JWKS struct {
+	url   string
+	cache *jwk.Cache
+
+	mu          sync.Mutex
+	lastRefetch time.Time
+	now         func() time.Time
+}
+
+// NewJWKS registers url with a cache that refreshes every refreshInterval
+// until ctx is done. The first fetch is attempted right away, but a failure
+// is only logged; requests fail with ErrNoSigningKeys until keys load.
+func NewJWKS(ctx context.Context, url string, refreshInterval time.Duration) (*JWKS, error) {
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(url, jwk.WithRefreshInterval(refreshInterval)); err != nil {
+		return nil, fmt.Errorf("failed to register JWKS url: %w", err)
+	}
+
+	j := &JWKS{url: url, cache: cache, now: time.Now}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	if _, err := cache.Refresh(fetchCtx, url); err != nil {
+		log.Printf("Failed to load signing keys from %s: %v", url, err)
+	}
+	return j, nil
+}
+
+// KeySet returns the cached keys. If they have never loaded, a fetch is
+// attempted, at most once per minUnknownKeyRefetch.
+func (j *JWKS) KeySet(ctx context.Context) (jwk.Set, error) {
+	set, err := j.cache.Get(ctx, j.url)
+	if err == nil {
+		return set, nil
+	}
+	if set, refetchErr := j.refetch(ctx); refetchErr == nil {
+		return set, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNoSigningKeys, err)
+}
+
+// KeySetFor returns keys that include kid when possible. If the cached set
+// lacks kid the keys may have been rotated, so they are refetched, at most
+// once per minUnknownKeyRefetch. Callers still need to handle kid missing
+// from the returned set.
+func (j *JWKS) KeySetFor(ctx context.Context, kid string) (jwk.Set, error) {
+	set, err := j.KeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := set.LookupKeyID(kid); ok || kid == "" {
+		return set, nil
+	}
+
+	refreshed, err := j.refetch(ctx)
+	if err != nil {
+		// Keep serving the keys we have; the token will fail verification
+		return set, nil
+	}
+	return refreshed, nil
+}
+
+// errRefetchLimited means a refetch was skipped because one ran recently.
+var errRefetchLimited = errors.New("signing keys refetched recently")
+
+// refetch fetches the keys synchronously unless it already did so within
+// minUnknownKeyRefetch.
+func (j *JWKS) refetch(ctx context.Context) (jwk.Set, error) {
+	j.mu.Lock()
+	now := j.now()
+	if !j.lastRefetch.IsZero() && now.Sub(j.lastRefetch) < minUnknownKeyRefetch {
+		j.mu.Unlock()
+		return nil, errRefetchLimited
+	}
+	j.lastRefetch = now
+	j.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	set, err := j.cache.Refresh(ctx, j.url)
+	if err != nil {
+		log.Printf("Failed to refresh signing keys: %v", err)
+		return nil, err
+	}
+	return set, nil
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// jwksServer serves a key set that tests can rotate, counting fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	kids []string
+	down bool
+}
+
+func newJWKSServer(t *testing.T, kids ...string) *jwksServer {
+	t.Helper()
+	s := &jwksServer{kids: kids}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		set := jwk.NewSet()
+		for _, kid := range s.kids {
+			set.AddKey(testPublicKey(t, kid))
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKids(kids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kids = kids
+}
+
+func (s *jwksServer) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+var (
+	testKeysMu sync.Mutex
+	testKeys   = map[string]*rsa.PrivateKey{}
+)
+
+// testPrivateKey returns a stable RSA key for kid.
+func testPrivateKey(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	testKeysMu.Lock()
+	defer testKeysMu.Unlock()
+	if key, ok := testKeys[kid]; ok {
+		return key
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	testKeys[kid] = key
+	return key
+}
+
+func testPublicKey(t *testing.T, kid string) jwk.Key {
+	t.Helper()
+	key, err := jwk.FromRaw(testPrivateKey(t, kid).Public())
+	if err != nil {
+		t.Fatalf("Failed to create JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, kid)
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+	return key
+}
+
+func TestJWKSCachesKeys(t *testing.T) {
+	server := newJWKSServer(t, "a")
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		set, err := keys.KeySetFor(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := set.LookupKeyID("a"); !ok {
+			t.Fatalf("Expected key a in set")
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d", fetches)
+	}
+}
+
+func TestJWKSRefetchesUnknownKeyID(t *testing.T) {
+	server := newJWKSServer(t, "a")
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys.now = func() time.Time { return now }
+
+	// Keys are rotated: b is new and a is retired
+	server.setKids("b")
+	set, err := keys.KeySetFor(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := set.LookupKeyID("b"); !ok {
+		t.Fatalf("Expected the rotated key to be fetched")
+	}
+	if fetches := server.fetches.Load(); fetches != 2 {
+		t.Errorf("Expected 2 fetches, got %d", fetches)
+	}
+
+	// Unknown key IDs don't refetch again until the interval passes
+	keys.KeySetFor(context.Background(), "bogus")
+	if fetches := server.fetches.Load(); fetches != 2 {
+		t.Errorf("Expected refetch to be rate limited, got %d fetches", fetches)
+	}
+	now = now.Add(minUnknownKeyRefetch)
+	keys.KeySetFor(context.Background(), "bogus")
+	if fetches := server.fetches.Load(); fetches != 3 {
+		t.Errorf("Expected a refetch after the interval, got %d fetches", fetches)
+	}
+}
+
+func TestJWKSKeepsKeysWhenHostFails(t *testing.T) {
+	server := newJWKSServer(t, "a")
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+
+	server.setDown(true)
+	set, err := keys.KeySetFor(context.Background(), "new")
+	if err != nil {
+		t.Fatalf("Expected cached keys while the host is down, got %v", err)
+	}
+	if _, ok := set.LookupKeyID("a"); !ok {
+		t.Errorf("Expected the cached key to still be served")
+	}
+}
+
+func TestJWKSNoKeysEverLoaded(t *testing.T) {
+	server := newJWKSServer(t, "a")
+	server.setDown(true)
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys.now = func() time.Time { return now }
+
+	if _, err := keys.KeySetFor(context.Background(), "a"); !errors.Is(err, ErrNoSigningKeys) {
+		t.Errorf("Expected ErrNoSigningKeys, got %v", err)
+	}
+
+	// Keys load once the host recovers and the refetch interval has passed
+	server.setDown(false)
+	if _, err := keys.KeySetFor(context.Background(), "a"); !errors.Is(err, ErrNoSigningKeys) {
+		t.Errorf("Expected refetch to be rate limited, got %v", err)
+	}
+	now = now.Add(minUnknownKeyRefetch)
+	if _, err := keys.KeySetFor(context.Background(), "a"); err != nil {
+		t.Errorf("Expected keys after the host recovered, got %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// memoryTokenTTL is how long MemoryProvider access and ID tokens last
+	memoryTokenTTL = time.Hour
+	// memoryKeyID is the kid of the MemoryProvider signing key
+	memoryKeyID = "memory"
+	// minPasswordLength matches the Cognito default password policy
+	minPasswordLength = 8
+)
+
+// MemoryProvider is an IdentityProvider that keeps accounts in memory and
+// signs its own tokens, for local development and tests without AWS.
+// Accounts are lost on restart and MFA is not supported.
+type MemoryProvider struct {
+	issuer   string
+	clientID string
+	// sendCode delivers confirmation and password reset codes
+	sendCode func(username, code string)
+
+	key    jwk.Key
+	public jwk.Set
+	now    func() time.Time
+
+	mu            sync.Mutex
+	users         map[string]*memoryUser
+	refreshTokens map[string]string
+}
+
+type memoryUser struct {
+	sub              string
+	passwordHash     []byte
+	attributes       map[string]string
+	confirmed        bool
+	confirmationCode string
+	resetCode        string
+}
+
+// NewMemoryProvider returns an empty provider whose access tokens carry iss
+// and client_id claims of issuer and clientID. Codes are passed to sendCode,
+// or logged when it's nil.
+func NewMemoryProvider(issuer, clientID string, sendCode func(username, code string)) (*MemoryProvider, error) {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	key.Set(jwk.KeyIDKey, memoryKeyID)
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create public key: %w", err)
+	}
+	public := jwk.NewSet()
+	public.AddKey(publicKey)
+
+	if sendCode == nil {
+		sendCode = func(username, code string) {
+			log.Printf("Verification code for %s: %s", username, code)
+		}
+	}
+	return &MemoryProvider{
+		issuer:        issuer,
+		clientID:      clientID,
+		sendCode:      sendCode,
+		key:           key,
+		public:        public,
+		now:           time.Now,
+		users:         map[string]*memoryUser{},
+		refreshTokens: map[string]string{},
+	}, nil
+}
+
+// KeySetFor returns the provider's public key so a TokenValidator can check
+// the tokens it issues.
+func (p *MemoryProvider) KeySetFor(ctx context.Context, kid string) (jwk.Set, error) {
+	return p.public, nil
+}
+
+func (p *MemoryProvider) SignUp(ctx context.Context, email, firstName, lastName, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidRequest, minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	sub, err := newSub()
+	if err != nil {
+		return err
+	}
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	username := strings.ToLower(email)
+	if _, ok := p.users[username]; ok {
+		return ErrUserExists
+	}
+	p.users[username] = &memoryUser{
+		sub:          sub,
+		passwordHash: hash,
+		attributes: map[string]string{
+			"sub":            sub,
+			"email":          email,
+			"email_verified": "false",
+			"name":           firstName,
+			"family_name":    lastName,
+		},
+		confirmationCode: code,
+	}
+	p.sendCode(email, code)
+	return nil
+}
+
+func (p *MemoryProvider) ConfirmSignUp(ctx context.Context, username, code string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok {
+		return ErrNotAuthorized
+	}
+	if user.confirmed {
+		return nil
+	}
+	if code == "" || code != user.confirmationCode {
+		return ErrCodeMismatch
+	}
+	// The code was sent to the email, so confirming proves the address
+	user.confirmed = true
+	user.attributes["email_verified"] = "true"
+	user.confirmationCode = ""
+	return nil
+}
+
+func (p *MemoryProvider) ResendConfirmationCode(ctx context.Context, username string) error {
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok {
+		return ErrNotAuthorized
+	}
+	if user.confirmed {
+		return fmt.Errorf("%w: user is already confirmed", ErrInvalidRequest)
+	}
+	user.confirmationCode = code
+	p.sendCode(user.attributes["email"], code)
+	return nil
+}
+
+// SignIn never returns a challenge.
+func (p *MemoryProvider) SignIn(ctx context.Context, username, password string) (AuthResult, error) {
+	refreshToken, err := newToken()
+	if err != nil {
+		return AuthResult{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok || bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)) != nil {
+		return AuthResult{}, fmt.Errorf("%w: incorrect username or password", ErrNotAuthorized)
+	}
+	if !user.confirmed {
+		return AuthResult{}, ErrUserNotConfirmed
+	}
+
+	tokens, err := p.issue(user)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	tokens.RefreshToken = refreshToken
+	p.refreshTokens[refreshToken] = user.sub
+	return AuthResult{Tokens: tokens}, nil
+}
+
+// RespondToChallenge always fails since SignIn never issues a challenge.
+func (p *MemoryProvider) RespondToChallenge(ctx context.Context, response ChallengeResponse) (AuthResult, error) {
+	return AuthResult{}, fmt.Errorf("%w: no challenge is pending", ErrNotAuthorized)
+}
+
+func (p *MemoryProvider) Refresh(ctx context.Context, username, refreshToken string) (AuthResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok || p.refreshTokens[refreshToken] != user.sub {
+		return AuthResult{}, fmt.Errorf("%w: invalid refresh token", ErrNotAuthorized)
+	}
+	tokens, err := p.issue(user)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	return AuthResult{Tokens: tokens}, nil
+}
+
+func (p *MemoryProvider) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.refreshTokens, refreshToken)
+	return nil
+}
+
+// SignOut revokes the user's refresh tokens. Access tokens already issued
+// stay valid until they expire.
+func (p *MemoryProvider) SignOut(ctx context.Context, username string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok {
+		return ErrNotAuthorized
+	}
+	for token, sub := range p.refreshTokens {
+		if sub == user.sub {
+			delete(p.refreshTokens, token)
+		}
+	}
+	return nil
+}
+
+// ForgotPassword sends a reset code. Unknown usernames succeed silently so
+// the endpoint doesn't reveal which accounts exist.
+func (p *MemoryProvider) ForgotPassword(ctx context.Context, username string) error {
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if user, ok := p.lookup(username); ok {
+		user.resetCode = code
+		p.sendCode(user.attributes["email"], code)
+	}
+	return nil
+}
+
+func (p *MemoryProvider) ConfirmForgotPassword(ctx context.Context, username, code, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidRequest, minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok || code == "" || code != user.resetCode {
+		return ErrCodeMismatch
+	}
+	user.passwordHash = hash
+	user.resetCode = ""
+	return nil
+}
+
+func (p *MemoryProvider) GetUserAttributes(ctx context.Context, username string) (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.lookup(username)
+	if !ok {
+		return nil, fmt.Errorf("%w: user not found", ErrNotAuthorized)
+	}
+	attributes := make(map[string]string, len(user.attributes))
+	for name, value := range user.attributes {
+		attributes[name] = value
+	}
+	return attributes, nil
+}
+
+// lookup finds a user by email or sub. p.mu must be held.
+func (p *MemoryProvider) lookup(username string) (*memoryUser, bool) {
+	if user, ok := p.users[strings.ToLower(username)]; ok {
+		return user, true
+	}
+	for _, user := range p.users {
+		if user.sub == username {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+// issue signs access and ID tokens shaped like Cognito's, with the sub as
+// the username claim.
+func (p *MemoryProvider) issue(user *memoryUser) (*Tokens, error) {
+	now := p.now()
+	access := map[string]any{
+		jwt.IssuerKey:     p.issuer,
+		jwt.SubjectKey:    user.sub,
+		jwt.IssuedAtKey:   now,
+		jwt.ExpirationKey: now.Add(memoryTokenTTL),
+		"client_id":       p.clientID,
+		"token_use":       "access",
+		"username":        user.sub,
+		"scope":           "aws.cognito.signin.user.admin",
+	}
+	id := map[string]any{
+		jwt.IssuerKey:      p.issuer,
+		jwt.SubjectKey:     user.sub,
+		jwt.AudienceKey:    p.clientID,
+		jwt.IssuedAtKey:    now,
+		jwt.ExpirationKey:  now.Add(memoryTokenTTL),
+		"token_use":        "id",
+		"cognito:username": user.sub,
+		"email":            user.attributes["email"],
+		"email_verified":   user.attributes["email_verified"] == "true",
+		"name":             user.attributes["name"],
+		"family_name":      user.attributes["family_name"],
+	}
+
+	accessToken, err := p.sign(access)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := p.sign(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken: accessToken,
+		IDToken:     idToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int32(memoryTokenTTL / time.Second),
+	}, nil
+}
+
+func (p *MemoryProvider) sign(claims map[string]any) (string, error) {
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			return "", fmt.Errorf("failed to set claim %s: %w", name, err)
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, p.key))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return string(signed), nil
+}
+
+// newSub returns a random UUID, the format Cognito uses for sub.
+func newSub() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate sub: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// newCode returns a random six digit code.
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
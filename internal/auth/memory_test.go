@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+func TestMemoryProvider(t *testing.T) {
+	ctx := context.Background()
+	codes := map[string]string{}
+	provider, err := NewMemoryProvider("local", "client", func(username, code string) {
+		codes[username] = code
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	if err := provider.SignUp(ctx, "Pat@example.com", "Pat", "Lee", "short"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for a short password, got %v", err)
+	}
+	if err := provider.SignUp(ctx, "Pat@example.com", "Pat", "Lee", "correct-horse"); err != nil {
+		t.Fatalf("Failed to sign up: %v", err)
+	}
+	if err := provider.SignUp(ctx, "pat@example.com", "Pat", "Lee", "correct-horse"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for a taken email, got %v", err)
+	}
+	if _, err := provider.SignIn(ctx, "pat@example.com", "correct-horse"); !errors.Is(err, ErrUserNotConfirmed) {
+		t.Errorf("Expected ErrUserNotConfirmed before confirming, got %v", err)
+	}
+	if _, err := VerifiedEmail(ctx, provider, "pat@example.com"); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Expected ErrEmailNotVerified before confirming, got %v", err)
+	}
+	if err := provider.ConfirmSignUp(ctx, "pat@example.com", "nope"); !errors.Is(err, ErrCodeMismatch) {
+		t.Errorf("Expected ErrCodeMismatch for a wrong code, got %v", err)
+	}
+	if err := provider.ConfirmSignUp(ctx, "pat@example.com", codes["Pat@example.com"]); err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+
+	if _, err := provider.SignIn(ctx, "pat@example.com", "wrong-horse"); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected ErrNotAuthorized for a wrong password, got %v", err)
+	}
+	result, err := provider.SignIn(ctx, "pat@example.com", "correct-horse")
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("Expected tokens, got %+v, %v", result, err)
+	}
+
+	attributes, err := provider.GetUserAttributes(ctx, "pat@example.com")
+	if err != nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	sub := attributes["sub"]
+	if attributes["name"] != "Pat" || attributes["family_name"] != "Lee" || sub == "" {
+		t.Errorf("Unexpected attributes %v", attributes)
+	}
+	if email, err := VerifiedEmail(ctx, provider, sub); err != nil || email != "Pat@example.com" {
+		t.Errorf("Expected the confirmed email, got %q, %v", email, err)
+	}
+
+	// Refresh and sign-out accept the sub, which is what the cookie holds
+	if _, err := provider.Refresh(ctx, sub, result.Tokens.RefreshToken); err != nil {
+		t.Errorf("Failed to refresh: %v", err)
+	}
+	if _, err := provider.Refresh(ctx, sub, "other"); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected ErrNotAuthorized for an unknown refresh token, got %v", err)
+	}
+	second, err := provider.SignIn(ctx, "pat@example.com", "correct-horse")
+	if err != nil {
+		t.Fatalf("Failed to sign in again: %v", err)
+	}
+	if err := provider.RevokeRefreshToken(ctx, second.Tokens.RefreshToken); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, err := provider.Refresh(ctx, sub, second.Tokens.RefreshToken); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected the revoked refresh token to be refused, got %v", err)
+	}
+	if _, err := provider.Refresh(ctx, sub, result.Tokens.RefreshToken); err != nil {
+		t.Errorf("Expected other sessions to survive revoking one, got %v", err)
+	}
+	if err := provider.SignOut(ctx, sub); err != nil {
+		t.Fatalf("Failed to sign out: %v", err)
+	}
+	if _, err := provider.Refresh(ctx, sub, result.Tokens.RefreshToken); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected sign-out to revoke the refresh token, got %v", err)
+	}
+}
+
+func TestCognitoError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"bad password", &types.NotAuthorizedException{}, ErrNotAuthorized},
+		{"wrong code", &types.CodeMismatchException{}, ErrCodeMismatch},
+		{"expired code", &types.ExpiredCodeException{}, ErrCodeMismatch},
+		{"taken username", &types.UsernameExistsException{}, ErrUserExists},
+		{"unconfirmed", &types.UserNotConfirmedException{}, ErrUserNotConfirmed},
+		{"weak password", &types.InvalidPasswordException{}, ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cognitoError("failed", fmt.Errorf("operation error: %w", tt.err))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected the Cognito error to stay wrapped, got %v", err)
+			}
+		})
+	}
+
+	err := cognitoError("failed", errors.New("network down"))
+	for _, sentinel := range []error{ErrNotAuthorized, ErrCodeMismatch, ErrInvalidRequest} {
+		if errors.Is(err, sentinel) {
+			t.Errorf("Expected an unknown error to match no sentinel, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cip "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// Tokens are the credentials issued once authentication completes.
+type Tokens struct {
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+	TokenType    string
+	ExpiresIn    int32
+}
+
+// Challenge is a further step the provider requires before issuing tokens, such
+// as SOFTWARE_TOKEN_MFA or NEW_PASSWORD_REQUIRED. Session must be sent back
+// with the response.
+type Challenge struct {
+	Name       string
+	Session    string
+	Parameters map[string]string
+}
+
+// AuthResult holds exactly one of Tokens or Challenge.
+type AuthResult struct {
+	Tokens    *Tokens
+	Challenge *Challenge
+}
+
+// ChallengeResponse answers a Challenge. Code is used for SOFTWARE_TOKEN_MFA
+// and SMS_MFA, NewPassword for NEW_PASSWORD_REQUIRED and MFAType for
+// SELECT_MFA_TYPE. MFA_SETUP only needs the session returned by
+// VerifySoftwareToken.
+type ChallengeResponse struct {
+	Name        string
+	Session     string
+	Username    string
+	Code        string
+	NewPassword string
+	MFAType     string
+}
+
+// SignIn starts a password sign-in. The result carries a challenge when the
+// user has MFA enabled or must set a new password.
+func (c *CognitoClient) SignIn(ctx context.Context, username, password string) (AuthResult, error) {
+	secretHash, err := c.secretHash(username)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	out, err := c.Client.AdminInitiateAuth(ctx, &cip.AdminInitiateAuthInput{
+		AuthFlow:   types.AuthFlowTypeAdminUserPasswordAuth,
+		ClientId:   aws.String(c.AppClientID),
+		UserPoolId: aws.String(c.UserPoolID),
+		AuthParameters: map[string]string{
+			"USERNAME":    username,
+			"PASSWORD":    password,
+			"SECRET_HASH": secretHash,
+		},
+	})
+	if err != nil {
+		return AuthResult{}, cognitoError("failed to authenticate user", err)
+	}
+	return newAuthResult(out.AuthenticationResult, out.ChallengeName, out.Session, out.ChallengeParameters)
+}
+
+// RespondToChallenge answers a challenge returned by SignIn or a previous
+// RespondToChallenge, which may lead to another challenge.
+func (c *CognitoClient) RespondToChallenge(ctx context.Context, response ChallengeResponse) (AuthResult, error) {
+	secretHash, err := c.secretHash(response.Username)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	responses, err := challengeResponses(response, secretHash)
+	if err != nil {
+		return AuthResult{}, err
+	}
+	out, err := c.Client.AdminRespondToAuthChallenge(ctx, &cip.AdminRespondToAuthChallengeInput{
+		ChallengeName:      types.ChallengeNameType(response.Name),
+		ClientId:           aws.String(c.AppClientID),
+		UserPoolId:         aws.String(c.UserPoolID),
+		Session:            aws.String(response.Session),
+		ChallengeResponses: responses,
+	})
+	if err != nil {
+		return AuthResult{}, cognitoError("failed to respond to challenge", err)
+	}
+	return newAuthResult(out.AuthenticationResult, out.ChallengeName, out.Session, out.ChallengeParameters)
+}
+
+// AssociateSoftwareToken starts TOTP enrollment for a signed-in user (by
+// access token) or one answering an MFA_SETUP challenge (by session). It
+// returns the shared secret and the session to pass to VerifySoftwareToken.
+func (c *CognitoClient) AssociateSoftwareToken(ctx context.Context, accessToken, session string) (string, string, error) {
+	input := &cip.AssociateSoftwareTokenInput{}
+	if accessToken != "" {
+		input.AccessToken = aws.String(accessToken)
+	} else {
+		input.Session = aws.String(session)
+	}
+	out, err := c.Client.AssociateSoftwareToken(ctx, input)
+	if err != nil {
+		return "", "", cognitoError("failed to associate software token", err)
+	}
+	return aws.ToString(out.SecretCode), aws.ToString(out.Session), nil
+}
+
+// VerifySoftwareToken checks the first code from a newly associated
+// authenticator and returns the session for completing MFA_SETUP.
+func (c *CognitoClient) VerifySoftwareToken(ctx context.Context, accessToken, session, code, deviceName string) (string, error) {
+	input := &cip.VerifySoftwareTokenInput{UserCode: aws.String(code)}
+	if accessToken != "" {
+		input.AccessToken = aws.String(accessToken)
+	} else {
+		input.Session = aws.String(session)
+	}
+	if deviceName != "" {
+		input.FriendlyDeviceName = aws.String(deviceName)
+	}
+	out, err := c.Client.VerifySoftwareToken(ctx, input)
+	if err != nil {
+		return "", cognitoError("failed to verify software token", err)
+	}
+	if out.Status != types.VerifySoftwareTokenResponseTypeSuccess {
+		return "", ErrCodeMismatch
+	}
+	return aws.ToString(out.Session), nil
+}
+
+// EnableSoftwareTokenMFA makes TOTP the signed-in user's preferred MFA.
+func (c *CognitoClient) EnableSoftwareTokenMFA(ctx context.Context, accessToken string) error {
+	_, err := c.Client.SetUserMFAPreference(ctx, &cip.SetUserMFAPreferenceInput{
+		AccessToken: aws.String(accessToken),
+		SoftwareTokenMfaSettings: &types.SoftwareTokenMfaSettingsType{
+			Enabled:      true,
+			PreferredMfa: true,
+		},
+	})
+	if err != nil {
+		return cognitoError("failed to set MFA preference", err)
+	}
+	return nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps read from a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// challengeResponses builds the ChallengeResponses map Cognito expects for
+// response.Name.
+func challengeResponses(response ChallengeResponse, secretHash string) (map[string]string, error) {
+	responses := map[string]string{
+		"USERNAME":    response.Username,
+		"SECRET_HASH": secretHash,
+	}
+	var key, value string
+	switch types.ChallengeNameType(response.Name) {
+	case types.ChallengeNameTypeSoftwareTokenMfa:
+		key, value = "SOFTWARE_TOKEN_MFA_CODE", response.Code
+	case types.ChallengeNameTypeSmsMfa:
+		key, value = "SMS_MFA_CODE", response.Code
+	case types.ChallengeNameTypeNewPasswordRequired:
+		key, value = "NEW_PASSWORD", response.NewPassword
+	case types.ChallengeNameTypeSelectMfaType:
+		key, value = "ANSWER", response.MFAType
+	case types.ChallengeNameTypeMfaSetup:
+		return responses, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported challenge %q", ErrInvalidRequest, response.Name)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%w: challenge %s requires %s", ErrInvalidRequest, response.Name, key)
+	}
+	responses[key] = value
+	return responses, nil
+}
+
+func newAuthResult(
+	result *types.AuthenticationResultType,
+	challenge types.ChallengeNameType,
+	session *string,
+	parameters map[string]string,
+) (AuthResult, error) {
+	if result != nil {
+		return AuthResult{Tokens: &Tokens{
+			AccessToken:  aws.ToString(result.AccessToken),
+			IDToken:      aws.ToString(result.IdToken),
+			RefreshToken: aws.ToString(result.RefreshToken),
+			TokenType:    aws.ToString(result.TokenType),
+			ExpiresIn:    result.ExpiresIn,
+		}}, nil
+	}
+	if challenge == "" {
+		return AuthResult{}, errors.New("authentication returned neither tokens nor a challenge")
+	}
+	return AuthResult{Challenge: &Challenge{
+		Name:       string(challenge),
+		Session:    aws.ToString(session),
+		Parameters: parameters,
+	}}, nil
+}
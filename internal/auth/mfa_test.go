@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+func TestChallengeResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response ChallengeResponse
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			"totp code",
+			ChallengeResponse{Name: "SOFTWARE_TOKEN_MFA", Username: "a@b.c", Code: "123456"},
+			map[string]string{"USERNAME": "a@b.c", "SECRET_HASH": "hash", "SOFTWARE_TOKEN_MFA_CODE": "123456"},
+			false,
+		},
+		{
+			"sms code",
+			ChallengeResponse{Name: "SMS_MFA", Username: "a@b.c", Code: "654321"},
+			map[string]string{"USERNAME": "a@b.c", "SECRET_HASH": "hash", "SMS_MFA_CODE": "654321"},
+			false,
+		},
+		{
+			"new password",
+			ChallengeResponse{Name: "NEW_PASSWORD_REQUIRED", Username: "a@b.c", NewPassword: "n3w-Password"},
+			map[string]string{"USERNAME": "a@b.c", "SECRET_HASH": "hash", "NEW_PASSWORD": "n3w-Password"},
+			false,
+		},
+		{
+			"select mfa type",
+			ChallengeResponse{Name: "SELECT_MFA_TYPE", Username: "a@b.c", MFAType: "SOFTWARE_TOKEN_MFA"},
+			map[string]string{"USERNAME": "a@b.c", "SECRET_HASH": "hash", "ANSWER": "SOFTWARE_TOKEN_MFA"},
+			false,
+		},
+		{
+			"mfa setup needs only the session",
+			ChallengeResponse{Name: "MFA_SETUP", Username: "a@b.c"},
+			map[string]string{"USERNAME": "a@b.c", "SECRET_HASH": "hash"},
+			false,
+		},
+		{"missing code", ChallengeResponse{Name: "SOFTWARE_TOKEN_MFA", Username: "a@b.c"}, nil, true},
+		{"unsupported challenge", ChallengeResponse{Name: "CUSTOM_CHALLENGE", Username: "a@b.c"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := challengeResponses(tt.response, "hash")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewAuthResult(t *testing.T) {
+	result, err := newAuthResult(&types.AuthenticationResultType{
+		AccessToken:  aws.String("access"),
+		IdToken:      aws.String("id"),
+		RefreshToken: aws.String("refresh"),
+		TokenType:    aws.String("Bearer"),
+		ExpiresIn:    3600,
+	}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := &Tokens{AccessToken: "access", IDToken: "id", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 3600}
+	if result.Challenge != nil || !reflect.DeepEqual(result.Tokens, want) {
+		t.Errorf("Expected tokens %+v, got %+v", want, result)
+	}
+
+	params := map[string]string{"USER_ID_FOR_SRP": "user-1"}
+	result, err = newAuthResult(nil, types.ChallengeNameTypeSoftwareTokenMfa, aws.String("session"), params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantChallenge := &Challenge{Name: "SOFTWARE_TOKEN_MFA", Session: "session", Parameters: params}
+	if result.Tokens != nil || !reflect.DeepEqual(result.Challenge, wantChallenge) {
+		t.Errorf("Expected challenge %+v, got %+v", wantChallenge, result)
+	}
+
+	if _, err := newAuthResult(nil, "", nil, nil); err == nil {
+		t.Error("Expected an error when Cognito returns neither tokens nor a challenge")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := TOTPURI("Health Trackers", "a@b.c", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Health%20Trackers:a@b.c?issuer=Health+Trackers&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exchangeTimeout bounds a call to the token endpoint
+const exchangeTimeout = 10 * time.Second
+
+// OAuthProviders maps the provider names clients may ask for to the
+// identity_provider names configured in the user pool.
+var OAuthProviders = map[string]string{
+	"google": "Google",
+	"apple":  "SignInWithApple",
+}
+
+// OAuthClient runs the authorization code flow with PKCE against the Cognito
+// hosted UI, which federates to Google, Apple and other identity providers.
+type OAuthClient struct {
+	// Domain is the hosted UI base URL, e.g. https://auth.example.com
+	Domain       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the app client
+	RedirectURL string
+	HTTPClient  *http.Client
+}
+
+// PKCE is a code verifier and its S256 challenge. The challenge goes in the
+// authorization URL; the verifier is only sent with the token exchange.
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE returns a random verifier and its challenge.
+func NewPKCE() (PKCE, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return PKCE{}, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return PKCE{Verifier: verifier, Challenge: base64.RawURLEncoding.EncodeToString(sum[:])}, nil
+}
+
+// NewState returns a random value for the state or nonce parameter.
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+// AuthorizeURL returns the hosted UI URL that starts sign-in with provider,
+// an identity_provider name from OAuthProviders.
+func (o *OAuthClient) AuthorizeURL(provider, state, nonce, challenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", o.ClientID)
+	query.Set("redirect_uri", o.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("identity_provider", provider)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	return strings.TrimSuffix(o.Domain, "/") + "/oauth2/authorize?" + query.Encode()
+}
+
+// Exchange trades an authorization code for tokens at the token endpoint.
+// A rejected code or verifier wraps ErrNotAuthorized.
+func (o *OAuthClient) Exchange(ctx context.Context, code, verifier string) (Tokens, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("client_id", o.ClientID)
+	form.Set("code", code)
+	form.Set("redirect_uri", o.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	ctx, cancel := context.WithTimeout(ctx, exchangeTimeout)
+	defer cancel()
+	endpoint := strings.TrimSuffix(o.Domain, "/") + "/oauth2/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if o.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int32  `json:"expires_in"`
+		Error        string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Tokens{}, fmt.Errorf("failed to parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if payload.Error == "invalid_grant" || payload.Error == "unauthorized_client" {
+			return Tokens{}, fmt.Errorf("%w: %s", ErrNotAuthorized, payload.Error)
+		}
+		return Tokens{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, payload.Error)
+	}
+	if payload.IDToken == "" || payload.AccessToken == "" {
+		return Tokens{}, errors.New("token response is missing tokens")
+	}
+	return Tokens{
+		AccessToken:  payload.AccessToken,
+		IDToken:      payload.IDToken,
+		RefreshToken: payload.RefreshToken,
+		TokenType:    payload.TokenType,
+		ExpiresIn:    payload.ExpiresIn,
+	}, nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
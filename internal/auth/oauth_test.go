@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNewPKCE(t *testing.T) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Failed to create PKCE: %v", err)
+	}
+	sum := sha256.Sum256([]byte(pkce.Verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); pkce.Challenge != want {
+		t.Errorf("Expected challenge %s, got %s", want, pkce.Challenge)
+	}
+	if len(pkce.Verifier) < 43 {
+		t.Errorf("Expected a verifier of at least 43 characters, got %d", len(pkce.Verifier))
+	}
+}
+
+func TestOAuthClientAuthorizeURL(t *testing.T) {
+	client := &OAuthClient{Domain: "https://auth.example.com/", ClientID: "client", RedirectURL: "https://api.example.com/cb"}
+	got, err := url.Parse(client.AuthorizeURL("Google", "state-1", "nonce-1", "challenge-1"))
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	if got.Host != "auth.example.com" || got.Path != "/oauth2/authorize" {
+		t.Errorf("Unexpected endpoint %s", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "https://api.example.com/cb",
+		"identity_provider":     "Google",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got.Query().Get(name) != value {
+			t.Errorf("Expected %s=%s, got %q", name, value, got.Query().Get(name))
+		}
+	}
+}
+
+func TestOAuthClientExchange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.URL.Path != "/oauth2/token" || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "a", "id_token": "i", "refresh_token": "r", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+	client := &OAuthClient{Domain: server.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "https://api.example.com/cb"}
+
+	tokens, err := client.Exchange(context.Background(), "good-code", "verifier")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tokens.AccessToken != "a" || tokens.IDToken != "i" || tokens.RefreshToken != "r" || tokens.ExpiresIn != 3600 {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	if _, err := client.Exchange(context.Background(), "good-code", "wrong-verifier"); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected ErrNotAuthorized for a wrong verifier, got %v", err)
+	}
+	client.ClientSecret = "wrong"
+	if _, err := client.Exchange(context.Background(), "good-code", "verifier"); err == nil || errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Expected a configuration error for a wrong client secret, got %v", err)
+	}
+}
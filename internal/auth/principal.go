@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Principal is the caller identified by a verified access token.
+type Principal struct {
+	// Sub is the token subject, the user's stable Cognito ID
+	Sub string
+	// Username is the Cognito username; local users rows are keyed by it
+	Username string
+	// Email is only set when the token carries an email claim
+	Email string
+	// EmailVerified is the ID token's email_verified claim
+	EmailVerified bool
+	Groups        []string
+	Scopes        []string
+}
+
+type principalKey struct{}
+
+// PrincipalFromToken reads the caller's identity from a verified token.
+func PrincipalFromToken(token jwt.Token) Principal {
+	claims := token.PrivateClaims()
+	principal := Principal{Sub: token.Subject()}
+	principal.Username, _ = claims["username"].(string)
+	if principal.Username == "" {
+		// ID tokens name the user in cognito:username instead
+		principal.Username, _ = claims["cognito:username"].(string)
+	}
+	principal.Email, _ = claims["email"].(string)
+	// Federated users can get the claim as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		principal.EmailVerified = verified
+	case string:
+		principal.EmailVerified = verified == "true"
+	}
+	if groups, ok := claims["cognito:groups"].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				principal.Groups = append(principal.Groups, name)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	}
+	return principal
+}
+
+// WithPrincipal returns a copy of ctx carrying principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored in ctx by WithPrincipal.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func TestPrincipalFromToken(t *testing.T) {
+	token, err := jwt.NewBuilder().
+		Subject("0f1e2d3c").
+		Claim("username", "test-user").
+		Claim("cognito:groups", []interface{}{"clinician", "admin"}).
+		Claim("scope", "aws.cognito.signin.user.admin openid").
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to build token: %v", err)
+	}
+
+	got := PrincipalFromToken(token)
+	want := Principal{
+		Sub:      "0f1e2d3c",
+		Username: "test-user",
+		Groups:   []string{"clinician", "admin"},
+		Scopes:   []string{"aws.cognito.signin.user.admin", "openid"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPrincipalFromTokenEmailVerified(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  bool
+	}{
+		{"bool", true, true},
+		{"string", "true", true},
+		{"false string", "false", false},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := jwt.NewBuilder().Subject("0f1e2d3c").Claim("email", "pat@example.com")
+			if tt.claim != nil {
+				builder = builder.Claim("email_verified", tt.claim)
+			}
+			token, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to build token: %v", err)
+			}
+			if got := PrincipalFromToken(token).EmailVerified; got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if _, ok := PrincipalFrom(context.Background()); ok {
+		t.Errorf("Expected no principal in an empty context")
+	}
+
+	ctx := WithPrincipal(context.Background(), Principal{Username: "test-user"})
+	principal, ok := PrincipalFrom(ctx)
+	if !ok || principal.Username != "test-user" {
+		t.Errorf("Expected stored principal, got %+v", principal)
+	}
+}
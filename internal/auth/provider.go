@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNotAuthorized means the credentials, refresh token or challenge
+	// session were rejected.
+	ErrNotAuthorized = errors.New("not authorized")
+	// ErrCodeMismatch means a confirmation, reset or MFA code was wrong or
+	// has expired.
+	ErrCodeMismatch = errors.New("verification code mismatch")
+	// ErrUserExists means sign-up used a username that's already taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotConfirmed means the user hasn't confirmed their sign-up code.
+	ErrUserNotConfirmed = errors.New("user not confirmed")
+	// ErrInvalidRequest means the provider refused the input, such as a
+	// password that doesn't meet the policy.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrEmailNotVerified means the user hasn't proven they own their email
+	// address.
+	ErrEmailNotVerified = errors.New("email not verified")
+)
+
+// IdentityProvider manages accounts and issues tokens for the
+// /aws-cognito routes. Usernames are email addresses; calls made on behalf
+// of a signed-in user also accept the sub claim. Errors wrap the sentinel
+// errors above so callers don't depend on the provider.
+type IdentityProvider interface {
+	SignUp(ctx context.Context, email, firstName, lastName, password string) error
+	ConfirmSignUp(ctx context.Context, username, code string) error
+	ResendConfirmationCode(ctx context.Context, username string) error
+
+	SignIn(ctx context.Context, username, password string) (AuthResult, error)
+	RespondToChallenge(ctx context.Context, response ChallengeResponse) (AuthResult, error)
+	// Refresh exchanges a refresh token for new access and ID tokens. The
+	// result carries no refresh token; the old one stays valid.
+	Refresh(ctx context.Context, username, refreshToken string) (AuthResult, error)
+	// RevokeRefreshToken signs out the one session refreshToken belongs to.
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+	// SignOut revokes every refresh token issued to the user.
+	SignOut(ctx context.Context, username string) error
+
+	ForgotPassword(ctx context.Context, username string) error
+	ConfirmForgotPassword(ctx context.Context, username, code, password string) error
+
+	// GetUserAttributes returns attributes such as "email", "name" (first
+	// name) and "family_name".
+	GetUserAttributes(ctx context.Context, username string) (map[string]string, error)
+}
+
+// SoftwareTokenMFA is implemented by providers that support authenticator
+// app (TOTP) enrollment.
+type SoftwareTokenMFA interface {
+	AssociateSoftwareToken(ctx context.Context, accessToken, session string) (string, string, error)
+	VerifySoftwareToken(ctx context.Context, accessToken, session, code, deviceName string) (string, error)
+	EnableSoftwareTokenMFA(ctx context.Context, accessToken string) error
+}
+
+// VerifiedEmail returns the user's email address if the identity provider
+// has verified it, and ErrEmailNotVerified otherwise.
+func VerifiedEmail(ctx context.Context, p IdentityProvider, username string) (string, error) {
+	attributes, err := p.GetUserAttributes(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if attributes["email"] == "" || attributes["email_verified"] != "true" {
+		return "", ErrEmailNotVerified
+	}
+	return attributes["email"], nil
+}
+
+var (
+	_ IdentityProvider = (*CognitoClient)(nil)
+	_ SoftwareTokenMFA = (*CognitoClient)(nil)
+	_ IdentityProvider = (*MemoryProvider)(nil)
+)
@@ -0,0 +1,47 @@
+package auth
+
+// Role is what a caller is allowed to do. Roles other than RoleUser come from
+// Cognito groups of the same name.
+type Role string
+
+const (
+	// RoleUser is every signed-in caller; it only grants access to their
+	// own data
+	RoleUser Role = "user"
+	// RoleAdmin can do everything the other roles can
+	RoleAdmin Role = "admin"
+)
+
+// knownRoles are the Cognito groups that map to a role; other groups are
+// ignored.
+var knownRoles = map[string]Role{
+	string(RoleAdmin): RoleAdmin,
+}
+
+// Roles returns the principal's roles: RoleUser plus one per recognized
+// Cognito group.
+func (p Principal) Roles() []Role {
+	roles := []Role{RoleUser}
+	for _, group := range p.Groups {
+		if role, ok := knownRoles[group]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// HasRole reports whether the principal holds any of roles. Admins hold
+// every role.
+func (p Principal) HasRole(roles ...Role) bool {
+	for _, held := range p.Roles() {
+		if held == RoleAdmin {
+			return true
+		}
+		for _, role := range roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrincipalRoles(t *testing.T) {
+	principal := Principal{Groups: []string{"support", "us-east-1_test_Google", "admin"}}
+	want := []Role{RoleUser, RoleAdmin}
+	if got := principal.Roles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestPrincipalHasRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		roles  []Role
+		want   bool
+	}{
+		{"everyone is a user", nil, []Role{RoleUser}, true},
+		{"plain user", nil, []Role{RoleAdmin}, false},
+		{"matching group", []string{"admin"}, []Role{RoleAdmin}, true},
+		{"any of several", []string{"admin"}, []Role{RoleUser, RoleAdmin}, true},
+		{"admin holds every role", []string{"admin"}, []Role{RoleUser}, true},
+		{"unknown group", []string{"superuser"}, []Role{RoleAdmin}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal := Principal{Groups: tt.groups}
+			if got := principal.HasRole(tt.roles...); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
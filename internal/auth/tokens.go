@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// DefaultClockSkew is how far token timestamps may drift from the server
+// clock before the token is rejected
+const DefaultClockSkew = time.Minute
+
+var (
+	// ErrTokenExpired means the token was valid but its exp has passed.
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenInvalid means the token is malformed, wrongly signed or has
+	// claims that don't match this app.
+	ErrTokenInvalid = errors.New("invalid token")
+)
+
+// KeySource supplies the public keys tokens are verified with. *JWKS and
+// *MemoryProvider implement it.
+type KeySource interface {
+	KeySetFor(ctx context.Context, kid string) (jwk.Set, error)
+}
+
+// TokenValidator verifies Cognito access tokens: signature, expiry, issuer,
+// client_id and token_use.
+type TokenValidator struct {
+	Keys     KeySource
+	Issuer   string
+	ClientID string
+	Skew     time.Duration
+
+	clock jwt.Clock
+}
+
+// CognitoIssuer returns the iss claim Cognito puts in tokens for a user pool.
+func CognitoIssuer(region, userPoolID string) string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+}
+
+// Validate verifies raw and returns the parsed token. Errors wrap
+// ErrTokenExpired, ErrTokenInvalid or ErrNoSigningKeys.
+func (v *TokenValidator) Validate(ctx context.Context, raw []byte) (jwt.Token, error) {
+	return v.parse(ctx, raw,
+		jwt.WithClaimValue("client_id", v.ClientID),
+		jwt.WithClaimValue("token_use", "access"),
+	)
+}
+
+// ValidateIDToken verifies an ID token issued to this app whose nonce claim
+// matches the one sent with the authorization request.
+func (v *TokenValidator) ValidateIDToken(ctx context.Context, raw []byte, nonce string) (jwt.Token, error) {
+	return v.parse(ctx, raw,
+		jwt.WithAudience(v.ClientID),
+		jwt.WithClaimValue("token_use", "id"),
+		jwt.WithClaimValue("nonce", nonce),
+	)
+}
+
+// parse checks raw's signature, timestamps and issuer, plus the claims in
+// options.
+func (v *TokenValidator) parse(ctx context.Context, raw []byte, options ...jwt.ParseOption) (jwt.Token, error) {
+	// Read the key ID so rotated keys can be fetched before verifying
+	message, err := jws.Parse(raw)
+	if err != nil || len(message.Signatures()) == 0 {
+		return nil, fmt.Errorf("%w: malformed token", ErrTokenInvalid)
+	}
+	kid := message.Signatures()[0].ProtectedHeaders().KeyID()
+
+	keySet, err := v.Keys.KeySetFor(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options,
+		jwt.WithKeySet(keySet),
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(v.Skew),
+		jwt.WithRequiredClaim("exp"),
+		jwt.WithIssuer(v.Issuer),
+	)
+	if v.clock != nil {
+		options = append(options, jwt.WithClock(v.clock))
+	}
+
+	token, err := jwt.Parse(raw, options...)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired()) {
+			return nil, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	return token, nil
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	testIssuer   = "https://cognito-idp.us-east-1.amazonaws.com/us-east-1_test"
+	testClientID = "test-client"
+)
+
+// signTestToken signs claims with the key for kid.
+func signTestToken(t *testing.T, kid string, claims map[string]interface{}) []byte {
+	t.Helper()
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			t.Fatalf("Failed to set claim %s: %v", name, err)
+		}
+	}
+	key, err := jwk.FromRaw(testPrivateKey(t, kid))
+	if err != nil {
+		t.Fatalf("Failed to create JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, kid)
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestTokenValidatorValidate(t *testing.T) {
+	server := newJWKSServer(t, "current")
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator := &TokenValidator{
+		Keys:     keys,
+		Issuer:   testIssuer,
+		ClientID: testClientID,
+		Skew:     time.Minute,
+		clock:    jwt.ClockFunc(func() time.Time { return now }),
+	}
+
+	// validClaims returns an access token's claims with overrides applied;
+	// a nil override removes the claim
+	validClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":       testIssuer,
+			"client_id": testClientID,
+			"token_use": "access",
+			"username":  "test-user",
+			"iat":       now.Add(-time.Minute),
+			"exp":       now.Add(time.Hour),
+		}
+		for name, value := range overrides {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		kid     string
+		claims  map[string]interface{}
+		raw     []byte
+		wantErr error
+	}{
+		{
+			name:   "valid access token",
+			claims: validClaims(nil),
+		},
+		{
+			name:   "expired within skew",
+			claims: validClaims(map[string]interface{}{"exp": now.Add(-30 * time.Second)}),
+		},
+		{
+			name:    "expired beyond skew",
+			claims:  validClaims(map[string]interface{}{"exp": now.Add(-2 * time.Minute)}),
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "missing exp",
+			claims:  validClaims(map[string]interface{}{"exp": nil}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "not yet valid",
+			claims:  validClaims(map[string]interface{}{"nbf": now.Add(10 * time.Minute)}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "issued in the future",
+			claims:  validClaims(map[string]interface{}{"iat": now.Add(10 * time.Minute)}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "wrong issuer",
+			claims:  validClaims(map[string]interface{}{"iss": "https://cognito-idp.us-east-1.amazonaws.com/other"}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "wrong client",
+			claims:  validClaims(map[string]interface{}{"client_id": "other-client"}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "missing client",
+			claims:  validClaims(map[string]interface{}{"client_id": nil}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "id token",
+			claims:  validClaims(map[string]interface{}{"token_use": "id"}),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "unknown signing key",
+			kid:     "attacker",
+			claims:  validClaims(nil),
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "malformed token",
+			raw:     []byte("not-a-token"),
+			wantErr: ErrTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.raw
+			if raw == nil {
+				kid := tt.kid
+				if kid == "" {
+					kid = "current"
+				}
+				raw = signTestToken(t, kid, tt.claims)
+			}
+
+			token, err := validator.Validate(context.Background(), raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if token.PrivateClaims()["username"] != "test-user" {
+				t.Errorf("Expected username claim, got %v", token.PrivateClaims()["username"])
+			}
+		})
+	}
+}
+
+func TestTokenValidatorValidateIDToken(t *testing.T) {
+	server := newJWKSServer(t, "current")
+	keys, err := NewJWKS(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator := &TokenValidator{
+		Keys:     keys,
+		Issuer:   testIssuer,
+		ClientID: testClientID,
+		clock:    jwt.ClockFunc(func() time.Time { return now }),
+	}
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":              testIssuer,
+			"aud":              testClientID,
+			"token_use":        "id",
+			"nonce":            "nonce-1",
+			"cognito:username": "google_123",
+			"exp":              now.Add(time.Hour),
+		}
+		for name, value := range overrides {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	token, err := validator.ValidateIDToken(context.Background(), signTestToken(t, "current", claims(nil)), "nonce-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if principal := PrincipalFromToken(token); principal.Username != "google_123" {
+		t.Errorf("Expected username from cognito:username, got %q", principal.Username)
+	}
+
+	rejected := map[string]map[string]interface{}{
+		"wrong nonce":    claims(map[string]interface{}{"nonce": "replayed"}),
+		"wrong audience": claims(map[string]interface{}{"aud": "other-client"}),
+		"access token":   claims(map[string]interface{}{"token_use": "access"}),
+	}
+	for name, c := range rejected {
+		t.Run(name, func(t *testing.T) {
+			_, err := validator.ValidateIDToken(context.Background(), signTestToken(t, "current", c), "nonce-1")
+			if !errors.Is(err, ErrTokenInvalid) {
+				t.Errorf("Expected ErrTokenInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCognitoIssuer(t *testing.T) {
+	got := CognitoIssuer("us-east-1", "us-east-1_test")
+	if got != testIssuer {
+		t.Errorf("Expected %s, got %s", testIssuer, got)
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrackerSummary is a tracker with counts for support lookups, without the
+// contents of any logs.
+type TrackerSummary struct {
+	Tracker
+	SymptomCount int `json:"symptom_count"`
+	LogCount     int `json:"log_count"`
+	// LastLogTime is the newest log's UTC time in RFC 3339, if any
+	LastLogTime string `json:"last_log_time,omitempty"`
+}
+
+// SearchUsers finds users whose email starts with query or whose Cognito
+// username is exactly query, up to limit results.
+func (d *Database) SearchUsers(query string, limit int) ([]User, error) {
+	// Escape LIKE wildcards so the search is a literal prefix match
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	rows, err := d.mysql.Query(
+		`SELECT id, cognito_sub, email, time_zone FROM users
+		WHERE email LIKE ? OR cognito_sub = ?
+		ORDER BY email LIMIT ?`,
+		escaped+"%", query, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.CognitoSub, &user.Email, &user.TimeZone); err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (d *Database) GetUserByID(userID int) (User, error) {
+	query := `SELECT id, cognito_sub, email, time_zone FROM users WHERE id = ?`
+	var user User
+	err := d.mysql.QueryRow(query, userID).Scan(&user.ID, &user.CognitoSub, &user.Email, &user.TimeZone)
+	if err != nil {
+		return User{}, fmt.Errorf("error scanning user: %w", err)
+	}
+	return user, nil
+}
+
+// GetTrackerSummariesByUserID returns each of the user's trackers with its
+// symptom and log counts.
+func (d *Database) GetTrackerSummariesByUserID(userID int) ([]TrackerSummary, error) {
+	trackers, err := d.GetTrackerByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]TrackerSummary, 0, len(trackers))
+	for _, tracker := range trackers {
+		summary := TrackerSummary{Tracker: tracker}
+		err := d.mysql.QueryRow(
+			`SELECT COUNT(*) FROM symptoms WHERE tracker_id = ?`, tracker.ID,
+		).Scan(&summary.SymptomCount)
+		if err != nil {
+			return nil, fmt.Errorf("error counting symptoms: %w", err)
+		}
+
+		var lastLogTime sql.NullString
+		err = d.mysql.QueryRow(
+			`SELECT COUNT(*), MAX(log_time) FROM symptom_logs WHERE tracker_id = ?`, tracker.ID,
+		).Scan(&summary.LogCount, &lastLogTime)
+		if err != nil {
+			return nil, fmt.Errorf("error counting symptom logs: %w", err)
+		}
+		if lastLogTime.Valid {
+			loggedAt, err := time.Parse(time.DateTime, lastLogTime.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing log time %q: %w", lastLogTime.String, err)
+			}
+			summary.LastLogTime = loggedAt.Format(time.RFC3339)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
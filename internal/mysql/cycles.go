@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func (d *Database) CreateCycle(cycle Cycle) (int, error) {
+	query := `INSERT INTO cycles (user_id, start_date, end_date, flow) VALUES (?, ?, ?, ?)`
+	result, err := d.mysql.Exec(query, cycle.UserID, cycle.StartDate, nullString(cycle.EndDate), cycle.Flow)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting cycle: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting cycle id: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetCyclesByUserID returns the user's cycles, oldest first.
+func (d *Database) GetCyclesByUserID(userID int) ([]Cycle, error) {
+	query := `SELECT id, user_id, start_date, end_date, flow FROM cycles WHERE user_id = ? ORDER BY start_date`
+	rows, err := d.mysql.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cycles: %w", err)
+	}
+	defer rows.Close()
+
+	cycles := []Cycle{}
+	for rows.Next() {
+		cycle, err := scanCycle(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning cycle: %w", err)
+		}
+		cycles = append(cycles, cycle)
+	}
+	return cycles, nil
+}
+
+func (d *Database) GetCycleByIDAndUserID(id, userID int) (Cycle, error) {
+	query := `SELECT id, user_id, start_date, end_date, flow FROM cycles WHERE id = ? AND user_id = ?`
+	cycle, err := scanCycle(d.mysql.QueryRow(query, id, userID))
+	if err != nil {
+		return Cycle{}, fmt.Errorf("error querying cycle: %w", err)
+	}
+	return cycle, nil
+}
+
+func (d *Database) UpdateCycle(cycle Cycle) error {
+	query := `UPDATE cycles SET start_date = ?, end_date = ?, flow = ? WHERE id = ?`
+	_, err := d.mysql.Exec(query, cycle.StartDate, nullString(cycle.EndDate), cycle.Flow, cycle.ID)
+	if err != nil {
+		return fmt.Errorf("error updating cycle: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteCycle(id int) error {
+	_, err := d.mysql.Exec(`DELETE FROM cycles WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting cycle: %w", err)
+	}
+	return nil
+}
+
+func scanCycle(row scanner) (Cycle, error) {
+	var cycle Cycle
+	var endDate sql.NullString
+	err := row.Scan(&cycle.ID, &cycle.UserID, &cycle.StartDate, &endDate, &cycle.Flow)
+	cycle.EndDate = endDate.String
+	return cycle, err
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
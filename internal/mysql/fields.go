@@ -0,0 +1,302 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FieldNumber  = "number"
+	FieldBoolean = "boolean"
+	FieldEnum    = "enum"
+	FieldScale   = "scale"
+	FieldText    = "text"
+
+	maxFieldTextLength = 1000
+)
+
+// ErrMissingField is returned by ParseFieldValues when a required field has
+// no value.
+var ErrMissingField = errors.New("missing required field")
+
+// Validate checks a field definition before it is saved, filling in the
+// default 1-10 range of a scale field.
+func (f *TrackerField) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return errors.New("field name is required")
+	}
+	switch f.Type {
+	case FieldNumber, FieldBoolean, FieldText:
+	case FieldEnum:
+		if len(f.Options) == 0 {
+			return errors.New("enum fields need at least one option")
+		}
+	case FieldScale:
+		if f.ScaleMin == 0 && f.ScaleMax == 0 {
+			f.ScaleMin, f.ScaleMax = 1, 10
+		}
+		if f.ScaleMin >= f.ScaleMax {
+			return errors.New("scale_min must be less than scale_max")
+		}
+	default:
+		return fmt.Errorf("unknown field type %q", f.Type)
+	}
+	return nil
+}
+
+// Parse validates a raw JSON value against the field's type.
+func (f TrackerField) Parse(raw json.RawMessage) (FieldValue, error) {
+	value := FieldValue{FieldID: f.ID, Name: f.Name, Type: f.Type, Unit: f.Unit}
+	switch f.Type {
+	case FieldNumber, FieldScale:
+		var number float64
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return FieldValue{}, fmt.Errorf("%s must be a number", f.Name)
+		}
+		if f.Type == FieldScale {
+			if number != math.Trunc(number) || number < float64(f.ScaleMin) || number > float64(f.ScaleMax) {
+				return FieldValue{}, fmt.Errorf("%s must be a whole number from %d to %d", f.Name, f.ScaleMin, f.ScaleMax)
+			}
+		}
+		value.Value = number
+	case FieldBoolean:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return FieldValue{}, fmt.Errorf("%s must be true or false", f.Name)
+		}
+		value.Value = b
+	case FieldEnum:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return FieldValue{}, fmt.Errorf("%s must be a string", f.Name)
+		}
+		valid := false
+		for _, option := range f.Options {
+			if option == text {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return FieldValue{}, fmt.Errorf("%s must be one of %s", f.Name, strings.Join(f.Options, ", "))
+		}
+		value.Value = text
+	case FieldText:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return FieldValue{}, fmt.Errorf("%s must be a string", f.Name)
+		}
+		if utf8.RuneCountInString(text) > maxFieldTextLength {
+			return FieldValue{}, fmt.Errorf("%s must be at most %d characters", f.Name, maxFieldTextLength)
+		}
+		value.Value = text
+	default:
+		return FieldValue{}, fmt.Errorf("unknown field type %q", f.Type)
+	}
+	return value, nil
+}
+
+// ParseFieldValues validates the values sent with a log against the tracker's
+// fields. Unknown field names are rejected and JSON nulls count as missing.
+func ParseFieldValues(fields []TrackerField, raw map[string]json.RawMessage) ([]FieldValue, error) {
+	byName := make(map[string]TrackerField, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	for name := range raw {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+
+	var values []FieldValue
+	for _, field := range fields {
+		value, ok := raw[field.Name]
+		if !ok || string(value) == "null" {
+			if field.Required {
+				return nil, fmt.Errorf("%w: %s", ErrMissingField, field.Name)
+			}
+			continue
+		}
+		parsed, err := field.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, parsed)
+	}
+	return values, nil
+}
+
+func (d *Database) CreateTrackerField(field TrackerField) (int, error) {
+	var options sql.NullString
+	if len(field.Options) > 0 {
+		data, err := json.Marshal(field.Options)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding field options: %w", err)
+		}
+		options = sql.NullString{String: string(data), Valid: true}
+	}
+
+	query := `INSERT INTO tracker_fields (tracker_id, name, field_type, unit, options, scale_min, scale_max, required)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := d.mysql.Exec(
+		query,
+		field.TrackerID,
+		field.Name,
+		field.Type,
+		field.Unit,
+		options,
+		field.ScaleMin,
+		field.ScaleMax,
+		field.Required,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting tracker field: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting tracker field id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (d *Database) GetTrackerFieldsByTrackerID(trackerID int) ([]TrackerField, error) {
+	query := `SELECT id, tracker_id, name, field_type, unit, options, scale_min, scale_max, required
+		FROM tracker_fields WHERE tracker_id = ? ORDER BY id`
+	rows, err := d.mysql.Query(query, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tracker fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []TrackerField{}
+	for rows.Next() {
+		var field TrackerField
+		var options sql.NullString
+		err := rows.Scan(
+			&field.ID,
+			&field.TrackerID,
+			&field.Name,
+			&field.Type,
+			&field.Unit,
+			&options,
+			&field.ScaleMin,
+			&field.ScaleMax,
+			&field.Required,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning tracker field: %w", err)
+		}
+		if options.Valid {
+			if err := json.Unmarshal([]byte(options.String), &field.Options); err != nil {
+				return nil, fmt.Errorf("error decoding field options: %w", err)
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// DeleteTrackerField deletes one of the user's fields along with every value
+// logged for it. It returns sql.ErrNoRows if the user has no such field.
+func (d *Database) DeleteTrackerField(fieldID, userID int) error {
+	query := `DELETE f FROM tracker_fields f
+		JOIN trackers t ON t.id = f.tracker_id
+		WHERE f.id = ? AND t.user_id = ?`
+	result, err := d.mysql.Exec(query, fieldID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting tracker field: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// insertFieldValues stores a log's field values in the column for their type.
+func insertFieldValues(tx *sql.Tx, logID int64, values []FieldValue) error {
+	for _, value := range values {
+		var number sql.NullFloat64
+		var b sql.NullBool
+		var text sql.NullString
+		switch v := value.Value.(type) {
+		case float64:
+			number = sql.NullFloat64{Float64: v, Valid: true}
+		case bool:
+			b = sql.NullBool{Bool: v, Valid: true}
+		case string:
+			text = sql.NullString{String: v, Valid: true}
+		default:
+			return fmt.Errorf("unsupported value for field %s", value.Name)
+		}
+		_, err := tx.Exec(
+			`INSERT INTO symptom_log_field_values (log_id, field_id, number_value, bool_value, text_value)
+			VALUES (?, ?, ?, ?, ?)`,
+			logID,
+			value.FieldID,
+			number,
+			b,
+			text,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting field value: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachFieldValues loads the field values of every log in logs in a single
+// query.
+func (d *Database) attachFieldValues(logs []SymptomLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*SymptomLog, len(logs))
+	ids := make([]any, len(logs))
+	for i := range logs {
+		logs[i].Fields = []FieldValue{}
+		byID[logs[i].ID] = &logs[i]
+		ids[i] = logs[i].ID
+	}
+
+	query := `SELECT v.log_id, f.id, f.name, f.field_type, f.unit, v.number_value, v.bool_value, v.text_value
+		FROM symptom_log_field_values v
+		JOIN tracker_fields f ON f.id = v.field_id
+		WHERE v.log_id IN (?` + strings.Repeat(", ?", len(ids)-1) + `) ORDER BY f.id`
+	rows, err := d.mysql.Query(query, ids...)
+	if err != nil {
+		return fmt.Errorf("error querying field values: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var logID int
+		var value FieldValue
+		var number sql.NullFloat64
+		var b sql.NullBool
+		var text sql.NullString
+		err := rows.Scan(&logID, &value.FieldID, &value.Name, &value.Type, &value.Unit, &number, &b, &text)
+		if err != nil {
+			return fmt.Errorf("error scanning field value: %w", err)
+		}
+		switch {
+		case number.Valid:
+			value.Value = number.Float64
+		case b.Valid:
+			value.Value = b.Bool
+		case text.Valid:
+			value.Value = text.String
+		}
+		if log, ok := byID[logID]; ok {
+			log.Fields = append(log.Fields, value)
+		}
+	}
+	return nil
+}
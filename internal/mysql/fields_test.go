@@ -0,0 +1,105 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func testFields() []TrackerField {
+	return []TrackerField{
+		{ID: 1, Name: "sleep", Type: FieldNumber, Unit: "hours", Required: true},
+		{ID: 2, Name: "exercised", Type: FieldBoolean},
+		{ID: 3, Name: "mood", Type: FieldEnum, Options: []string{"low", "ok", "good"}},
+		{ID: 4, Name: "energy", Type: FieldScale, ScaleMin: 1, ScaleMax: 5},
+		{ID: 5, Name: "meals", Type: FieldText},
+	}
+}
+
+func TestParseFieldValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"all fields", `{"sleep": 7.5, "exercised": true, "mood": "ok", "energy": 3, "meals": "oats"}`, 5, false},
+		{"only required", `{"sleep": 8}`, 1, false},
+		{"null optional", `{"sleep": 8, "mood": null}`, 1, false},
+		{"missing required", `{"mood": "ok"}`, 0, true},
+		{"unknown field", `{"sleep": 8, "steps": 1000}`, 0, true},
+		{"number as string", `{"sleep": "eight"}`, 0, true},
+		{"boolean as number", `{"sleep": 8, "exercised": 1}`, 0, true},
+		{"enum not an option", `{"sleep": 8, "mood": "great"}`, 0, true},
+		{"scale out of range", `{"sleep": 8, "energy": 6}`, 0, true},
+		{"scale not whole", `{"sleep": 8, "energy": 2.5}`, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var raw map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(test.raw), &raw); err != nil {
+				t.Fatalf("Invalid test JSON: %v", err)
+			}
+			values, err := ParseFieldValues(testFields(), raw)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(values) != test.want {
+				t.Errorf("Expected %d values, got %d", test.want, len(values))
+			}
+		})
+	}
+}
+
+func TestParseFieldValuesTypes(t *testing.T) {
+	raw := map[string]json.RawMessage{
+		"sleep":     json.RawMessage(`7.5`),
+		"exercised": json.RawMessage(`false`),
+		"mood":      json.RawMessage(`"good"`),
+	}
+	values, err := ParseFieldValues(testFields(), raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values[0].Value != 7.5 || values[0].Unit != "hours" {
+		t.Errorf("Expected sleep 7.5 hours, got %+v", values[0])
+	}
+	if values[1].Value != false {
+		t.Errorf("Expected exercised false, got %+v", values[1])
+	}
+	if values[2].Value != "good" {
+		t.Errorf("Expected mood good, got %+v", values[2])
+	}
+}
+
+func TestParseFieldValuesMissingRequired(t *testing.T) {
+	_, err := ParseFieldValues(testFields(), nil)
+	if !errors.Is(err, ErrMissingField) {
+		t.Errorf("Expected ErrMissingField, got %v", err)
+	}
+}
+
+func TestTrackerFieldValidate(t *testing.T) {
+	scale := TrackerField{Name: "pain", Type: FieldScale}
+	if err := scale.Validate(); err != nil || scale.ScaleMin != 1 || scale.ScaleMax != 10 {
+		t.Errorf("Expected default 1-10 scale, got %+v (%v)", scale, err)
+	}
+
+	invalid := []TrackerField{
+		{Name: " ", Type: FieldText},
+		{Name: "mood", Type: FieldEnum},
+		{Name: "pain", Type: FieldScale, ScaleMin: 5, ScaleMax: 1},
+		{Name: "date", Type: "date"},
+	}
+	for _, field := range invalid {
+		if err := field.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", field)
+		}
+	}
+}
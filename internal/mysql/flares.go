@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+)
+
+// ReplaceFlareEvents swaps a tracker's stored flares for freshly detected ones.
+func (d *Database) ReplaceFlareEvents(trackerID int, flares []FlareEvent) error {
+	tx, err := d.mysql.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM flare_events WHERE tracker_id = ?`, trackerID)
+	if err != nil {
+		return fmt.Errorf("error deleting flare events: %w", err)
+	}
+	for _, flare := range flares {
+		_, err := tx.Exec(
+			`INSERT INTO flare_events (tracker_id, start_date, end_date, reason, peak_logs, peak_severity, score)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			trackerID,
+			flare.StartDate,
+			flare.EndDate,
+			flare.Reason,
+			flare.PeakLogs,
+			flare.PeakSeverity,
+			flare.Score,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting flare event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing flare events: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetFlareEventsByTrackerID(trackerID int) ([]FlareEvent, error) {
+	query := `SELECT id, tracker_id, DATE_FORMAT(start_date, '%Y-%m-%d'), DATE_FORMAT(end_date, '%Y-%m-%d'),
+			reason, peak_logs, peak_severity, score, detected_at
+		FROM flare_events
+		WHERE tracker_id = ?
+		ORDER BY start_date`
+	rows, err := d.mysql.Query(query, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying flare events: %w", err)
+	}
+	defer rows.Close()
+
+	flares := []FlareEvent{}
+	for rows.Next() {
+		var flare FlareEvent
+		err := rows.Scan(
+			&flare.ID,
+			&flare.TrackerID,
+			&flare.StartDate,
+			&flare.EndDate,
+			&flare.Reason,
+			&flare.PeakLogs,
+			&flare.PeakSeverity,
+			&flare.Score,
+			&flare.DetectedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning flare event: %w", err)
+		}
+		flares = append(flares, flare)
+	}
+	return flares, nil
+}
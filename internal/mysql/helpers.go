@@ -1,21 +1,43 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
+	"time"
 )
 
-func (d *Database) CreateUser(email, sub string) error {
-	query := `INSERT INTO users (email, cognito_sub) VALUES (?, ?)`
-	_, err := d.mysql.Exec(query, email, sub)
+// symptomLogColumns is the column list scanSymptomLog expects.
+const symptomLogColumns = `id, user_id, tracker_id, log_time, severity, symptoms, notes, utc_offset_minutes`
+
+func (d *Database) CreateUser(email, sub, timeZone string) error {
+	query := `INSERT INTO users (email, cognito_sub, time_zone) VALUES (?, ?, ?)`
+	_, err := d.mysql.Exec(query, email, sub, timeZone)
 	if err != nil {
 		return fmt.Errorf("error inserting user: %w", err)
 	}
 	return nil
 }
 
-func (d *Database) CreateTracker(tracker string, userID int) error {
-	query := `INSERT INTO trackers (tracker_name, user_id) VALUES (?, ?)`
-	_, err := d.mysql.Exec(query, tracker, userID)
+func (d *Database) UpdateUserTimeZone(userID int, timeZone string) error {
+	query := `UPDATE users SET time_zone = ? WHERE id = ?`
+	_, err := d.mysql.Exec(query, timeZone, userID)
+	if err != nil {
+		return fmt.Errorf("error updating user time zone: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) CreateTracker(tracker Tracker) error {
+	query := `INSERT INTO trackers (tracker_name, user_id, template_id, severity_min, severity_max)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err := d.mysql.Exec(
+		query,
+		tracker.TrackerName,
+		tracker.UserID,
+		nullString(tracker.TemplateID),
+		tracker.SeverityMin,
+		tracker.SeverityMax,
+	)
 	if err != nil {
 		return fmt.Errorf("error inserting tracker: %w", err)
 	}
@@ -31,27 +53,64 @@ func (d *Database) CreateSymptom(symptom string, trackerID int) error {
 	return nil
 }
 
-func (d *Database) CreateSymptomLog(symptomLog SymptomLogRequestBody) error {
-	query := `INSERT INTO symptom_logs (user_id, tracker_id, severity, symptoms, notes) VALUES (?, ?, ?, ?, ?)`
-	_, err := d.mysql.Exec(
+// CreateSymptomLog inserts a log together with the tags extracted from its
+// notes and returns the new log's ID.
+func (d *Database) CreateSymptomLog(symptomLog SymptomLogRequestBody, tags []LogTag, values []FieldValue) (int, error) {
+	tx, err := d.mysql.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO symptom_logs (user_id, tracker_id, log_time, utc_offset_minutes, severity, symptoms, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	logTime, offsetMinutes := logTimeValues(symptomLog.LoggedAt)
+	result, err := tx.Exec(
 		query,
 		symptomLog.UserID,
 		symptomLog.TrackerID,
+		logTime,
+		offsetMinutes,
 		symptomLog.Severity,
 		symptomLog.SelectedSymptoms,
 		symptomLog.Notes,
 	)
 	if err != nil {
-		return fmt.Errorf("error inserting symptom log: %w", err)
+		return 0, fmt.Errorf("error inserting symptom log: %w", err)
 	}
-	return nil
+	logID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting symptom log id: %w", err)
+	}
+
+	for _, tag := range tags {
+		_, err := tx.Exec(
+			`INSERT INTO symptom_log_tags (log_id, category, keyword, negated) VALUES (?, ?, ?, ?)`,
+			logID,
+			tag.Category,
+			tag.Keyword,
+			tag.Negated,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("error inserting symptom log tag: %w", err)
+		}
+	}
+
+	if err := insertFieldValues(tx, logID, values); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing symptom log: %w", err)
+	}
+	return int(logID), nil
 }
 
 func (d *Database) GetUserBySub(cognitoSub string) (User, error) {
-	query := `SELECT * FROM users WHERE cognito_sub = ?`
+	query := `SELECT id, cognito_sub, email, time_zone FROM users WHERE cognito_sub = ?`
 	row := d.mysql.QueryRow(query, cognitoSub)
 	var user User
-	err := row.Scan(&user.ID, &user.CognitoSub, &user.Email)
+	err := row.Scan(&user.ID, &user.CognitoSub, &user.Email, &user.TimeZone)
 	if err != nil {
 		return User{}, fmt.Errorf("error scanning user: %w", err)
 	}
@@ -59,10 +118,26 @@ func (d *Database) GetUserBySub(cognitoSub string) (User, error) {
 }
 
 func (d *Database) GetTrackerByNameAndUserID(trackerName string, userID int) (Tracker, error) {
-	query := `SELECT * FROM trackers WHERE tracker_name= ? AND user_id= ?`
-	row := d.mysql.QueryRow(query, trackerName, userID)
-	var tracker Tracker
-	err := row.Scan(&tracker.ID, &tracker.UserID, &tracker.TrackerName)
+	query := `SELECT ` + trackerColumns + ` FROM trackers WHERE tracker_name= ? AND user_id= ?`
+	tracker, err := scanTracker(d.mysql.QueryRow(query, trackerName, userID))
+	if err != nil {
+		return Tracker{}, fmt.Errorf("error scanning tracker: %w", err)
+	}
+	return tracker, nil
+}
+
+func (d *Database) GetTrackerByID(trackerID int) (Tracker, error) {
+	query := `SELECT ` + trackerColumns + ` FROM trackers WHERE id = ?`
+	tracker, err := scanTracker(d.mysql.QueryRow(query, trackerID))
+	if err != nil {
+		return Tracker{}, fmt.Errorf("error scanning tracker: %w", err)
+	}
+	return tracker, nil
+}
+
+func (d *Database) GetTrackerByIDAndUserID(trackerID, userID int) (Tracker, error) {
+	query := `SELECT ` + trackerColumns + ` FROM trackers WHERE id = ? AND user_id = ?`
+	tracker, err := scanTracker(d.mysql.QueryRow(query, trackerID, userID))
 	if err != nil {
 		return Tracker{}, fmt.Errorf("error scanning tracker: %w", err)
 	}
@@ -70,7 +145,7 @@ func (d *Database) GetTrackerByNameAndUserID(trackerName string, userID int) (Tr
 }
 
 func (d *Database) GetTrackerByUserID(userID int) ([]Tracker, error) {
-	query := `SELECT * FROM trackers WHERE user_id = ?`
+	query := `SELECT ` + trackerColumns + ` FROM trackers WHERE user_id = ?`
 	rows, err := d.mysql.Query(query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying trackers: %w", err)
@@ -79,8 +154,7 @@ func (d *Database) GetTrackerByUserID(userID int) ([]Tracker, error) {
 
 	var trackers []Tracker
 	for rows.Next() {
-		var tracker Tracker
-		err := rows.Scan(&tracker.ID, &tracker.UserID, &tracker.TrackerName)
+		tracker, err := scanTracker(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning tracker: %w", err)
 		}
@@ -110,7 +184,7 @@ func (d *Database) GetSymptomsByTrackerID(trackerID int) ([]Symptom, error) {
 }
 
 func (d *Database) GetSymptomLogsByUserID(userID int) ([]SymptomLog, error) {
-	query := `SELECT * FROM symptom_logs WHERE user_id= ?`
+	query := `SELECT ` + symptomLogColumns + ` FROM symptom_logs WHERE user_id= ? ORDER BY log_time`
 	rows, err := d.mysql.Query(query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying symptom logs: %w", err)
@@ -119,26 +193,20 @@ func (d *Database) GetSymptomLogsByUserID(userID int) ([]SymptomLog, error) {
 
 	var symptomLogs []SymptomLog
 	for rows.Next() {
-		var symptomLog SymptomLog
-		err := rows.Scan(
-			&symptomLog.ID,
-			&symptomLog.UserID,
-			&symptomLog.TrackerID,
-			&symptomLog.LogTime,
-			&symptomLog.Severity,
-			&symptomLog.Symptoms,
-			&symptomLog.Notes,
-		)
+		symptomLog, err := scanSymptomLog(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning symptom log: %w", err)
 		}
 		symptomLogs = append(symptomLogs, symptomLog)
 	}
+	if err := d.attachDetails(symptomLogs); err != nil {
+		return nil, err
+	}
 	return symptomLogs, nil
 }
 
 func (d *Database) GetSymptomLogsByTrackerID(trackerID int) ([]SymptomLog, error) {
-	query := `SELECT * FROM symptom_logs WHERE tracker_id= ?`
+	query := `SELECT ` + symptomLogColumns + ` FROM symptom_logs WHERE tracker_id= ? ORDER BY log_time`
 	rows, err := d.mysql.Query(query, trackerID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying symptom logs: %w", err)
@@ -147,39 +215,91 @@ func (d *Database) GetSymptomLogsByTrackerID(trackerID int) ([]SymptomLog, error
 
 	var symptomLogs []SymptomLog
 	for rows.Next() {
-		var symptomLog SymptomLog
-		err := rows.Scan(
-			&symptomLog.ID,
-			&symptomLog.UserID,
-			&symptomLog.TrackerID,
-			&symptomLog.LogTime,
-			&symptomLog.Severity,
-			&symptomLog.Symptoms,
-			&symptomLog.Notes,
-		)
+		symptomLog, err := scanSymptomLog(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning symptom log: %w", err)
 		}
 		symptomLogs = append(symptomLogs, symptomLog)
 	}
+	if err := d.attachDetails(symptomLogs); err != nil {
+		return nil, err
+	}
 	return symptomLogs, nil
 }
 
-func (d *Database) GetSymptomLogByTrackerIDAndCurrentTime(trackerID int) (SymptomLog, error) {
-	query := `SELECT * FROM symptom_logs WHERE tracker_id= ? ORDER BY log_time DESC LIMIT 1`
-	row := d.mysql.QueryRow(query, trackerID)
+func (d *Database) GetSymptomLogByID(logID int) (SymptomLog, error) {
+	query := `SELECT ` + symptomLogColumns + ` FROM symptom_logs WHERE id = ?`
+	symptomLog, err := scanSymptomLog(d.mysql.QueryRow(query, logID))
+	if err != nil {
+		return SymptomLog{}, fmt.Errorf("error scanning symptom log: %w", err)
+	}
+	logs := []SymptomLog{symptomLog}
+	if err := d.attachDetails(logs); err != nil {
+		return SymptomLog{}, err
+	}
+	return logs[0], nil
+}
+
+const trackerColumns = "id, user_id, tracker_name, template_id, severity_min, severity_max"
+
+// scanTracker reads a row selected with trackerColumns.
+func scanTracker(row scanner) (Tracker, error) {
+	var tracker Tracker
+	var templateID sql.NullString
+	err := row.Scan(
+		&tracker.ID,
+		&tracker.UserID,
+		&tracker.TrackerName,
+		&templateID,
+		&tracker.SeverityMin,
+		&tracker.SeverityMax,
+	)
+	tracker.TemplateID = templateID.String
+	return tracker, err
+}
+
+// attachDetails loads the tags and custom field values of logs.
+func (d *Database) attachDetails(logs []SymptomLog) error {
+	if err := d.attachTags(logs); err != nil {
+		return err
+	}
+	return d.attachFieldValues(logs)
+}
+
+// logTimeValues returns the log_time and utc_offset_minutes stored for a log
+// recorded at t: the UTC instant and the offset t was recorded with.
+func logTimeValues(t time.Time) (string, int) {
+	_, offset := t.Zone()
+	return t.UTC().Format(time.DateTime), offset / 60
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSymptomLog reads a row selected with symptomLogColumns. LogTime is
+// returned as an RFC 3339 UTC instant.
+func scanSymptomLog(row scanner) (SymptomLog, error) {
 	var symptomLog SymptomLog
+	var logTime string
 	err := row.Scan(
 		&symptomLog.ID,
 		&symptomLog.UserID,
 		&symptomLog.TrackerID,
-		&symptomLog.LogTime,
+		&logTime,
 		&symptomLog.Severity,
 		&symptomLog.Symptoms,
 		&symptomLog.Notes,
+		&symptomLog.UTCOffsetMinutes,
 	)
 	if err != nil {
-		return SymptomLog{}, fmt.Errorf("error scanning symptom log: %w", err)
+		return SymptomLog{}, err
+	}
+
+	loggedAt, err := time.Parse(time.DateTime, logTime)
+	if err != nil {
+		return SymptomLog{}, fmt.Errorf("error parsing log time %q: %w", logTime, err)
 	}
+	symptomLog.LogTime = loggedAt.Format(time.RFC3339)
 	return symptomLog, nil
 }
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"fmt"
+)
+
+func (d *Database) GetAIInsight(userID, trackerID int, medicalType, logsHash string) (AIInsight, error) {
+	query := `SELECT id, user_id, tracker_id, medical_type, logs_hash, insight, created_at
+		FROM ai_insights
+		WHERE user_id = ? AND tracker_id = ? AND medical_type = ? AND logs_hash = ?`
+	row := d.mysql.QueryRow(query, userID, trackerID, medicalType, logsHash)
+	var insight AIInsight
+	err := row.Scan(
+		&insight.ID,
+		&insight.UserID,
+		&insight.TrackerID,
+		&insight.MedicalType,
+		&insight.LogsHash,
+		&insight.Insight,
+		&insight.CreatedAt,
+	)
+	if err != nil {
+		return AIInsight{}, fmt.Errorf("error scanning ai insight: %w", err)
+	}
+	return insight, nil
+}
+
+// SaveAIInsight stores the latest insight for a user, tracker and medical type,
+// replacing whatever was cached for an older tracker state.
+func (d *Database) SaveAIInsight(insight AIInsight) error {
+	query := `INSERT INTO ai_insights (user_id, tracker_id, medical_type, logs_hash, insight)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			logs_hash = VALUES(logs_hash),
+			insight = VALUES(insight),
+			created_at = CURRENT_TIMESTAMP`
+	_, err := d.mysql.Exec(
+		query,
+		insight.UserID,
+		insight.TrackerID,
+		insight.MedicalType,
+		insight.LogsHash,
+		insight.Insight,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving ai insight: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+const interventionColumns = "i.id, i.tracker_id, i.name, i.kind, i.dose, i.schedule, i.active, i.created_at"
+
+func (d *Database) CreateIntervention(intervention Intervention) (int, error) {
+	query := `INSERT INTO interventions (tracker_id, name, kind, dose, schedule, active)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := d.mysql.Exec(
+		query,
+		intervention.TrackerID,
+		intervention.Name,
+		intervention.Kind,
+		intervention.Dose,
+		intervention.Schedule,
+		intervention.Active,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting intervention: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting intervention id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (d *Database) GetInterventionsByTrackerID(trackerID int) ([]Intervention, error) {
+	query := `SELECT ` + interventionColumns + ` FROM interventions i WHERE i.tracker_id = ? ORDER BY i.name`
+	rows, err := d.mysql.Query(query, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying interventions: %w", err)
+	}
+	defer rows.Close()
+
+	interventions := []Intervention{}
+	for rows.Next() {
+		intervention, err := scanIntervention(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning intervention: %w", err)
+		}
+		interventions = append(interventions, intervention)
+	}
+	return interventions, nil
+}
+
+// GetInterventionByIDAndUserID returns an intervention only if it belongs to
+// one of the user's trackers.
+func (d *Database) GetInterventionByIDAndUserID(id, userID int) (Intervention, error) {
+	query := `SELECT ` + interventionColumns + ` FROM interventions i
+		JOIN trackers t ON t.id = i.tracker_id
+		WHERE i.id = ? AND t.user_id = ?`
+	intervention, err := scanIntervention(d.mysql.QueryRow(query, id, userID))
+	if err != nil {
+		return Intervention{}, fmt.Errorf("error querying intervention: %w", err)
+	}
+	return intervention, nil
+}
+
+func (d *Database) UpdateIntervention(intervention Intervention) error {
+	query := `UPDATE interventions SET name = ?, kind = ?, dose = ?, schedule = ?, active = ? WHERE id = ?`
+	_, err := d.mysql.Exec(
+		query,
+		intervention.Name,
+		intervention.Kind,
+		intervention.Dose,
+		intervention.Schedule,
+		intervention.Active,
+		intervention.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating intervention: %w", err)
+	}
+	return nil
+}
+
+// DeleteIntervention deletes an intervention along with its intake logs.
+func (d *Database) DeleteIntervention(id int) error {
+	_, err := d.mysql.Exec(`DELETE FROM interventions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting intervention: %w", err)
+	}
+	return nil
+}
+
+func scanIntervention(row scanner) (Intervention, error) {
+	var intervention Intervention
+	err := row.Scan(
+		&intervention.ID,
+		&intervention.TrackerID,
+		&intervention.Name,
+		&intervention.Kind,
+		&intervention.Dose,
+		&intervention.Schedule,
+		&intervention.Active,
+		&intervention.CreatedAt,
+	)
+	return intervention, err
+}
+
+func (d *Database) CreateIntakeLog(intake IntakeLog, takenAt time.Time) (int, error) {
+	query := `INSERT INTO intake_logs (intervention_id, taken_at, dose, notes) VALUES (?, ?, ?, ?)`
+	result, err := d.mysql.Exec(
+		query,
+		intake.InterventionID,
+		takenAt.UTC().Format(time.DateTime),
+		intake.Dose,
+		intake.Notes,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting intake log: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting intake log id: %w", err)
+	}
+	return int(id), nil
+}
+
+const intakeLogColumns = `l.id, l.intervention_id, i.name, l.taken_at,
+	CASE WHEN l.dose = '' THEN i.dose ELSE l.dose END, l.notes`
+
+// GetIntakeLogsByTrackerID returns the intake logs of all of a tracker's
+// interventions, oldest first.
+func (d *Database) GetIntakeLogsByTrackerID(trackerID int) ([]IntakeLog, error) {
+	query := `SELECT ` + intakeLogColumns + ` FROM intake_logs l
+		JOIN interventions i ON i.id = l.intervention_id
+		WHERE i.tracker_id = ?
+		ORDER BY l.taken_at`
+	rows, err := d.mysql.Query(query, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying intake logs: %w", err)
+	}
+	defer rows.Close()
+
+	intakes := []IntakeLog{}
+	for rows.Next() {
+		intake, err := scanIntakeLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning intake log: %w", err)
+		}
+		intakes = append(intakes, intake)
+	}
+	return intakes, nil
+}
+
+// GetIntakeLogByIDAndUserID returns an intake log only if it belongs to one
+// of the user's trackers.
+func (d *Database) GetIntakeLogByIDAndUserID(id, userID int) (IntakeLog, error) {
+	query := `SELECT ` + intakeLogColumns + ` FROM intake_logs l
+		JOIN interventions i ON i.id = l.intervention_id
+		JOIN trackers t ON t.id = i.tracker_id
+		WHERE l.id = ? AND t.user_id = ?`
+	intake, err := scanIntakeLog(d.mysql.QueryRow(query, id, userID))
+	if err != nil {
+		return IntakeLog{}, fmt.Errorf("error querying intake log: %w", err)
+	}
+	return intake, nil
+}
+
+func (d *Database) DeleteIntakeLog(id int) error {
+	_, err := d.mysql.Exec(`DELETE FROM intake_logs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting intake log: %w", err)
+	}
+	return nil
+}
+
+// scanIntakeLog reads a row selected with intakeLogColumns. TakenAt is
+// returned as an RFC 3339 UTC instant.
+func scanIntakeLog(row scanner) (IntakeLog, error) {
+	var intake IntakeLog
+	var takenAt string
+	err := row.Scan(
+		&intake.ID,
+		&intake.InterventionID,
+		&intake.InterventionName,
+		&takenAt,
+		&intake.Dose,
+		&intake.Notes,
+	)
+	if err != nil {
+		return IntakeLog{}, err
+	}
+
+	t, err := time.Parse(time.DateTime, takenAt)
+	if err != nil {
+		return IntakeLog{}, fmt.Errorf("error parsing intake time %q: %w", takenAt, err)
+	}
+	intake.TakenAt = t.Format(time.RFC3339)
+	return intake, nil
+}
+
+// LocalizeIntakeLogs sets LocalTime on each intake log to its time in loc.
+func LocalizeIntakeLogs(intakes []IntakeLog, loc *time.Location) {
+	for i := range intakes {
+		if t, err := time.Parse(time.RFC3339, intakes[i].TakenAt); err == nil {
+			intakes[i].LocalTime = t.In(loc).Format(time.RFC3339)
+		}
+	}
+}
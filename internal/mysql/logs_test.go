@@ -0,0 +1,125 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// logRow fakes a symptom_logs row selected with symptomLogColumns.
+type logRow struct {
+	logTime       string
+	offsetMinutes int
+}
+
+func (r logRow) Scan(dest ...any) error {
+	*dest[3].(*string) = r.logTime
+	*dest[7].(*int) = r.offsetMinutes
+	return nil
+}
+
+func TestLocalizeLogs(t *testing.T) {
+	denver, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		loggedAt time.Time
+		viewer   *time.Location
+		// stored log_time and utc_offset_minutes
+		wantStored string
+		wantOffset int
+		wantLocal  string
+	}{
+		{
+			name:       "before spring forward",
+			loggedAt:   time.Date(2024, 3, 10, 1, 30, 0, 0, denver),
+			viewer:     denver,
+			wantStored: "2024-03-10 08:30:00",
+			wantOffset: -420,
+			wantLocal:  "2024-03-10T01:30:00-07:00",
+		},
+		{
+			name:       "after spring forward",
+			loggedAt:   time.Date(2024, 3, 10, 3, 30, 0, 0, denver),
+			viewer:     denver,
+			wantStored: "2024-03-10 09:30:00",
+			wantOffset: -360,
+			wantLocal:  "2024-03-10T03:30:00-06:00",
+		},
+		{
+			name:       "first 01:30 on fall back",
+			loggedAt:   time.Date(2024, 11, 3, 7, 30, 0, 0, time.UTC).In(denver),
+			viewer:     denver,
+			wantStored: "2024-11-03 07:30:00",
+			wantOffset: -360,
+			wantLocal:  "2024-11-03T01:30:00-06:00",
+		},
+		{
+			name:       "second 01:30 on fall back",
+			loggedAt:   time.Date(2024, 11, 3, 8, 30, 0, 0, time.UTC).In(denver),
+			viewer:     denver,
+			wantStored: "2024-11-03 08:30:00",
+			wantOffset: -420,
+			wantLocal:  "2024-11-03T01:30:00-07:00",
+		},
+		{
+			name:       "evening is the next UTC day",
+			loggedAt:   time.Date(2024, 2, 29, 20, 0, 0, 0, denver),
+			viewer:     denver,
+			wantStored: "2024-03-01 03:00:00",
+			wantOffset: -420,
+			wantLocal:  "2024-02-29T20:00:00-07:00",
+		},
+		{
+			name:       "morning is the previous UTC day",
+			loggedAt:   time.Date(2024, 3, 1, 8, 0, 0, 0, tokyo),
+			viewer:     tokyo,
+			wantStored: "2024-02-29 23:00:00",
+			wantOffset: 540,
+			wantLocal:  "2024-03-01T08:00:00+09:00",
+		},
+		{
+			name:       "viewed from another zone",
+			loggedAt:   time.Date(2024, 3, 1, 8, 0, 0, 0, tokyo),
+			viewer:     denver,
+			wantStored: "2024-02-29 23:00:00",
+			wantOffset: 540,
+			wantLocal:  "2024-02-29T16:00:00-07:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, offset := logTimeValues(tt.loggedAt)
+			if stored != tt.wantStored || offset != tt.wantOffset {
+				t.Fatalf("Expected %s at %d minutes, got %s at %d", tt.wantStored, tt.wantOffset, stored, offset)
+			}
+
+			symptomLog, err := scanSymptomLog(logRow{logTime: stored, offsetMinutes: offset})
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs := []SymptomLog{symptomLog}
+			LocalizeLogs(logs, tt.viewer)
+			if logs[0].LocalTime != tt.wantLocal {
+				t.Errorf("Expected local time %s, got %s", tt.wantLocal, logs[0].LocalTime)
+			}
+			if logs[0].UTCOffsetMinutes != tt.wantOffset {
+				t.Errorf("Expected offset %d, got %d", tt.wantOffset, logs[0].UTCOffsetMinutes)
+			}
+		})
+	}
+}
+
+func TestLocalizeLogsKeepsUnparseableTimes(t *testing.T) {
+	logs := []SymptomLog{{LogTime: "yesterday"}}
+	LocalizeLogs(logs, time.UTC)
+	if logs[0].LocalTime != "yesterday" {
+		t.Errorf("Expected yesterday, got %s", logs[0].LocalTime)
+	}
+}
@@ -0,0 +1,14 @@
+-- Cached OpenAI insights, one row per (user, tracker, medical type).
+-- logs_hash identifies the tracker state the insight was generated from.
+CREATE TABLE IF NOT EXISTS ai_insights (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    tracker_id INT NOT NULL,
+    medical_type VARCHAR(64) NOT NULL,
+    logs_hash CHAR(64) NOT NULL,
+    insight TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_ai_insights_user_tracker_type (user_id, tracker_id, medical_type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- One row per OpenAI call, used for per-user quotas and cost accounting.
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    tracker_id INT NOT NULL,
+    model VARCHAR(64) NOT NULL,
+    prompt_tokens INT NOT NULL,
+    completion_tokens INT NOT NULL,
+    cost_usd DECIMAL(12, 6) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_ai_usage_user_created (user_id, created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+-- PII categories a user chose to send to OpenAI unredacted.
+CREATE TABLE IF NOT EXISTS redaction_opt_outs (
+    user_id INT NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, category),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
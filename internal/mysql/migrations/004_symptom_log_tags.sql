@@ -0,0 +1,11 @@
+-- Keywords extracted from each log's notes by the note categorizer.
+CREATE TABLE IF NOT EXISTS symptom_log_tags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    log_id INT NOT NULL,
+    category VARCHAR(64) NOT NULL,
+    keyword VARCHAR(128) NOT NULL,
+    negated BOOLEAN NOT NULL DEFAULT FALSE,
+    KEY idx_symptom_log_tags_log (log_id),
+    KEY idx_symptom_log_tags_keyword (category, keyword),
+    FOREIGN KEY (log_id) REFERENCES symptom_logs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- Periods where a tracker's log frequency or severity spiked above the
+-- user's rolling baseline. Recomputed whenever the tracker gets a new log.
+CREATE TABLE IF NOT EXISTS flare_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    peak_logs INT NOT NULL,
+    peak_severity DECIMAL(10, 2) NOT NULL,
+    score DECIMAL(10, 2) NOT NULL,
+    detected_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_flare_events_tracker (tracker_id, start_date),
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+-- Users' IANA time zone, used for day bucketing and prompt rendering.
+ALTER TABLE users ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- log_time holds the UTC instant; utc_offset_minutes is the offset of the
+-- client that recorded it. Existing rows were written with CURRENT_TIMESTAMP
+-- in the RDS default UTC session zone, so they only need the default offset.
+ALTER TABLE symptom_logs ADD COLUMN utc_offset_minutes INT NOT NULL DEFAULT 0;
+
+-- Day and hour aggregation uses CONVERT_TZ with named zones, which needs the
+-- MySQL time zone tables (loaded by default on RDS). Verify with:
+--   SELECT CONVERT_TZ('2024-01-01 12:00:00', '+00:00', 'America/New_York');
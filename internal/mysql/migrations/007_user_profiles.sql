@@ -0,0 +1,15 @@
+-- Per-user profile and preferences. Names are seeded from Cognito when the
+-- user is created; time_zone stays on users since every query needs it.
+CREATE TABLE IF NOT EXISTS user_profiles (
+    user_id INT PRIMARY KEY,
+    first_name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    preferred_perspective VARCHAR(64) NOT NULL DEFAULT 'general',
+    units VARCHAR(16) NOT NULL DEFAULT 'metric',
+    reminders_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Local HH:MM in the user's time zone
+    reminder_time CHAR(5) NOT NULL DEFAULT '20:00',
+    weekly_summary BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,27 @@
+-- Medications, supplements and other interventions a user is trying for a
+-- tracker, and each time they took or did one.
+CREATE TABLE IF NOT EXISTS interventions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    -- medication, supplement, therapy, lifestyle or other
+    kind VARCHAR(32) NOT NULL DEFAULT 'medication',
+    dose VARCHAR(255) NOT NULL DEFAULT '',
+    -- Free text such as "twice daily" or "as needed"
+    schedule VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS intake_logs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    intervention_id INT NOT NULL,
+    -- UTC, like symptom_logs.log_time
+    taken_at DATETIME NOT NULL,
+    -- Overrides the intervention's dose when set
+    dose VARCHAR(255) NOT NULL DEFAULT '',
+    notes TEXT NOT NULL,
+    INDEX idx_intake_logs_taken_at (intervention_id, taken_at),
+    FOREIGN KEY (intervention_id) REFERENCES interventions(id) ON DELETE CASCADE
+);
@@ -0,0 +1,31 @@
+-- Typed custom fields a tracker asks for on every log (sleep hours, water,
+-- mood...) and the values logged for them.
+CREATE TABLE IF NOT EXISTS tracker_fields (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    -- number, boolean, enum, scale or text
+    field_type VARCHAR(16) NOT NULL,
+    unit VARCHAR(32) NOT NULL DEFAULT '',
+    -- JSON array of the allowed values of an enum field
+    options TEXT,
+    scale_min INT NOT NULL DEFAULT 0,
+    scale_max INT NOT NULL DEFAULT 0,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE KEY uq_tracker_fields_name (tracker_id, name),
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE
+);
+
+-- Exactly one of the value columns is set, depending on the field's type:
+-- number and scale use number_value, boolean bool_value, enum and text
+-- text_value.
+CREATE TABLE IF NOT EXISTS symptom_log_field_values (
+    log_id INT NOT NULL,
+    field_id INT NOT NULL,
+    number_value DECIMAL(14, 4) NULL,
+    bool_value BOOLEAN NULL,
+    text_value TEXT NULL,
+    PRIMARY KEY (log_id, field_id),
+    FOREIGN KEY (log_id) REFERENCES symptom_logs(id) ON DELETE CASCADE,
+    FOREIGN KEY (field_id) REFERENCES tracker_fields(id) ON DELETE CASCADE
+);
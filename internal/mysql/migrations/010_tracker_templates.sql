@@ -0,0 +1,6 @@
+-- The template a tracker was created from, if any, and the range of numeric
+-- severities its logs accept.
+ALTER TABLE trackers
+    ADD COLUMN template_id VARCHAR(64) NULL,
+    ADD COLUMN severity_min INT NOT NULL DEFAULT 1,
+    ADD COLUMN severity_max INT NOT NULL DEFAULT 10;
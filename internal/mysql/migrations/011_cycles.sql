@@ -0,0 +1,12 @@
+-- Menstrual cycles, one row per period. Dates are calendar days in the user's
+-- time zone; end_date stays NULL until the period is over.
+CREATE TABLE IF NOT EXISTS cycles (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NULL,
+    -- none, spotting, light, medium or heavy
+    flow VARCHAR(16) NOT NULL DEFAULT '',
+    UNIQUE KEY uq_cycles_start (user_id, start_date),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,37 @@
+-- Grants from a tracker's owner to another account. A share is addressed to
+-- an email until someone signed in with that email accepts it. Times are UTC.
+CREATE TABLE IF NOT EXISTS tracker_shares (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    grantee_email VARCHAR(255) NOT NULL,
+    -- Set when the invitation is accepted
+    grantee_id INT NULL,
+    -- read or comment
+    permission VARCHAR(16) NOT NULL,
+    created_at DATETIME NOT NULL,
+    accepted_at DATETIME NULL,
+    -- NULL means the share doesn't expire
+    expires_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    INDEX idx_tracker_shares_grantee (grantee_id, tracker_id),
+    INDEX idx_tracker_shares_email (grantee_email),
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (grantee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Comments on a tracker by its owner or grantees with comment access,
+-- optionally about a single log.
+CREATE TABLE IF NOT EXISTS tracker_comments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    symptom_log_id INT NULL,
+    author_id INT NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    INDEX idx_tracker_comments_tracker (tracker_id, created_at),
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE,
+    FOREIGN KEY (symptom_log_id) REFERENCES symptom_logs(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,34 @@
+-- Public, expiring links to a read-only report of one tracker over a date
+-- range, for clinicians without an account. Times are UTC.
+CREATE TABLE IF NOT EXISTS share_links (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tracker_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    -- Random value signed into the link's token
+    nonce CHAR(32) NOT NULL,
+    -- Inclusive calendar days in the owner's time zone
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    include_notes BOOLEAN NOT NULL DEFAULT FALSE,
+    -- bcrypt hash; NULL when no PIN is required
+    pin_hash VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    access_count INT NOT NULL DEFAULT 0,
+    last_accessed_at DATETIME NULL,
+    FOREIGN KEY (tracker_id) REFERENCES trackers(id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Every attempt to open a share link, including ones refused for a wrong PIN.
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    share_link_id INT NOT NULL,
+    accessed_at DATETIME NOT NULL,
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    granted BOOLEAN NOT NULL,
+    INDEX idx_share_link_accesses_link (share_link_id, accessed_at),
+    FOREIGN KEY (share_link_id) REFERENCES share_links(id) ON DELETE CASCADE
+);
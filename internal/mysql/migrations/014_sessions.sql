@@ -0,0 +1,19 @@
+-- Signed-in browsers and devices. The session cookie holds a random ID of
+-- which only the SHA-256 hash is stored; the identity provider's refresh
+-- token is AES-GCM encrypted. Times are UTC.
+CREATE TABLE IF NOT EXISTS sessions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL,
+    -- Identity provider username (users.cognito_sub) and token subject
+    username VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    refresh_token TEXT NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    UNIQUE KEY uq_sessions_token_hash (token_hash),
+    INDEX idx_sessions_username (username, revoked_at)
+);
@@ -0,0 +1,4 @@
+-- Wrong PINs over a share link's lifetime. Each attempt is counted before the
+-- PIN is checked and given back when it was right, so parallel guesses can't
+-- go over the limit; a link that reaches it is revoked.
+ALTER TABLE share_links ADD COLUMN pin_failures INT NOT NULL DEFAULT 0;
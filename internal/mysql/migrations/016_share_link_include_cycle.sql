@@ -0,0 +1,3 @@
+-- Whether a share link's report shows the owner's cycle day and phase. Like
+-- notes, cycle data is left out unless the owner opts in.
+ALTER TABLE share_links ADD COLUMN include_cycle BOOLEAN NOT NULL DEFAULT FALSE;
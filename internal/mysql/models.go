@@ -1,15 +1,35 @@
 package db
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type User struct {
 	ID         int    `json:"id"`
 	CognitoSub string `json:"cognito_sub"`
 	Email      string `json:"email"`
+	TimeZone   string `json:"time_zone"`
+}
+
+// Location returns the user's time zone, falling back to UTC.
+func (u User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil || u.TimeZone == "" {
+		return time.UTC
+	}
+	return loc
 }
 
 type Tracker struct {
 	ID          int    `json:"id"`
 	UserID      int    `json:"user_id"`
 	TrackerName string `json:"tracker_name"`
+	// TemplateID is the template the tracker was created from, if any
+	TemplateID string `json:"template_id,omitempty"`
+	// SeverityMin and SeverityMax bound numeric log severities, inclusive
+	SeverityMin int `json:"severity_min"`
+	SeverityMax int `json:"severity_max"`
 }
 
 type Symptom struct {
@@ -19,19 +39,63 @@ type Symptom struct {
 }
 
 type SymptomLog struct {
-	ID        int    `json:"id"`
-	UserID    int    `json:"user_id"`
-	TrackerID int    `json:"tracker_id"`
-	LogTime   string `json:"log_time"`
-	Severity  string `json:"severity"`
-	Symptoms  string `json:"symptoms"`
-	Notes     string `json:"notes"`
+	ID        int      `json:"id"`
+	UserID    int      `json:"user_id"`
+	TrackerID int      `json:"tracker_id"`
+	LogTime   string   `json:"log_time"`
+	Severity  string   `json:"severity"`
+	Symptoms  string   `json:"symptoms"`
+	Notes     string   `json:"notes"`
+	Tags      []LogTag `json:"tags"`
+	// Fields are the values logged for the tracker's custom fields
+	Fields []FieldValue `json:"fields"`
+	// UTCOffsetMinutes is the offset of the client that recorded the log
+	UTCOffsetMinutes int `json:"utc_offset_minutes"`
+	// LocalTime is LogTime in the viewing user's time zone
+	LocalTime string `json:"local_time,omitempty"`
+	// CycleDay and CyclePhase place the log in the user's menstrual cycle,
+	// when they track one
+	CycleDay   int    `json:"cycle_day,omitempty"`
+	CyclePhase string `json:"cycle_phase,omitempty"`
+}
+
+// LogTimeIn formats the log's UTC time in loc as RFC 3339, or returns
+// LogTime unchanged if it can't be parsed.
+func (l SymptomLog) LogTimeIn(loc *time.Location) string {
+	t, err := time.Parse(time.RFC3339, l.LogTime)
+	if err != nil {
+		return l.LogTime
+	}
+	return t.In(loc).Format(time.RFC3339)
 }
 
+// LocalizeLogs sets LocalTime on each log to its time in loc.
+func LocalizeLogs(logs []SymptomLog, loc *time.Location) {
+	for i := range logs {
+		logs[i].LocalTime = logs[i].LogTimeIn(loc)
+	}
+}
+
+type LogTag struct {
+	Category string `json:"category"`
+	Keyword  string `json:"keyword"`
+	Negated  bool   `json:"negated"`
+}
+
+type LogTagFilter struct {
+	Category string
+	Keyword  string
+	Negated  bool
+}
+
+// CompleteUser is the /make-user body. The email comes from the identity
+// provider, not the client.
 type CompleteUser struct {
-	Email    string   `json:"email"`
+	TimeZone string   `json:"time_zone"`
 	Tracker  string   `json:"tracker_name"`
 	Symptoms []string `json:"symptoms"`
+	// TemplateID optionally creates the first tracker from a template
+	TemplateID string `json:"template_id"`
 }
 
 type SymptomLogRequestBody struct {
@@ -39,12 +103,283 @@ type SymptomLogRequestBody struct {
 	SelectedSymptoms string `json:"selected_symptoms"`
 	Severity         string `json:"severity"`
 	Notes            string `json:"notes"`
-	UserID           int    `json:"user_id"`
-	TrackerID        int    `json:"tracker_id"`
+	// LogTime is an optional RFC 3339 time with the client's offset
+	LogTime string `json:"log_time"`
+	// Fields holds values for the tracker's custom fields, keyed by field name
+	Fields    map[string]json.RawMessage `json:"fields"`
+	UserID    int                        `json:"user_id"`
+	TrackerID int                        `json:"tracker_id"`
+	LoggedAt  time.Time                  `json:"-"`
 }
 
 type NewTrackerRequestBody struct {
 	TrackerName string   `json:"tracker_name"`
 	Symptoms    []string `json:"symptoms"`
+	TemplateID  string   `json:"template_id"`
 	UserID      int      `json:"user_id"`
 }
+
+type AIInsight struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	TrackerID   int    `json:"tracker_id"`
+	MedicalType string `json:"medical_type"`
+	LogsHash    string `json:"logs_hash"`
+	Insight     string `json:"insight"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type AIUsage struct {
+	UserID           int     `json:"user_id"`
+	TrackerID        int     `json:"tracker_id"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+type AIUsageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t AIUsageTotals) TotalTokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+type PeriodStat struct {
+	Period       string   `json:"period"`
+	Logs         int      `json:"logs"`
+	MeanSeverity *float64 `json:"mean_severity"`
+	MaxSeverity  *float64 `json:"max_severity"`
+}
+
+type DistributionStat struct {
+	Bucket       int      `json:"bucket"`
+	Logs         int      `json:"logs"`
+	MeanSeverity *float64 `json:"mean_severity"`
+}
+
+type FlareEvent struct {
+	ID           int     `json:"id"`
+	TrackerID    int     `json:"tracker_id"`
+	StartDate    string  `json:"start_date"`
+	EndDate      string  `json:"end_date"`
+	Reason       string  `json:"reason"`
+	PeakLogs     int     `json:"peak_logs"`
+	PeakSeverity float64 `json:"peak_severity"`
+	Score        float64 `json:"score"`
+	DetectedAt   string  `json:"detected_at"`
+}
+
+// UserProfile holds a user's name and preferences. TimeZone mirrors
+// users.time_zone.
+type UserProfile struct {
+	UserID               int    `json:"user_id"`
+	Email                string `json:"email"`
+	FirstName            string `json:"first_name"`
+	LastName             string `json:"last_name"`
+	TimeZone             string `json:"time_zone"`
+	PreferredPerspective string `json:"preferred_perspective"`
+	Units                string `json:"units"`
+	RemindersEnabled     bool   `json:"reminders_enabled"`
+	ReminderTime         string `json:"reminder_time"`
+	WeeklySummary        bool   `json:"weekly_summary"`
+}
+
+// Intervention is a medication, supplement or other remedy tried for a tracker.
+type Intervention struct {
+	ID        int    `json:"id"`
+	TrackerID int    `json:"tracker_id"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Dose      string `json:"dose"`
+	Schedule  string `json:"schedule"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+}
+
+// IntakeLog records one time an intervention was taken or done.
+type IntakeLog struct {
+	ID               int    `json:"id"`
+	InterventionID   int    `json:"intervention_id"`
+	InterventionName string `json:"intervention_name"`
+	// TakenAt is an RFC 3339 UTC instant
+	TakenAt   string `json:"taken_at"`
+	LocalTime string `json:"local_time,omitempty"`
+	// Dose is the intervention's dose unless overridden for this intake
+	Dose  string `json:"dose"`
+	Notes string `json:"notes"`
+}
+
+// TrackerField is a typed custom field logged alongside symptoms.
+type TrackerField struct {
+	ID        int    `json:"id"`
+	TrackerID int    `json:"tracker_id"`
+	Name      string `json:"name"`
+	// Type is one of number, boolean, enum, scale or text
+	Type string `json:"type"`
+	// Unit labels number fields, e.g. "hours" or "ml"
+	Unit string `json:"unit,omitempty"`
+	// Options are the allowed values of an enum field
+	Options []string `json:"options,omitempty"`
+	// ScaleMin and ScaleMax bound a scale field, inclusive
+	ScaleMin int  `json:"scale_min,omitempty"`
+	ScaleMax int  `json:"scale_max,omitempty"`
+	Required bool `json:"required"`
+}
+
+// FieldValue is a custom field's value on a log. Value is a float64 for
+// number and scale fields, a bool for boolean fields and a string otherwise.
+type FieldValue struct {
+	FieldID int    `json:"field_id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Unit    string `json:"unit,omitempty"`
+	Value   any    `json:"value"`
+}
+
+// Cycle is one menstrual period. Dates are YYYY-MM-DD in the user's time zone.
+type Cycle struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date,omitempty"`
+	Flow      string `json:"flow"`
+}
+
+// Share permissions, from least to most access.
+const (
+	SharePermissionRead    = "read"
+	SharePermissionComment = "comment"
+)
+
+// Share statuses, derived from the share's timestamps.
+const (
+	ShareStatusPending = "pending"
+	ShareStatusActive  = "active"
+	ShareStatusExpired = "expired"
+	ShareStatusRevoked = "revoked"
+)
+
+// TrackerShare grants another account access to one tracker. Times are
+// RFC 3339 UTC instants.
+type TrackerShare struct {
+	ID           int    `json:"id"`
+	TrackerID    int    `json:"tracker_id"`
+	TrackerName  string `json:"tracker_name"`
+	OwnerID      int    `json:"owner_id"`
+	OwnerEmail   string `json:"owner_email"`
+	GranteeEmail string `json:"grantee_email"`
+	// GranteeID is set once the invitation is accepted
+	GranteeID  int    `json:"grantee_id,omitempty"`
+	Permission string `json:"permission"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"created_at"`
+	AcceptedAt string `json:"accepted_at,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+}
+
+// StatusAt returns the share's status at now.
+func (s TrackerShare) StatusAt(now time.Time) string {
+	if s.RevokedAt != "" {
+		return ShareStatusRevoked
+	}
+	if expires, err := time.Parse(time.RFC3339, s.ExpiresAt); err == nil && !now.Before(expires) {
+		return ShareStatusExpired
+	}
+	if s.AcceptedAt == "" {
+		return ShareStatusPending
+	}
+	return ShareStatusActive
+}
+
+// TrackerComment is a note left on a tracker, optionally about one log.
+type TrackerComment struct {
+	ID           int    `json:"id"`
+	TrackerID    int    `json:"tracker_id"`
+	SymptomLogID int    `json:"symptom_log_id,omitempty"`
+	AuthorID     int    `json:"author_id"`
+	AuthorEmail  string `json:"author_email"`
+	Body         string `json:"body"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ShareLink is a public link to a read-only report of one tracker. Dates are
+// YYYY-MM-DD in the owner's time zone; times are RFC 3339 UTC instants.
+type ShareLink struct {
+	ID           int    `json:"id"`
+	TrackerID    int    `json:"tracker_id"`
+	TrackerName  string `json:"tracker_name"`
+	OwnerID      int    `json:"owner_id"`
+	Nonce        string `json:"-"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+	IncludeNotes bool   `json:"include_notes"`
+	// IncludeCycle shows the owner's cycle day and phase on each log
+	IncludeCycle bool   `json:"include_cycle"`
+	PINHash      string `json:"-"`
+	HasPIN       bool   `json:"has_pin"`
+	// PINFailures counts wrong PINs over the link's lifetime
+	PINFailures int    `json:"pin_failures"`
+	Status      string `json:"status"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at"`
+	RevokedAt   string `json:"revoked_at,omitempty"`
+	AccessCount int    `json:"access_count"`
+	// LastAccessedAt is the last time the report was shown
+	LastAccessedAt string `json:"last_accessed_at,omitempty"`
+	// Token is only filled in for the link's owner
+	Token string `json:"token,omitempty"`
+}
+
+// StatusAt returns the link's status at now: active, expired or revoked.
+func (l ShareLink) StatusAt(now time.Time) string {
+	if l.RevokedAt != "" {
+		return ShareStatusRevoked
+	}
+	if expires, err := time.Parse(time.RFC3339, l.ExpiresAt); err == nil && !now.Before(expires) {
+		return ShareStatusExpired
+	}
+	return ShareStatusActive
+}
+
+// ShareLinkAccess is one attempt to open a share link.
+type ShareLinkAccess struct {
+	ShareLinkID int    `json:"share_link_id"`
+	AccessedAt  string `json:"accessed_at"`
+	IPAddress   string `json:"ip_address"`
+	UserAgent   string `json:"user_agent"`
+	// Granted is false when the PIN was missing or wrong
+	Granted bool `json:"granted"`
+}
+
+// Session is a signed-in browser or device. Times are RFC 3339 UTC instants.
+type Session struct {
+	ID        int    `json:"id"`
+	TokenHash string `json:"-"`
+	Username  string `json:"-"`
+	Subject   string `json:"-"`
+	// RefreshToken is encrypted
+	RefreshToken string `json:"-"`
+	UserAgent    string `json:"user_agent"`
+	IPAddress    string `json:"ip_address"`
+	CreatedAt    string `json:"created_at"`
+	LastSeenAt   string `json:"last_seen_at"`
+	ExpiresAt    string `json:"expires_at"`
+	RevokedAt    string `json:"revoked_at,omitempty"`
+	// Current marks the session the request was made from
+	Current bool `json:"current"`
+}
+
+// ActiveAt reports whether the session can still be used at now.
+func (s Session) ActiveAt(now time.Time) bool {
+	if s.RevokedAt != "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err == nil && now.Before(expires)
+}
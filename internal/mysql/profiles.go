@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// DefaultProfile is the profile of a user who hasn't saved one yet.
+func DefaultProfile(user User) UserProfile {
+	return UserProfile{
+		UserID:               user.ID,
+		Email:                user.Email,
+		TimeZone:             user.TimeZone,
+		PreferredPerspective: "general",
+		Units:                "metric",
+		ReminderTime:         "20:00",
+	}
+}
+
+// GetUserProfile returns the user's profile, or DefaultProfile if none is saved.
+func (d *Database) GetUserProfile(user User) (UserProfile, error) {
+	profile := DefaultProfile(user)
+	query := `SELECT first_name, last_name, preferred_perspective, units,
+		reminders_enabled, reminder_time, weekly_summary
+		FROM user_profiles WHERE user_id = ?`
+	err := d.mysql.QueryRow(query, user.ID).Scan(
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.PreferredPerspective,
+		&profile.Units,
+		&profile.RemindersEnabled,
+		&profile.ReminderTime,
+		&profile.WeeklySummary,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return profile, nil
+	}
+	if err != nil {
+		return UserProfile{}, fmt.Errorf("error querying user profile: %w", err)
+	}
+	return profile, nil
+}
+
+// SaveUserProfile creates or replaces the profile, and updates the user's
+// time zone with it.
+func (d *Database) SaveUserProfile(profile UserProfile) error {
+	tx, err := d.mysql.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO user_profiles (user_id, first_name, last_name, preferred_perspective,
+			units, reminders_enabled, reminder_time, weekly_summary)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			first_name = VALUES(first_name),
+			last_name = VALUES(last_name),
+			preferred_perspective = VALUES(preferred_perspective),
+			units = VALUES(units),
+			reminders_enabled = VALUES(reminders_enabled),
+			reminder_time = VALUES(reminder_time),
+			weekly_summary = VALUES(weekly_summary)`,
+		profile.UserID,
+		profile.FirstName,
+		profile.LastName,
+		profile.PreferredPerspective,
+		profile.Units,
+		profile.RemindersEnabled,
+		profile.ReminderTime,
+		profile.WeeklySummary,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving user profile: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE users SET time_zone = ? WHERE id = ?`, profile.TimeZone, profile.UserID)
+	if err != nil {
+		return fmt.Errorf("error updating user time zone: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing user profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+)
+
+func (d *Database) GetRedactionOptOuts(userID int) ([]string, error) {
+	query := `SELECT category FROM redaction_opt_outs WHERE user_id = ? ORDER BY category`
+	rows, err := d.mysql.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying redaction opt-outs: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, fmt.Errorf("error scanning redaction opt-out: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// SetRedactionOptOuts replaces the user's opt-outs with categories.
+func (d *Database) SetRedactionOptOuts(userID int, categories []string) error {
+	tx, err := d.mysql.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM redaction_opt_outs WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting redaction opt-outs: %w", err)
+	}
+	for _, category := range categories {
+		_, err = tx.Exec(
+			`INSERT INTO redaction_opt_outs (user_id, category) VALUES (?, ?)`,
+			userID,
+			category,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting redaction opt-out: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing redaction opt-outs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sessionColumns is the column list scanSession expects.
+const sessionColumns = `id, token_hash, username, subject, refresh_token, user_agent, ip_address,
+	created_at, last_seen_at, expires_at, revoked_at`
+
+func (d *Database) CreateSession(session Session, now time.Time) (int, error) {
+	expiresAt, err := dateTimeValue(session.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO sessions
+		(token_hash, username, subject, refresh_token, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	createdAt := now.UTC().Format(time.DateTime)
+	result, err := d.mysql.Exec(
+		query,
+		session.TokenHash,
+		session.Username,
+		session.Subject,
+		session.RefreshToken,
+		session.UserAgent,
+		session.IPAddress,
+		createdAt,
+		createdAt,
+		expiresAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting session: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting session id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (d *Database) GetSessionByTokenHash(tokenHash string) (Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE token_hash = ?`
+	session, err := scanSession(d.mysql.QueryRow(query, tokenHash))
+	if err != nil {
+		return Session{}, fmt.Errorf("error querying session: %w", err)
+	}
+	return session, nil
+}
+
+func (d *Database) GetSessionByID(id int) (Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	session, err := scanSession(d.mysql.QueryRow(query, id))
+	if err != nil {
+		return Session{}, fmt.Errorf("error querying session: %w", err)
+	}
+	return session, nil
+}
+
+// GetActiveSessionsByUsername returns the user's unrevoked, unexpired
+// sessions, most recently used first.
+func (d *Database) GetActiveSessionsByUsername(username string, now time.Time) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE username = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC, id DESC`
+	rows, err := d.mysql.Query(query, username, now.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// TouchSession records that the session was just used, and from where.
+func (d *Database) TouchSession(id int, userAgent, ipAddress string, now time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = ?, user_agent = ?, ip_address = ? WHERE id = ?`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), userAgent, ipAddress, id)
+	if err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) RevokeSession(id int, now time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), id)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	return nil
+}
+
+// RevokeSessionsByUsername signs the user out of every session.
+func (d *Database) RevokeSessionsByUsername(username string, now time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE username = ? AND revoked_at IS NULL`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), username)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return nil
+}
+
+func scanSession(row scanner) (Session, error) {
+	var session Session
+	var createdAt, lastSeenAt, expiresAt string
+	var revokedAt sql.NullString
+	err := row.Scan(
+		&session.ID,
+		&session.TokenHash,
+		&session.Username,
+		&session.Subject,
+		&session.RefreshToken,
+		&session.UserAgent,
+		&session.IPAddress,
+		&createdAt,
+		&lastSeenAt,
+		&expiresAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return Session{}, err
+	}
+
+	times := []struct {
+		value  sql.NullString
+		target *string
+	}{
+		{sql.NullString{String: createdAt, Valid: true}, &session.CreatedAt},
+		{sql.NullString{String: lastSeenAt, Valid: true}, &session.LastSeenAt},
+		{sql.NullString{String: expiresAt, Valid: true}, &session.ExpiresAt},
+		{revokedAt, &session.RevokedAt},
+	}
+	for _, t := range times {
+		if *t.target, err = rfc3339Value(t.value); err != nil {
+			return Session{}, err
+		}
+	}
+	return session, nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionActiveAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		session Session
+		want    bool
+	}{
+		{"before expiry", Session{ExpiresAt: "2024-06-01T12:00:01Z"}, true},
+		{"expired", Session{ExpiresAt: "2024-06-01T12:00:00Z"}, false},
+		{"revoked", Session{ExpiresAt: "2024-07-01T00:00:00Z", RevokedAt: "2024-06-01T08:00:00Z"}, false},
+		{"no expiry", Session{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.session.ActiveAt(now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
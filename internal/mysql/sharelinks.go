@@ -0,0 +1,220 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// shareLinkColumns is the column list scanShareLink expects, selected from
+// shareLinkTables.
+const (
+	shareLinkColumns = `l.id, l.tracker_id, t.tracker_name, l.owner_id, l.nonce, l.start_date, l.end_date,
+		l.include_notes, l.include_cycle, l.pin_hash, l.pin_failures, l.created_at, l.expires_at, l.revoked_at, l.access_count,
+		l.last_accessed_at`
+	shareLinkTables = ` FROM share_links l JOIN trackers t ON t.id = l.tracker_id`
+)
+
+func (d *Database) CreateShareLink(link ShareLink, now time.Time) (int, error) {
+	expiresAt, err := dateTimeValue(link.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO share_links
+		(tracker_id, owner_id, nonce, start_date, end_date, include_notes, include_cycle, pin_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := d.mysql.Exec(
+		query,
+		link.TrackerID,
+		link.OwnerID,
+		link.Nonce,
+		link.StartDate,
+		link.EndDate,
+		link.IncludeNotes,
+		link.IncludeCycle,
+		nullString(link.PINHash),
+		now.UTC().Format(time.DateTime),
+		expiresAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting share link: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting share link id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (d *Database) GetShareLinkByID(id int, now time.Time) (ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + shareLinkTables + ` WHERE l.id = ?`
+	link, err := scanShareLink(d.mysql.QueryRow(query, id), now)
+	if err != nil {
+		return ShareLink{}, fmt.Errorf("error querying share link: %w", err)
+	}
+	return link, nil
+}
+
+// GetShareLinksByOwnerID returns the user's share links, newest first.
+func (d *Database) GetShareLinksByOwnerID(ownerID int, now time.Time) ([]ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + shareLinkTables + `
+		WHERE l.owner_id = ? ORDER BY l.created_at DESC`
+	rows, err := d.mysql.Query(query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows, now)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning share link: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (d *Database) RevokeShareLink(id int, now time.Time) error {
+	query := `UPDATE share_links SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), id)
+	if err != nil {
+		return fmt.Errorf("error revoking share link: %w", err)
+	}
+	return nil
+}
+
+// RecordShareLinkAccess logs an attempt to open a link and, when it was
+// granted, counts it against the link.
+func (d *Database) RecordShareLinkAccess(access ShareLinkAccess, now time.Time) error {
+	accessedAt := now.UTC().Format(time.DateTime)
+	query := `INSERT INTO share_link_accesses (share_link_id, accessed_at, ip_address, user_agent, granted)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err := d.mysql.Exec(query, access.ShareLinkID, accessedAt, access.IPAddress, access.UserAgent, access.Granted)
+	if err != nil {
+		return fmt.Errorf("error inserting share link access: %w", err)
+	}
+	if !access.Granted {
+		return nil
+	}
+
+	query = `UPDATE share_links SET access_count = access_count + 1, last_accessed_at = ? WHERE id = ?`
+	if _, err := d.mysql.Exec(query, accessedAt, access.ShareLinkID); err != nil {
+		return fmt.Errorf("error counting share link access: %w", err)
+	}
+	return nil
+}
+
+// ReserveShareLinkPINAttempt counts a wrong PIN against the link before the
+// PIN is checked, in the same statement that enforces maxFailures, so
+// parallel guesses can't get past the limit. It reports false when the link
+// is revoked or has no attempts left.
+func (d *Database) ReserveShareLinkPINAttempt(id, maxFailures int) (bool, error) {
+	query := `UPDATE share_links SET pin_failures = pin_failures + 1
+		WHERE id = ? AND revoked_at IS NULL AND pin_failures < ?`
+	result, err := d.mysql.Exec(query, id, maxFailures)
+	if err != nil {
+		return false, fmt.Errorf("error reserving share link pin attempt: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reserving share link pin attempt: %w", err)
+	}
+	return rows == 1, nil
+}
+
+// ReleaseShareLinkPINAttempt gives back an attempt whose PIN was right.
+func (d *Database) ReleaseShareLinkPINAttempt(id int) error {
+	query := `UPDATE share_links SET pin_failures = pin_failures - 1 WHERE id = ? AND pin_failures > 0`
+	if _, err := d.mysql.Exec(query, id); err != nil {
+		return fmt.Errorf("error releasing share link pin attempt: %w", err)
+	}
+	return nil
+}
+
+// RevokeExhaustedShareLink revokes the link if it has reached maxFailures
+// wrong PINs.
+func (d *Database) RevokeExhaustedShareLink(id, maxFailures int, now time.Time) error {
+	query := `UPDATE share_links SET revoked_at = ?
+		WHERE id = ? AND revoked_at IS NULL AND pin_failures >= ?`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), id, maxFailures)
+	if err != nil {
+		return fmt.Errorf("error revoking share link: %w", err)
+	}
+	return nil
+}
+
+// GetShareLinkAccesses returns the attempts to open a link, newest first.
+func (d *Database) GetShareLinkAccesses(linkID int) ([]ShareLinkAccess, error) {
+	query := `SELECT share_link_id, accessed_at, ip_address, user_agent, granted
+		FROM share_link_accesses WHERE share_link_id = ? ORDER BY accessed_at DESC, id DESC`
+	rows, err := d.mysql.Query(query, linkID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying share link accesses: %w", err)
+	}
+	defer rows.Close()
+
+	accesses := []ShareLinkAccess{}
+	for rows.Next() {
+		var access ShareLinkAccess
+		var accessedAt string
+		err := rows.Scan(&access.ShareLinkID, &accessedAt, &access.IPAddress, &access.UserAgent, &access.Granted)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning share link access: %w", err)
+		}
+		if access.AccessedAt, err = rfc3339Value(sql.NullString{String: accessedAt, Valid: true}); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, nil
+}
+
+// scanShareLink reads a row selected with shareLinkColumns and sets its
+// status as of now.
+func scanShareLink(row scanner, now time.Time) (ShareLink, error) {
+	var link ShareLink
+	var pinHash, revokedAt, lastAccessedAt sql.NullString
+	var createdAt, expiresAt string
+	err := row.Scan(
+		&link.ID,
+		&link.TrackerID,
+		&link.TrackerName,
+		&link.OwnerID,
+		&link.Nonce,
+		&link.StartDate,
+		&link.EndDate,
+		&link.IncludeNotes,
+		&link.IncludeCycle,
+		&pinHash,
+		&link.PINFailures,
+		&createdAt,
+		&expiresAt,
+		&revokedAt,
+		&link.AccessCount,
+		&lastAccessedAt,
+	)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	link.PINHash = pinHash.String
+	link.HasPIN = pinHash.Valid
+
+	times := []struct {
+		value  sql.NullString
+		target *string
+	}{
+		{sql.NullString{String: createdAt, Valid: true}, &link.CreatedAt},
+		{sql.NullString{String: expiresAt, Valid: true}, &link.ExpiresAt},
+		{revokedAt, &link.RevokedAt},
+		{lastAccessedAt, &link.LastAccessedAt},
+	}
+	for _, t := range times {
+		if *t.target, err = rfc3339Value(t.value); err != nil {
+			return ShareLink{}, err
+		}
+	}
+	link.Status = link.StatusAt(now)
+	return link, nil
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// trackerShareColumns is the column list scanTrackerShare expects, selected
+// from trackerShareTables.
+const (
+	trackerShareColumns = `s.id, s.tracker_id, t.tracker_name, s.owner_id, o.email, s.grantee_email,
+		s.grantee_id, s.permission, s.created_at, s.accepted_at, s.expires_at, s.revoked_at`
+	trackerShareTables = ` FROM tracker_shares s
+		JOIN trackers t ON t.id = s.tracker_id
+		JOIN users o ON o.id = s.owner_id`
+)
+
+// CreateTrackerShare stores a pending share. ExpiresAt is optional.
+func (d *Database) CreateTrackerShare(share TrackerShare, now time.Time) (int, error) {
+	expiresAt, err := dateTimeValue(share.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO tracker_shares (tracker_id, owner_id, grantee_email, permission, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := d.mysql.Exec(
+		query,
+		share.TrackerID,
+		share.OwnerID,
+		share.GranteeEmail,
+		share.Permission,
+		now.UTC().Format(time.DateTime),
+		expiresAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting tracker share: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting tracker share id: %w", err)
+	}
+	return int(id), nil
+}
+
+func (d *Database) GetTrackerShareByID(id int, now time.Time) (TrackerShare, error) {
+	query := `SELECT ` + trackerShareColumns + trackerShareTables + ` WHERE s.id = ?`
+	share, err := scanTrackerShare(d.mysql.QueryRow(query, id), now)
+	if err != nil {
+		return TrackerShare{}, fmt.Errorf("error querying tracker share: %w", err)
+	}
+	return share, nil
+}
+
+// GetTrackerSharesByOwnerID returns every share the user has created, newest
+// first.
+func (d *Database) GetTrackerSharesByOwnerID(ownerID int, now time.Time) ([]TrackerShare, error) {
+	query := `SELECT ` + trackerShareColumns + trackerShareTables + `
+		WHERE s.owner_id = ? ORDER BY s.created_at DESC`
+	return d.queryTrackerShares(now, query, ownerID)
+}
+
+// GetTrackerSharesForGrantee returns shares the user has accepted plus
+// invitations still addressed to email, newest first. Pass an empty email
+// when the user's address isn't verified to leave invitations out.
+func (d *Database) GetTrackerSharesForGrantee(userID int, email string, now time.Time) ([]TrackerShare, error) {
+	if email == "" {
+		query := `SELECT ` + trackerShareColumns + trackerShareTables + `
+			WHERE s.grantee_id = ? ORDER BY s.created_at DESC`
+		return d.queryTrackerShares(now, query, userID)
+	}
+	query := `SELECT ` + trackerShareColumns + trackerShareTables + `
+		WHERE s.grantee_id = ? OR (s.grantee_id IS NULL AND LOWER(s.grantee_email) = LOWER(?))
+		ORDER BY s.created_at DESC`
+	return d.queryTrackerShares(now, query, userID, email)
+}
+
+// GetActiveTrackerShare returns the accepted, unexpired and unrevoked share
+// of trackerID to granteeID, preferring comment access if there are several.
+func (d *Database) GetActiveTrackerShare(trackerID, granteeID int, now time.Time) (TrackerShare, error) {
+	query := `SELECT ` + trackerShareColumns + trackerShareTables + `
+		WHERE s.tracker_id = ? AND s.grantee_id = ?
+			AND s.accepted_at IS NOT NULL AND s.revoked_at IS NULL
+			AND (s.expires_at IS NULL OR s.expires_at > ?)
+		ORDER BY s.permission = ? DESC LIMIT 1`
+	share, err := scanTrackerShare(d.mysql.QueryRow(
+		query, trackerID, granteeID, now.UTC().Format(time.DateTime), SharePermissionComment,
+	), now)
+	if err != nil {
+		return TrackerShare{}, fmt.Errorf("error querying active tracker share: %w", err)
+	}
+	return share, nil
+}
+
+// AcceptTrackerShare claims a pending invitation for granteeID. It returns
+// false if the share was accepted, revoked or expired in the meantime.
+func (d *Database) AcceptTrackerShare(id, granteeID int, now time.Time) (bool, error) {
+	query := `UPDATE tracker_shares SET grantee_id = ?, accepted_at = ?
+		WHERE id = ? AND grantee_id IS NULL AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > ?)`
+	nowValue := now.UTC().Format(time.DateTime)
+	result, err := d.mysql.Exec(query, granteeID, nowValue, id, nowValue)
+	if err != nil {
+		return false, fmt.Errorf("error accepting tracker share: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error accepting tracker share: %w", err)
+	}
+	return rows == 1, nil
+}
+
+func (d *Database) RevokeTrackerShare(id int, now time.Time) error {
+	query := `UPDATE tracker_shares SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	_, err := d.mysql.Exec(query, now.UTC().Format(time.DateTime), id)
+	if err != nil {
+		return fmt.Errorf("error revoking tracker share: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) queryTrackerShares(now time.Time, query string, args ...any) ([]TrackerShare, error) {
+	rows, err := d.mysql.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tracker shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []TrackerShare{}
+	for rows.Next() {
+		share, err := scanTrackerShare(rows, now)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning tracker share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// scanTrackerShare reads a row selected with trackerShareColumns and sets
+// its status as of now.
+func scanTrackerShare(row scanner, now time.Time) (TrackerShare, error) {
+	var share TrackerShare
+	var granteeID sql.NullInt64
+	var createdAt string
+	var acceptedAt, expiresAt, revokedAt sql.NullString
+	err := row.Scan(
+		&share.ID,
+		&share.TrackerID,
+		&share.TrackerName,
+		&share.OwnerID,
+		&share.OwnerEmail,
+		&share.GranteeEmail,
+		&granteeID,
+		&share.Permission,
+		&createdAt,
+		&acceptedAt,
+		&expiresAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return TrackerShare{}, err
+	}
+	share.GranteeID = int(granteeID.Int64)
+
+	times := []struct {
+		value  sql.NullString
+		target *string
+	}{
+		{sql.NullString{String: createdAt, Valid: true}, &share.CreatedAt},
+		{acceptedAt, &share.AcceptedAt},
+		{expiresAt, &share.ExpiresAt},
+		{revokedAt, &share.RevokedAt},
+	}
+	for _, t := range times {
+		if *t.target, err = rfc3339Value(t.value); err != nil {
+			return TrackerShare{}, err
+		}
+	}
+	share.Status = share.StatusAt(now)
+	return share, nil
+}
+
+func (d *Database) CreateTrackerComment(comment TrackerComment, now time.Time) (int, error) {
+	query := `INSERT INTO tracker_comments (tracker_id, symptom_log_id, author_id, body, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+	symptomLogID := sql.NullInt64{Int64: int64(comment.SymptomLogID), Valid: comment.SymptomLogID != 0}
+	result, err := d.mysql.Exec(
+		query,
+		comment.TrackerID,
+		symptomLogID,
+		comment.AuthorID,
+		comment.Body,
+		now.UTC().Format(time.DateTime),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting tracker comment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting tracker comment id: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetTrackerCommentsByTrackerID returns a tracker's comments, oldest first.
+func (d *Database) GetTrackerCommentsByTrackerID(trackerID int) ([]TrackerComment, error) {
+	query := `SELECT c.id, c.tracker_id, c.symptom_log_id, c.author_id, u.email, c.body, c.created_at
+		FROM tracker_comments c JOIN users u ON u.id = c.author_id
+		WHERE c.tracker_id = ? ORDER BY c.created_at, c.id`
+	rows, err := d.mysql.Query(query, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tracker comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []TrackerComment{}
+	for rows.Next() {
+		var comment TrackerComment
+		var symptomLogID sql.NullInt64
+		var createdAt string
+		err := rows.Scan(
+			&comment.ID,
+			&comment.TrackerID,
+			&symptomLogID,
+			&comment.AuthorID,
+			&comment.AuthorEmail,
+			&comment.Body,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning tracker comment: %w", err)
+		}
+		comment.SymptomLogID = int(symptomLogID.Int64)
+		if comment.CreatedAt, err = rfc3339Value(sql.NullString{String: createdAt, Valid: true}); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// dateTimeValue converts an optional RFC 3339 instant to a UTC DATETIME.
+func dateTimeValue(value string) (sql.NullString, error) {
+	if value == "" {
+		return sql.NullString{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("error parsing time %q: %w", value, err)
+	}
+	return sql.NullString{String: t.UTC().Format(time.DateTime), Valid: true}, nil
+}
+
+// rfc3339Value converts an optional UTC DATETIME to an RFC 3339 instant.
+func rfc3339Value(value sql.NullString) (string, error) {
+	if !value.Valid {
+		return "", nil
+	}
+	t, err := time.Parse(time.DateTime, value.String)
+	if err != nil {
+		return "", fmt.Errorf("error parsing time %q: %w", value.String, err)
+	}
+	return t.Format(time.RFC3339), nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTrackerShareStatusAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		share TrackerShare
+		want  string
+	}{
+		{"pending", TrackerShare{}, ShareStatusPending},
+		{"accepted", TrackerShare{AcceptedAt: "2024-05-01T00:00:00Z"}, ShareStatusActive},
+		{
+			"accepted before expiry",
+			TrackerShare{AcceptedAt: "2024-05-01T00:00:00Z", ExpiresAt: "2024-06-01T12:00:01Z"},
+			ShareStatusActive,
+		},
+		{
+			"expired",
+			TrackerShare{AcceptedAt: "2024-05-01T00:00:00Z", ExpiresAt: "2024-06-01T12:00:00Z"},
+			ShareStatusExpired,
+		},
+		{"pending invitation expired", TrackerShare{ExpiresAt: "2024-05-01T00:00:00Z"}, ShareStatusExpired},
+		{
+			"revoked wins",
+			TrackerShare{AcceptedAt: "2024-05-01T00:00:00Z", ExpiresAt: "2024-05-02T00:00:00Z", RevokedAt: "2024-05-01T08:00:00Z"},
+			ShareStatusRevoked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.share.StatusAt(now); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDateTimeRoundTrip(t *testing.T) {
+	stored, err := dateTimeValue("2024-06-01T14:30:00+02:00")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !stored.Valid || stored.String != "2024-06-01 12:30:00" {
+		t.Errorf("Expected UTC DATETIME, got %+v", stored)
+	}
+
+	got, err := rfc3339Value(stored)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "2024-06-01T12:30:00Z" {
+		t.Errorf("Expected 2024-06-01T12:30:00Z, got %s", got)
+	}
+
+	if empty, _ := dateTimeValue(""); empty.Valid {
+		t.Errorf("Expected NULL for an empty time")
+	}
+	if got, _ := rfc3339Value(sql.NullString{}); got != "" {
+		t.Errorf("Expected empty string for NULL, got %q", got)
+	}
+}
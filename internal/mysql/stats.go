@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// localLogs selects a tracker's logs with log_time converted from UTC to the
+// user's time zone as local_time. Its parameters are the zone and tracker ID.
+const localLogs = `(SELECT CONVERT_TZ(log_time, '+00:00', ?) AS local_time, severity
+	FROM symptom_logs WHERE tracker_id = ?) logs`
+
+// numericSeverity is NULL for logs whose severity isn't a number, so they are
+// counted but left out of severity averages.
+const numericSeverity = `CASE WHEN severity REGEXP '^[0-9]+(\\.[0-9]+)?$'
+	THEN CAST(severity AS DECIMAL(10, 2)) END`
+
+// Bucket expressions for GetLogStatsByPeriod
+var periodBuckets = map[string]string{
+	"day":   `DATE_FORMAT(local_time, '%Y-%m-%d')`,
+	"week":  `DATE_FORMAT(DATE_SUB(DATE(local_time), INTERVAL WEEKDAY(local_time) DAY), '%Y-%m-%d')`,
+	"month": `DATE_FORMAT(local_time, '%Y-%m')`,
+}
+
+// GetLogStatsByPeriod counts a tracker's logs and summarizes their severity
+// per day, week (starting Monday) or month in the IANA zone timeZone.
+func (d *Database) GetLogStatsByPeriod(trackerID int, timeZone, period string) ([]PeriodStat, error) {
+	bucket, ok := periodBuckets[period]
+	if !ok {
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+
+	query := `SELECT ` + bucket + ` AS bucket, COUNT(*), AVG(` + numericSeverity + `), MAX(` + numericSeverity + `)
+		FROM ` + localLogs + `
+		GROUP BY bucket
+		ORDER BY bucket`
+	rows, err := d.mysql.Query(query, timeZone, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying log stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []PeriodStat{}
+	for rows.Next() {
+		var stat PeriodStat
+		var mean, max sql.NullFloat64
+		if err := rows.Scan(&stat.Period, &stat.Logs, &mean, &max); err != nil {
+			return nil, fmt.Errorf("error scanning log stats: %w", err)
+		}
+		stat.MeanSeverity = nullFloat(mean)
+		stat.MaxSeverity = nullFloat(max)
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// GetLogDistribution counts a tracker's logs by local day of week (1 = Sunday,
+// as MySQL's DAYOFWEEK) or by local hour of day (0-23) in timeZone.
+func (d *Database) GetLogDistribution(trackerID int, timeZone, unit string) ([]DistributionStat, error) {
+	var bucket string
+	switch unit {
+	case "day_of_week":
+		bucket = `DAYOFWEEK(local_time)`
+	case "hour":
+		bucket = `HOUR(local_time)`
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", unit)
+	}
+
+	query := `SELECT ` + bucket + ` AS bucket, COUNT(*), AVG(` + numericSeverity + `)
+		FROM ` + localLogs + `
+		GROUP BY bucket
+		ORDER BY bucket`
+	rows, err := d.mysql.Query(query, timeZone, trackerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying log distribution: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []DistributionStat{}
+	for rows.Next() {
+		var stat DistributionStat
+		var mean sql.NullFloat64
+		if err := rows.Scan(&stat.Bucket, &stat.Logs, &mean); err != nil {
+			return nil, fmt.Errorf("error scanning log distribution: %w", err)
+		}
+		stat.MeanSeverity = nullFloat(mean)
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func nullFloat(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
+}
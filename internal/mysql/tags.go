@@ -0,0 +1,78 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attachTags loads the tags of every log in logs in a single query.
+func (d *Database) attachTags(logs []SymptomLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*SymptomLog, len(logs))
+	ids := make([]any, len(logs))
+	for i := range logs {
+		logs[i].Tags = []LogTag{}
+		byID[logs[i].ID] = &logs[i]
+		ids[i] = logs[i].ID
+	}
+
+	query := `SELECT log_id, category, keyword, negated FROM symptom_log_tags
+		WHERE log_id IN (?` + strings.Repeat(", ?", len(ids)-1) + `) ORDER BY id`
+	rows, err := d.mysql.Query(query, ids...)
+	if err != nil {
+		return fmt.Errorf("error querying symptom log tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var logID int
+		var tag LogTag
+		if err := rows.Scan(&logID, &tag.Category, &tag.Keyword, &tag.Negated); err != nil {
+			return fmt.Errorf("error scanning symptom log tag: %w", err)
+		}
+		if log, ok := byID[logID]; ok {
+			log.Tags = append(log.Tags, tag)
+		}
+	}
+	return nil
+}
+
+// GetSymptomLogsByTag returns a user's logs tagged with the filter's keyword
+// and/or category. Empty filter fields match anything.
+func (d *Database) GetSymptomLogsByTag(userID int, filter LogTagFilter) ([]SymptomLog, error) {
+	query := `SELECT ` + symptomLogColumns + ` FROM symptom_logs
+		WHERE user_id = ? AND id IN (
+			SELECT log_id FROM symptom_log_tags
+			WHERE (? = '' OR category = ?)
+				AND (? = '' OR keyword = ?)
+				AND negated = ?
+		)
+		ORDER BY log_time`
+	rows, err := d.mysql.Query(
+		query,
+		userID,
+		filter.Category, filter.Category,
+		filter.Keyword, filter.Keyword,
+		filter.Negated,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying symptom logs: %w", err)
+	}
+	defer rows.Close()
+
+	var symptomLogs []SymptomLog
+	for rows.Next() {
+		symptomLog, err := scanSymptomLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning symptom log: %w", err)
+		}
+		symptomLogs = append(symptomLogs, symptomLog)
+	}
+	if err := d.attachDetails(symptomLogs); err != nil {
+		return nil, err
+	}
+	return symptomLogs, nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AIUsageReader totals a user's OpenAI usage. ReserveAIUsage hands one to
+// its check that reads inside the reservation's transaction.
+type AIUsageReader interface {
+	GetAIUsageSince(userID int, since time.Time) (AIUsageTotals, error)
+}
+
+// ReserveAIUsage stores usage, an estimate for an OpenAI call about to be
+// made at now, if allow approves the user's usage so far. The user's row is
+// locked while allow runs, so parallel requests see each other's
+// reservations instead of all passing the same check. It returns the
+// reservation's ID, or false if allow refused.
+//
+// Times are written in UTC rather than left to CURRENT_TIMESTAMP, which
+// follows the session time zone, so GetAIUsageSince windows line up on any
+// server.
+func (d *Database) ReserveAIUsage(usage AIUsage, now time.Time, allow func(AIUsageReader) (bool, error)) (int, bool, error) {
+	tx, err := d.mysql.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`SELECT id FROM users WHERE id = ? FOR UPDATE`, usage.UserID).Scan(&userID)
+	if err != nil {
+		return 0, false, fmt.Errorf("error locking user for ai usage: %w", err)
+	}
+	ok, err := allow(txUsage{tx})
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	query := `INSERT INTO ai_usage (user_id, tracker_id, model, prompt_tokens, completion_tokens, cost_usd, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(
+		query,
+		usage.UserID,
+		usage.TrackerID,
+		usage.Model,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.CostUSD,
+		now.UTC().Format(time.DateTime),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("error inserting ai usage: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting ai usage id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("error committing ai usage: %w", err)
+	}
+	return int(id), true, nil
+}
+
+// SettleAIUsage replaces a reservation's estimate with what the call was
+// actually billed.
+func (d *Database) SettleAIUsage(id int, usage AIUsage) error {
+	query := `UPDATE ai_usage SET model = ?, prompt_tokens = ?, completion_tokens = ?, cost_usd = ?
+		WHERE id = ?`
+	_, err := d.mysql.Exec(
+		query,
+		usage.Model,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.CostUSD,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("error settling ai usage: %w", err)
+	}
+	return nil
+}
+
+// ReleaseAIUsage drops a reservation for a call that failed.
+func (d *Database) ReleaseAIUsage(id int) error {
+	if _, err := d.mysql.Exec(`DELETE FROM ai_usage WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("error releasing ai usage: %w", err)
+	}
+	return nil
+}
+
+// GetAIUsageSince totals a user's OpenAI usage from since (UTC) until now.
+func (d *Database) GetAIUsageSince(userID int, since time.Time) (AIUsageTotals, error) {
+	return aiUsageSince(d.mysql.QueryRow, userID, since)
+}
+
+// txUsage reads usage inside a transaction.
+type txUsage struct {
+	tx *sql.Tx
+}
+
+func (t txUsage) GetAIUsageSince(userID int, since time.Time) (AIUsageTotals, error) {
+	return aiUsageSince(t.tx.QueryRow, userID, since)
+}
+
+func aiUsageSince(queryRow func(query string, args ...any) *sql.Row, userID int, since time.Time) (AIUsageTotals, error) {
+	query := `SELECT COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)
+		FROM ai_usage
+		WHERE user_id = ? AND created_at >= ?`
+	row := queryRow(query, userID, since.UTC().Format(time.DateTime))
+	var totals AIUsageTotals
+	err := row.Scan(
+		&totals.Requests,
+		&totals.PromptTokens,
+		&totals.CompletionTokens,
+		&totals.CostUSD,
+	)
+	if err != nil {
+		return AIUsageTotals{}, fmt.Errorf("error scanning ai usage: %w", err)
+	}
+	return totals, nil
+}
@@ -0,0 +1,263 @@
+package openai
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultPromptTokenBudget = 6000
+
+// recentShare is the part of the log budget spent on verbatim logs once older
+// logs have to be summarized; the rest goes to the weekly summaries.
+const recentShare = 0.7
+
+// Layouts log times may arrive in, from MySQL DATETIME columns or API clients.
+var logTimeLayouts = []string{
+	time.DateTime,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+}
+
+// LoadPromptBudget reads OPENAI_PROMPT_TOKEN_BUDGET, the maximum number of
+// prompt tokens to spend on a single insight request.
+func LoadPromptBudget() int {
+	budget := envInt("OPENAI_PROMPT_TOKEN_BUDGET", defaultPromptTokenBudget)
+	if budget == 0 {
+		return defaultPromptTokenBudget
+	}
+	return budget
+}
+
+// EstimateTokens approximates how many tokens the model will see for text.
+// It assumes roughly four characters per token, which holds for English, and
+// never counts fewer than one token per word.
+func EstimateTokens(text string) int {
+	tokens := (utf8.RuneCountInString(text) + 3) / 4
+	if words := len(strings.Fields(text)); words > tokens {
+		tokens = words
+	}
+	return tokens
+}
+
+type datedLog struct {
+	SymptomLog
+	time  time.Time
+	dated bool
+}
+
+// buildLogSection renders logs oldest first. When they don't all fit in budget
+// the most recent logs are kept verbatim and older ones are folded into weekly
+// statistics, dropping the oldest weeks if even those don't fit.
+func buildLogSection(categorizer *Categorizer, logs []SymptomLog, budget int) string {
+	sorted := sortLogs(logs)
+
+	rendered := make([]string, len(sorted))
+	total := 0
+	for i, log := range sorted {
+		rendered[i] = formatLog(categorizer, i+1, log.SymptomLog)
+		total += EstimateTokens(rendered[i])
+	}
+	if total <= budget {
+		return strings.Join(rendered, "")
+	}
+
+	// Walk back from the newest log until the verbatim share is used up
+	recentBudget := int(float64(budget) * recentShare)
+	used := 0
+	cut := len(sorted)
+	for cut > 0 {
+		cost := EstimateTokens(rendered[cut-1])
+		if used+cost > recentBudget {
+			break
+		}
+		used += cost
+		cut--
+	}
+
+	return summarizeWeeks(categorizer, sorted[:cut], budget-used) + strings.Join(rendered[cut:], "")
+}
+
+// sortLogs orders logs chronologically. Logs whose time can't be parsed are
+// treated as the oldest and keep their original order.
+func sortLogs(logs []SymptomLog) []datedLog {
+	sorted := make([]datedLog, len(logs))
+	for i, log := range logs {
+		t, ok := ParseLogTime(log.LogTime)
+		sorted[i] = datedLog{SymptomLog: log, time: t, dated: ok}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].time.Before(sorted[j].time)
+	})
+	return sorted
+}
+
+// ParseLogTime parses a log time in any of the layouts logs are stored in.
+func ParseLogTime(value string) (time.Time, bool) {
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseSeverity parses a numeric severity; free-text severities aren't numbers.
+func ParseSeverity(value string) (float64, bool) {
+	severity, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, false
+	}
+	return severity, true
+}
+
+// SplitSymptoms splits a log's comma separated symptoms list.
+func SplitSymptoms(value string) []string {
+	var symptoms []string
+	for _, symptom := range strings.Split(value, ",") {
+		if symptom = strings.TrimSpace(symptom); symptom != "" {
+			symptoms = append(symptoms, symptom)
+		}
+	}
+	return symptoms
+}
+
+type weekSummary struct {
+	label string
+	logs  []datedLog
+}
+
+// summarizeWeeks aggregates logs into one block per week, newest weeks first
+// in priority, and renders as many as fit in budget in chronological order.
+func summarizeWeeks(categorizer *Categorizer, logs []datedLog, budget int) string {
+	if len(logs) == 0 {
+		return ""
+	}
+
+	var weeks []*weekSummary
+	byLabel := map[string]*weekSummary{}
+	for _, log := range logs {
+		label := "Undated logs"
+		if log.dated {
+			weekday := (int(log.time.Weekday()) + 6) % 7 // Monday is the first day
+			label = "Week of " + log.time.AddDate(0, 0, -weekday).Format(time.DateOnly)
+		}
+		week, ok := byLabel[label]
+		if !ok {
+			week = &weekSummary{label: label}
+			byLabel[label] = week
+			weeks = append(weeks, week)
+		}
+		week.logs = append(week.logs, log)
+	}
+
+	header := fmt.Sprintf("Summary of %d older logs, aggregated by week:\n\n", len(logs))
+	remaining := budget - EstimateTokens(header)
+
+	var blocks []string
+	omittedWeeks, omittedLogs := 0, 0
+	for i := len(weeks) - 1; i >= 0; i-- {
+		block := formatWeek(categorizer, weeks[i])
+		cost := EstimateTokens(block)
+		if cost > remaining {
+			omittedWeeks = i + 1
+			for _, week := range weeks[:i+1] {
+				omittedLogs += len(week.logs)
+			}
+			break
+		}
+		remaining -= cost
+		blocks = append([]string{block}, blocks...)
+	}
+
+	section := header
+	if omittedWeeks > 0 {
+		section += fmt.Sprintf(
+			"(%d earlier weeks with %d logs were omitted to keep the prompt short.)\n\n",
+			omittedWeeks,
+			omittedLogs,
+		)
+	}
+	return section + strings.Join(blocks, "")
+}
+
+func formatWeek(categorizer *Categorizer, week *weekSummary) string {
+	symptoms := map[string]int{}
+	keywords := map[string]int{}
+	severities := map[string]int{}
+	phases := map[string]int{}
+	var severityTotal, severityMax float64
+	severityCount := 0
+
+	for _, log := range week.logs {
+		for _, symptom := range SplitSymptoms(log.Symptoms) {
+			symptoms[symptom]++
+		}
+		for _, tag := range categorizer.Categorize(log.Notes) {
+			if !tag.Negated {
+				keywords[tag.Category+": "+tag.Keyword]++
+			}
+		}
+		if log.CyclePhase != "" {
+			phases[log.CyclePhase]++
+		}
+		if severity, ok := ParseSeverity(log.Severity); ok {
+			if severityCount == 0 || severity > severityMax {
+				severityMax = severity
+			}
+			severityTotal += severity
+			severityCount++
+		} else if log.Severity != "" {
+			severities[log.Severity]++
+		}
+	}
+
+	block := fmt.Sprintf("%s (%d logs):\n", week.label, len(week.logs))
+	if severityCount > 0 {
+		block += fmt.Sprintf(
+			"- Severity: average %.1f, max %g\n",
+			severityTotal/float64(severityCount),
+			severityMax,
+		)
+	}
+	if len(severities) > 0 {
+		block += fmt.Sprintf("- Severity levels: %s\n", topCounts(severities, 5))
+	}
+	if len(symptoms) > 0 {
+		block += fmt.Sprintf("- Most frequent symptoms: %s\n", topCounts(symptoms, 5))
+	}
+	if len(keywords) > 0 {
+		block += fmt.Sprintf("- Common note keywords: %s\n", topCounts(keywords, 8))
+	}
+	if len(phases) > 0 {
+		block += fmt.Sprintf("- Cycle phases: %s\n", topCounts(phases, 4))
+	}
+	return block + "\n"
+}
+
+// topCounts renders the n most frequent entries as "name (count)".
+func topCounts(counts map[string]int, n int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeLogs(days int) []SymptomLog {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	logs := make([]SymptomLog, days)
+	for i := range logs {
+		logs[i] = SymptomLog{
+			LogTime:  start.AddDate(0, 0, i).Format(time.DateTime),
+			Severity: fmt.Sprint(i%10 + 1),
+			Symptoms: "headache, nausea",
+			Notes:    "had spicy food and coffee for lunch, then a long walking break",
+		}
+	}
+	return logs
+}
+
+func testCategorizer(t *testing.T) *Categorizer {
+	categorizer, err := LoadCategorizer("")
+	if err != nil {
+		t.Fatalf("Failed to load categorizer: %v", err)
+	}
+	return categorizer
+}
+
+func TestBuildLogSectionFitsEverything(t *testing.T) {
+	logs := makeLogs(3)
+	section := buildLogSection(testCategorizer(t), logs, 10000)
+
+	if strings.Contains(section, "aggregated by week") {
+		t.Errorf("Expected no weekly summary when logs fit, got:\n%s", section)
+	}
+	for i := 1; i <= len(logs); i++ {
+		if !strings.Contains(section, fmt.Sprintf("Log #%d:", i)) {
+			t.Errorf("Expected Log #%d to be included verbatim", i)
+		}
+	}
+}
+
+func TestBuildLogSectionSummarizesOlderLogs(t *testing.T) {
+	logs := makeLogs(365)
+	budget := 2000
+	section := buildLogSection(testCategorizer(t), logs, budget)
+
+	if tokens := EstimateTokens(section); tokens > budget {
+		t.Errorf("Expected section within %d tokens, got %d", budget, tokens)
+	}
+	if !strings.Contains(section, "aggregated by week") {
+		t.Errorf("Expected older logs to be summarized by week")
+	}
+	if !strings.Contains(section, "Log #365:") {
+		t.Errorf("Expected the most recent log to be included verbatim")
+	}
+	if strings.Contains(section, "Log #1:") {
+		t.Errorf("Expected the oldest log to be summarized, not included verbatim")
+	}
+}
+
+func TestBuildPromptStaysWithinBudget(t *testing.T) {
+	perspectives, err := LoadPerspectives("")
+	if err != nil {
+		t.Fatalf("Failed to load perspectives: %v", err)
+	}
+	perspective, err := perspectives.Get("ayurveda")
+	if err != nil {
+		t.Fatalf("Failed to get perspective: %v", err)
+	}
+
+	budget := 3000
+	prompt := buildPrompt(InsightRequest{
+		Perspective: perspective,
+		Logs:        makeLogs(1000),
+		Categorizer: testCategorizer(t),
+	}, budget)
+
+	if tokens := EstimateTokens(perspective.SystemPrompt + prompt); tokens > budget {
+		t.Errorf("Expected prompt within %d tokens, got %d", budget, tokens)
+	}
+}
+
+func TestEstimateInsightTokens(t *testing.T) {
+	perspectives, err := LoadPerspectives("")
+	if err != nil {
+		t.Fatalf("Failed to load perspectives: %v", err)
+	}
+	perspective, err := perspectives.Get("general")
+	if err != nil {
+		t.Fatalf("Failed to get perspective: %v", err)
+	}
+	t.Setenv("OPENAI_PROMPT_TOKEN_BUDGET", "3000")
+
+	estimate := func(days int) int {
+		return EstimateInsightTokens(InsightRequest{
+			Perspective: perspective,
+			Logs:        makeLogs(days),
+			Categorizer: testCategorizer(t),
+		})
+	}
+
+	few, many := estimate(3), estimate(1000)
+	if few <= completionTokenAllowance || many <= few {
+		t.Errorf("Expected the estimate to grow with the logs, got %d then %d", few, many)
+	}
+	// The prompt is cut to the budget, so only the answer is on top of it
+	if limit := 3000 + completionTokenAllowance; many > limit {
+		t.Errorf("Expected at most %d tokens, got %d", limit, many)
+	}
+}
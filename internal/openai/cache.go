@@ -0,0 +1,38 @@
+package openai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// HashLogs returns a stable fingerprint of the logs and intakes a prompt is
+// built from, so an insight can be reused for as long as the tracker hasn't
+// changed. The perspective version is mixed in so template edits invalidate
+// old insights, and the user's redaction opt-outs so changing them doesn't
+// serve an insight redacted under the old settings.
+func HashLogs(perspective Perspective, logs []SymptomLog, intakes []Intake, optOut map[PIICategory]bool) (string, error) {
+	categories := []string{}
+	for category, opted := range optOut {
+		if opted {
+			categories = append(categories, string(category))
+		}
+	}
+	sort.Strings(categories)
+	if intakes == nil {
+		intakes = []Intake{}
+	}
+
+	data, err := json.Marshal(struct {
+		Logs    []SymptomLog `json:"logs"`
+		Intakes []Intake     `json:"intakes"`
+		OptOut  []string     `json:"opt_out"`
+	}{logs, intakes, categories})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(fmt.Sprintf("v%d:", perspective.Version)), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
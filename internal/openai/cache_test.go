@@ -0,0 +1,55 @@
+package openai
+
+import "testing"
+
+func TestHashLogsOptOut(t *testing.T) {
+	perspective := Perspective{Name: "general", Version: 1}
+	logs := []SymptomLog{{LogTime: "2024-03-01 08:00", Notes: "call 555-0100", Severity: "4"}}
+
+	hash := func(optOut map[PIICategory]bool) string {
+		t.Helper()
+		h, err := HashLogs(perspective, logs, nil, optOut)
+		if err != nil {
+			t.Fatalf("Failed to hash logs: %v", err)
+		}
+		return h
+	}
+
+	base := hash(nil)
+	if got := hash(map[PIICategory]bool{PIIPhone: false}); got != base {
+		t.Error("Expected a category left on to hash like no opt-outs")
+	}
+	phone := hash(map[PIICategory]bool{PIIPhone: true})
+	if phone == base {
+		t.Error("Expected opting out of a category to change the hash")
+	}
+	both := hash(map[PIICategory]bool{PIIPhone: true, PIIEmail: true})
+	if both == phone {
+		t.Error("Expected each opt-out to change the hash")
+	}
+	if got := hash(map[PIICategory]bool{PIIEmail: true, PIIPhone: true}); got != both {
+		t.Error("Expected the hash not to depend on map order")
+	}
+}
+
+func TestHashLogsIntakes(t *testing.T) {
+	perspective := Perspective{Name: "general", Version: 1}
+	logs := []SymptomLog{{LogTime: "2024-03-01 08:00", Notes: "headache", Severity: "4"}}
+
+	hash := func(intakes []Intake) string {
+		t.Helper()
+		h, err := HashLogs(perspective, logs, intakes, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash logs: %v", err)
+		}
+		return h
+	}
+
+	base := hash(nil)
+	if got := hash([]Intake{}); got != base {
+		t.Error("Expected no intakes to hash the same however they're passed")
+	}
+	if got := hash([]Intake{{TakenAt: "2024-03-01 07:00", Name: "Magnesium", Kind: "supplement"}}); got == base {
+		t.Error("Expected intakes to change the hash")
+	}
+}
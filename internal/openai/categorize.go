@@ -0,0 +1,299 @@
+package openai
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed categories.json
+var defaultCategories []byte
+
+// negationWindow is how many words after a cue like "no" are negated.
+const negationWindow = 3
+
+// Words that negate the keywords following them within the same clause
+var negationCues = map[string]bool{
+	"no": true, "not": true, "without": true, "never": true, "none": true,
+	"skip": true, "skipped": true, "avoid": true, "avoided": true,
+	"didn't": true, "don't": true, "doesn't": true, "haven't": true,
+	"hasn't": true, "wasn't": true, "weren't": true, "isn't": true,
+	"didnt": true, "dont": true, "cant": true, "can't": true,
+}
+
+// Words that negate the keyword right before them, as in "dairy free"
+var negationSuffixes = map[string]bool{
+	"free": true,
+}
+
+// Words that end a negation's scope, as in "no coffee but spicy food"
+var clauseBreaks = map[string]bool{
+	"but": true, "though": true, "although": true, "however": true,
+}
+
+// Irregular forms the suffix rules in stem can't reach
+var irregularStems = map[string]string{
+	"ate":   "eat",
+	"eaten": "eat",
+	"slept": "sleep",
+	"ran":   "run",
+	"swam":  "swim",
+	"drank": "drink",
+	"lying": "lie",
+	"lay":   "lie",
+	"did":   "do",
+	"felt":  "feel",
+}
+
+// Tag is a dictionary keyword found in a note.
+type Tag struct {
+	Category string `json:"category"`
+	Keyword  string `json:"keyword"`
+	Negated  bool   `json:"negated"`
+}
+
+type keyword struct {
+	category string
+	word     string
+	stems    []string
+}
+
+// Categorizer finds category keywords in free-text notes. Matching works on
+// whole words after stemming, so "fried" matches "fries" but "ate" doesn't
+// match "late", and keywords preceded by "no", "skipped" etc. are negated.
+type Categorizer struct {
+	keywords []keyword
+}
+
+// LoadCategorizer builds a categorizer from the embedded dictionaries plus,
+// when path is set, a JSON file mapping category names to extra keywords.
+// Categories in the file are merged into the defaults.
+func LoadCategorizer(path string) (*Categorizer, error) {
+	dictionaries := map[string][]string{}
+	if err := json.Unmarshal(defaultCategories, &dictionaries); err != nil {
+		return nil, fmt.Errorf("error parsing default categories: %w", err)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading categories %s: %w", path, err)
+		}
+		extra := map[string][]string{}
+		if err := json.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("error parsing categories %s: %w", path, err)
+		}
+		for category, words := range extra {
+			dictionaries[category] = append(dictionaries[category], words...)
+		}
+	}
+
+	return NewCategorizer(dictionaries), nil
+}
+
+// NewCategorizer builds a categorizer from category names mapped to keywords.
+func NewCategorizer(dictionaries map[string][]string) *Categorizer {
+	categories := make([]string, 0, len(dictionaries))
+	for category := range dictionaries {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	c := &Categorizer{}
+	seen := map[string]bool{}
+	for _, category := range categories {
+		for _, word := range dictionaries[category] {
+			word = strings.ToLower(strings.TrimSpace(word))
+			if word == "" || seen[category+"\x00"+word] {
+				continue
+			}
+			seen[category+"\x00"+word] = true
+
+			var stems []string
+			for _, token := range tokenize(word) {
+				stems = append(stems, stem(token.word))
+			}
+			c.keywords = append(c.keywords, keyword{category: category, word: word, stems: stems})
+		}
+	}
+	return c
+}
+
+// Categories returns the category names in the dictionaries.
+func (c *Categorizer) Categories() []string {
+	var categories []string
+	for _, kw := range c.keywords {
+		if len(categories) == 0 || categories[len(categories)-1] != kw.category {
+			categories = append(categories, kw.category)
+		}
+	}
+	return categories
+}
+
+// Categorize returns the keywords found in note, each keyword at most once
+// per negation state, in the order they first appear.
+func (c *Categorizer) Categorize(note string) []Tag {
+	tokens := tokenize(note)
+	stems := make([]string, len(tokens))
+	for i, token := range tokens {
+		stems[i] = stem(token.word)
+	}
+	negated := negations(tokens)
+
+	type match struct {
+		tag      Tag
+		position int
+	}
+	var matches []match
+	seen := map[Tag]bool{}
+	for _, kw := range c.keywords {
+		for i := 0; i+len(kw.stems) <= len(tokens); i++ {
+			if !stemsMatch(stems[i:i+len(kw.stems)], kw.stems) || !sameClause(tokens[i:i+len(kw.stems)]) {
+				continue
+			}
+			last := i + len(kw.stems) - 1
+			tag := Tag{
+				Category: kw.category,
+				Keyword:  kw.word,
+				Negated:  negated[i] || (last+1 < len(tokens) && negationSuffixes[tokens[last+1].word]),
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				matches = append(matches, match{tag: tag, position: i})
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].position < matches[j].position
+	})
+	tags := make([]Tag, len(matches))
+	for i, m := range matches {
+		tags[i] = m.tag
+	}
+	return tags
+}
+
+type token struct {
+	word string
+	// clause counts the punctuation and clause breaks before this token
+	clause int
+}
+
+// tokenize lowercases text and splits it into words, keeping apostrophes
+// inside words ("didn't") and recording clause boundaries.
+func tokenize(text string) []token {
+	var tokens []token
+	var word strings.Builder
+	clause := 0
+
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := strings.Trim(word.String(), "'")
+		word.Reset()
+		if w == "" {
+			return
+		}
+		if clauseBreaks[w] {
+			clause++
+			return
+		}
+		tokens = append(tokens, token{word: w, clause: clause})
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case r == '\'' || r == '’':
+			word.WriteRune('\'')
+		case unicode.IsSpace(r) || r == '-' || r == '/':
+			flush()
+		default:
+			flush()
+			clause++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// negations marks the tokens that fall within a negation cue's scope.
+func negations(tokens []token) []bool {
+	negated := make([]bool, len(tokens))
+	for i, t := range tokens {
+		if !negationCues[t.word] {
+			continue
+		}
+		for j := i + 1; j < len(tokens) && j <= i+negationWindow; j++ {
+			if tokens[j].clause != t.clause {
+				break
+			}
+			negated[j] = true
+		}
+	}
+	return negated
+}
+
+func stemsMatch(stems, keyword []string) bool {
+	for i := range keyword {
+		if stems[i] != keyword[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameClause(tokens []token) bool {
+	for _, t := range tokens[1:] {
+		if t.clause != tokens[0].clause {
+			return false
+		}
+	}
+	return true
+}
+
+// stem reduces a lowercase word to a rough root so inflections match:
+// "running" and "runs" become "run", "fried" and "fries" become "fry",
+// "exercised" and "exercise" become "exercis".
+func stem(word string) string {
+	if root, ok := irregularStems[word]; ok {
+		return root
+	}
+
+	switch {
+	case len(word) > 4 && (strings.HasSuffix(word, "ies") || strings.HasSuffix(word, "ied")):
+		word = word[:len(word)-3] + "y"
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		word = undouble(word[:len(word)-3])
+	case len(word) > 4 && strings.HasSuffix(word, "ed"):
+		word = undouble(word[:len(word)-2])
+	case len(word) > 4 && (strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes") ||
+		strings.HasSuffix(word, "xes") || strings.HasSuffix(word, "sses")):
+		word = word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us"):
+		word = word[:len(word)-1]
+	}
+
+	if len(word) > 3 && strings.HasSuffix(word, "e") {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble drops a doubled final consonant left by removing a suffix, as in
+// "running" -> "runn" -> "run".
+func undouble(word string) string {
+	n := len(word)
+	if n > 2 && word[n-1] == word[n-2] && !strings.ContainsRune("aeiouls", rune(word[n-1])) {
+		return word[:n-1]
+	}
+	return word
+}
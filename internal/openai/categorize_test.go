@@ -0,0 +1,72 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCategorize(t *testing.T) {
+	categorizer := NewCategorizer(map[string][]string{
+		"Food":        {"ate", "fried", "coffee", "dairy", "fast food"},
+		"Activity":    {"running", "lying down", "exercise"},
+		"Environment": {"hot", "pet"},
+	})
+
+	tests := []struct {
+		name     string
+		note     string
+		expected []Tag
+	}{
+		{
+			name:     "substrings are not words",
+			note:     "Took a photo late at the compete event",
+			expected: nil,
+		},
+		{
+			name: "inflections match",
+			note: "Ate fries after I ran, exercised later",
+			expected: []Tag{
+				{Category: "Food", Keyword: "ate"},
+				{Category: "Food", Keyword: "fried"},
+				{Category: "Activity", Keyword: "running"},
+				{Category: "Activity", Keyword: "exercise"},
+			},
+		},
+		{
+			name: "negation",
+			note: "No coffee today but a hot day, dairy-free lunch",
+			expected: []Tag{
+				{Category: "Food", Keyword: "coffee", Negated: true},
+				{Category: "Environment", Keyword: "hot"},
+				{Category: "Food", Keyword: "dairy", Negated: true},
+			},
+		},
+		{
+			name: "negation ends at punctuation",
+			note: "Didn't sleep. Lay down with the pets",
+			expected: []Tag{
+				{Category: "Activity", Keyword: "lying down"},
+				{Category: "Environment", Keyword: "pet"},
+			},
+		},
+		{
+			name: "multi-word keywords",
+			note: "Fast food again",
+			expected: []Tag{
+				{Category: "Food", Keyword: "fast food"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := categorizer.Categorize(tt.note)
+			if len(tags) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(tags, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package openai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// intakeShare is the most of the remaining prompt budget the intake history
+// may use, so it never crowds out the symptom logs.
+const intakeShare = 0.2
+
+// Intake is one time the user took a medication or did an intervention.
+type Intake struct {
+	TakenAt  string `json:"taken_at"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Dose     string `json:"dose"`
+	Schedule string `json:"schedule"`
+	Notes    string `json:"notes"`
+}
+
+// RedactIntakes masks PII in intake notes like RedactLogs does for symptom logs.
+func RedactIntakes(intakes []Intake, optOut map[PIICategory]bool) ([]Intake, RedactionReport) {
+	report := RedactionReport{}
+	redacted := make([]Intake, len(intakes))
+	for i, intake := range intakes {
+		notes, noteReport := Redact(intake.Notes, optOut)
+		for category, count := range noteReport {
+			report[category] += count
+		}
+		intake.Notes = notes
+		redacted[i] = intake
+	}
+	return redacted, report
+}
+
+// buildIntakeSection lists intakes oldest first. When they don't all fit in
+// budget the most recent are kept and older ones are counted per intervention.
+func buildIntakeSection(intakes []Intake, budget int) string {
+	if len(intakes) == 0 {
+		return ""
+	}
+
+	sorted := make([]Intake, len(intakes))
+	copy(sorted, intakes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := ParseLogTime(sorted[i].TakenAt)
+		b, _ := ParseLogTime(sorted[j].TakenAt)
+		return a.Before(b)
+	})
+
+	header := "Medications and interventions taken (compare them with the symptom logs to judge whether they helped):\n"
+	remaining := budget - EstimateTokens(header)
+
+	// Walk back from the newest intake until the budget is used up, leaving
+	// room for a one-line summary of the rest
+	summaryBudget := remaining / 5
+	var lines []string
+	cut := len(sorted)
+	for cut > 0 {
+		line := formatIntake(sorted[cut-1])
+		cost := EstimateTokens(line)
+		if cost > remaining-summaryBudget {
+			break
+		}
+		remaining -= cost
+		lines = append([]string{line}, lines...)
+		cut--
+	}
+
+	section := header
+	if cut > 0 {
+		counts := map[string]int{}
+		for _, intake := range sorted[:cut] {
+			counts[intake.Name]++
+		}
+		section += fmt.Sprintf("- Earlier, %d intakes: %s\n", cut, topCounts(counts, 10))
+	}
+	return section + strings.Join(lines, "") + "\n"
+}
+
+func formatIntake(intake Intake) string {
+	takenAt := intake.TakenAt
+	if t, ok := ParseLogTime(intake.TakenAt); ok {
+		takenAt = t.Format("Monday 2006-01-02 15:04 -07:00")
+	}
+	line := fmt.Sprintf("- %s: %s", takenAt, intake.Name)
+	if intake.Kind != "" {
+		line += " (" + intake.Kind + ")"
+	}
+	if intake.Dose != "" {
+		line += ", " + intake.Dose
+	}
+	if intake.Schedule != "" {
+		line += ", scheduled " + intake.Schedule
+	}
+	if intake.Notes != "" {
+		line += ". Notes: " + intake.Notes
+	}
+	return line + "\n"
+}
@@ -0,0 +1,54 @@
+package openai
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeIntakes(days int) []Intake {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	intakes := make([]Intake, days)
+	for i := range intakes {
+		intakes[i] = Intake{
+			TakenAt: start.AddDate(0, 0, i).Format(time.RFC3339),
+			Name:    "Ibuprofen",
+			Kind:    "medication",
+			Dose:    fmt.Sprintf("%dmg", 200+i),
+		}
+	}
+	return intakes
+}
+
+func TestBuildIntakeSectionFitsEverything(t *testing.T) {
+	section := buildIntakeSection(makeIntakes(3), 1000)
+
+	if strings.Contains(section, "Earlier,") {
+		t.Errorf("Expected no summary when intakes fit, got:\n%s", section)
+	}
+	if !strings.Contains(section, "Monday 2024-01-01 08:00 +00:00: Ibuprofen (medication), 200mg") {
+		t.Errorf("Expected the first intake verbatim, got:\n%s", section)
+	}
+}
+
+func TestBuildIntakeSectionSummarizesOlderIntakes(t *testing.T) {
+	budget := 200
+	section := buildIntakeSection(makeIntakes(100), budget)
+
+	if tokens := EstimateTokens(section); tokens > budget {
+		t.Errorf("Expected section within %d tokens, got %d", budget, tokens)
+	}
+	if !strings.Contains(section, "Ibuprofen (") || !strings.Contains(section, "Earlier,") {
+		t.Errorf("Expected older intakes to be counted, got:\n%s", section)
+	}
+	if !strings.Contains(section, "299mg") {
+		t.Errorf("Expected the most recent intake verbatim, got:\n%s", section)
+	}
+}
+
+func TestBuildIntakeSectionEmpty(t *testing.T) {
+	if section := buildIntakeSection(nil, 1000); section != "" {
+		t.Errorf("Expected no section without intakes, got %q", section)
+	}
+}
@@ -2,16 +2,20 @@ package openai
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 type SelectedTracker struct {
-	MedicalType string       `json:"medical_type"`
-	Logs        []SymptomLog `json:"logs"`
+	TrackerID    int    `json:"tracker_id"`
+	MedicalType  string `json:"medical_type"`
+	ForceRefresh bool   `json:"force_refresh"`
+	// Deprecated: Logs is the body clients sent before tracker_id. It's
+	// still answered, without caching, when tracker_id is missing.
+	Logs []SymptomLog `json:"logs"`
 }
 
 type SymptomLog struct {
@@ -19,18 +23,54 @@ type SymptomLog struct {
 	Notes    string `json:"notes"`
 	Severity string `json:"severity"`
 	Symptoms string `json:"symptoms"`
+	// CycleDay and CyclePhase are set when the user tracks a menstrual cycle
+	CycleDay   int    `json:"cycle_day,omitempty"`
+	CyclePhase string `json:"cycle_phase,omitempty"`
 }
 
-func Openaimain(medicalType string, logs []SymptomLog) (string, error) {
+// Completion is the model's answer along with the token usage it was billed for.
+type Completion struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Redactions       RedactionReport
+}
+
+// InsightRequest is everything needed to build an insights prompt.
+type InsightRequest struct {
+	Perspective Perspective
+	Logs        []SymptomLog
+	// Intakes are the medications and interventions taken over the same period
+	Intakes []Intake
+	// OptOut lists the PII categories the user wants sent unredacted
+	OptOut      map[PIICategory]bool
+	Categorizer *Categorizer
+}
+
+// Openaimain asks the model for insights on the request's logs. PII is masked
+// out of the notes first, except for the categories the user opted out of.
+func Openaimain(req InsightRequest) (Completion, error) {
 	client := openai.NewClient(os.Getenv("OPENAI_API"))
 
-	prompt := buildPrompt(medicalType, logs)
+	var redactions RedactionReport
+	req.Logs, redactions = RedactLogs(req.Logs, req.OptOut)
+	var intakeRedactions RedactionReport
+	req.Intakes, intakeRedactions = RedactIntakes(req.Intakes, req.OptOut)
+	for category, count := range intakeRedactions {
+		redactions[category] += count
+	}
+	prompt := buildPrompt(req, LoadPromptBudget())
 
 	resp, err := client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
 			Model: openai.GPT4oMini,
 			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: req.Perspective.SystemPrompt,
+				},
 				{
 					Role:    openai.ChatMessageRoleUser,
 					Content: prompt,
@@ -39,185 +79,102 @@ func Openaimain(medicalType string, logs []SymptomLog) (string, error) {
 		},
 	)
 	if err != nil {
-		return "", err
+		return Completion{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Completion{}, errors.New("no choices returned")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return Completion{
+		Content:          resp.Choices[0].Message.Content,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		Redactions:       redactions,
+	}, nil
 }
 
 // Helper function to create a dynamic prompt
-func buildPrompt(medicalType string, logs []SymptomLog) string {
+func buildPrompt(req InsightRequest, budget int) string {
+	perspective := req.Perspective
+
 	// Start building the prompt
-	prompt := fmt.Sprintf(
-		"You are a professional pattern tracker. Based on the following symptom logs and using knowledge from %s, provide insights and recommendations for me to discuss with my primary healthcare provider.\n\n",
-		medicalType,
+	header := fmt.Sprintf(
+		"Based on the following symptom logs and using knowledge from %s, provide insights and recommendations for me to discuss with my primary healthcare provider.\n\n",
+		perspective.Name,
 	)
 
-	// Add individual logs to the prompt
-	for i, log := range logs {
-		// Preprocess and structure the notes
-		structuredNotes := preprocessNotes(log.Notes)
-		prompt += fmt.Sprintf(
-			"Log #%d:\n- Time: %s\n- Severity: %s\n- Symptoms: %v\n- Notes: %s\n- Structured Notes: %s\n\n",
-			i+1,
-			log.LogTime,
-			log.Severity,
-			log.Symptoms,
-			log.Notes,
-			structuredNotes, // Adds structured notes to the prompt
-		)
-	}
-
 	// Add medical-specific recommendations
-	prompt += getMedicalRecommendations(medicalType)
+	footer := "\n" + perspective.Guidance
 
 	// Final instruction to the AI with a strict format
-	prompt += "\nThe response **must** be structured exactly as follows and should not include any other tags like <div>:\n"
-	prompt += "- Patterns observed:\n  - [Patterns]\n"
-	prompt += "- Recommendations:\n  - [Recommendations]\n"
-	prompt += "- Holistic Techniques:\n  - [Techniques]\n"
-	prompt += "\nMake sure the response includes these sections as bullet points only, with no additional HTML tags. "
-	prompt += "Each section should have one or more items formatted with a hyphen (-) and text.\n"
+	footer += "\nThe response **must** be structured exactly as follows and should not include any other tags like <div>:\n"
+	footer += "- Patterns observed:\n  - [Patterns]\n"
+	footer += "- Recommendations:\n  - [Recommendations]\n"
+	footer += "- Holistic Techniques:\n  - [Techniques]\n"
+	footer += "\nMake sure the response includes these sections as bullet points only, with no additional HTML tags. "
+	footer += "Each section should have one or more items formatted with a hyphen (-) and text.\n"
 
 	// Add final advisory paragraph
-	prompt += "\nEnd the response with the following text in a new paragraph:\n\n"
-	prompt += "It's always advisable to discuss these observations and recommendations with your healthcare provider before adopting any changes. Your healthcare provider can best guide you based on your constitution and specific health circumstances.\n\n"
+	footer += "\nEnd the response with the following text in a new paragraph:\n\n"
+	footer += "It's always advisable to discuss these observations and recommendations with your healthcare provider before adopting any changes. Your healthcare provider can best guide you based on your constitution and specific health circumstances.\n\n"
 
-	return prompt
-}
+	// Fit the logs into whatever budget the fixed parts leave over
+	remaining := budget - EstimateTokens(perspective.SystemPrompt) -
+		EstimateTokens(header) - EstimateTokens(footer)
 
-func getMedicalRecommendations(medicalType string) string {
-	var recommendations string
-
-	switch strings.ToLower(medicalType) {
-	case "ayurveda":
-		recommendations = `
-Ayurveda emphasizes balance between the body’s three doshas: Vata, Pitta, and Kapha. 
-- Consider how the logs reflect imbalances in these doshas (e.g., spicy food may aggravate Pitta, axiety for Vata, depression for Kapha).
-- Recommendations may include dietary changes such as avoiding hot and spicy foods for Pitta, grounding exercises for Vata, and avoiding heavy, cold foods for Kapha. Keep it related to their logs.
-- Ayurvedic herbs relevant to the symptoms may be suggested, such as ashwagandha for stress or triphala for digestion.
-- Consider the 20 quality gunas, the time of day, and the season for additional correlations.
-`
-	case "naturopathy":
-		recommendations = `
-Naturopathy focuses on the body's natural ability to heal.
-- Consider if the logs indicate lifestyle or dietary choices that might be contributing to the symptoms.
-- Recommendations may include emphasizing whole, organic foods, detoxifying the body, and reducing exposure to toxins or stress.
-- Supplements relevant to the symptoms, such as probiotics for gut health or vitamin D for mood, may be suggested.
-`
-	case "traditional chinese medicine":
-		recommendations = `
-Traditional Chinese Medicine (TCM) emphasizes balance in Qi (energy flow) and the role of yin and yang.
-- Look for patterns that may indicate Qi stagnation, heat, or dampness in the logs (e.g., feeling sluggish might indicate dampness, while hot weather or spicy food could indicate excess heat).
-- Recommendations may include dietary modifications like cooling foods (e.g., cucumber, mint) to balance excess heat, or warming herbs for cold conditions.
-- Acupuncture or herbal remedies like ginseng or licorice root may also be suggested.
-`
-	default:
-		recommendations = `
-No specific medical approach was selected. Provide general wellness advice such as maintaining a balanced diet, regular physical activity, and stress management techniques like mindfulness or yoga.
-`
-	}
+	intakes := buildIntakeSection(req.Intakes, int(float64(remaining)*intakeShare))
+	remaining -= EstimateTokens(intakes)
 
-	return recommendations
+	return header + buildLogSection(req.Categorizer, req.Logs, remaining) + intakes + footer
 }
 
-func preprocessNotes(note string) string {
-	foodKeywords := []string{
-		"food",
-		"ate",
-		"meal",
-		"dinner",
-		"lunch",
-		"breakfast",
-		"spicy",
-		"fried",
-		"sweet",
-		"dairy",
-		"coffee",
-		"alcohol",
-		"sour",
-		"bitter",
-		"salty",
-		"microwave",
-		"oven",
-		"fried",
-		"takeout",
-		"fast",
-		"snack",
-		"processed",
-	}
-	activityKeywords := []string{
-		"exercise",
-		"sleep",
-		"rest",
-		"stress",
-		"walking",
-		"lying down",
-		"work",
-		"study",
-		"meditation",
-		"yoga",
-		"running",
-		"swimming",
-		"cycling",
-		"weightlifting",
-		"dancing",
-		"hiking",
-		"climbing",
-		"stretching",
-		"pilates",
-		"aerobics",
-		"zumba",
-	}
-	environmentKeywords := []string{
-		"weather",
-		"humidity",
-		"temperature",
-		"hot",
-		"cold",
-		"rainy",
-		"dry",
-		"pollen",
-		"dust",
-		"smoke",
-		"allergen",
-		"mold",
-		"pet",
-		"animal",
-		"insect",
-		"pest",
-		"chemical",
-		"cleaning",
+// formatLog renders a single log verbatim for the prompt
+func formatLog(categorizer *Categorizer, number int, log SymptomLog) string {
+	// Preprocess and structure the notes
+	structuredNotes := preprocessNotes(categorizer, log.Notes)
+	// Show the user's local weekday and time so daily patterns read naturally
+	logTime := log.LogTime
+	if t, ok := ParseLogTime(log.LogTime); ok {
+		logTime = t.Format("Monday 2006-01-02 15:04 -07:00")
 	}
-
-	// Create a map of categories to match against notes
-	categoryKeywords := map[string][]string{
-		"Food":        foodKeywords,
-		"Activity":    activityKeywords,
-		"Environment": environmentKeywords,
+	cycle := ""
+	if log.CyclePhase != "" {
+		cycle = fmt.Sprintf("- Cycle: day %d (%s phase)\n", log.CycleDay, log.CyclePhase)
 	}
+	return fmt.Sprintf(
+		"Log #%d:\n- Time: %s\n%s- Severity: %s\n- Symptoms: %v\n- Notes: %s\n- Structured Notes: %s\n\n",
+		number,
+		logTime,
+		cycle,
+		log.Severity,
+		log.Symptoms,
+		log.Notes,
+		structuredNotes, // Adds structured notes to the prompt
+	)
+}
 
-	// Track matched keywords in the note
+// preprocessNotes summarizes the keywords found in a note for the prompt
+func preprocessNotes(categorizer *Categorizer, note string) string {
 	matchedCategories := map[string][]string{}
-
-	// Search for matches in the note text
-	for category, keywords := range categoryKeywords {
-		for _, keyword := range keywords {
-			if containsWord(note, keyword) {
-				matchedCategories[category] = append(matchedCategories[category], keyword)
-			}
+	absentCategories := map[string][]string{}
+	for _, tag := range categorizer.Categorize(note) {
+		if tag.Negated {
+			absentCategories[tag.Category] = append(absentCategories[tag.Category], tag.Keyword)
+		} else {
+			matchedCategories[tag.Category] = append(matchedCategories[tag.Category], tag.Keyword)
 		}
 	}
 
 	structuredSummary := "Detected Categories:\n"
-	for category, matches := range matchedCategories {
-		structuredSummary += fmt.Sprintf("- %s: %v\n", category, matches)
+	for _, category := range categorizer.Categories() {
+		if matches, ok := matchedCategories[category]; ok {
+			structuredSummary += fmt.Sprintf("- %s: %v\n", category, matches)
+		}
+		if absent, ok := absentCategories[category]; ok {
+			structuredSummary += fmt.Sprintf("- %s (explicitly absent): %v\n", category, absent)
+		}
 	}
 
 	return structuredSummary
 }
-
-// Helper function to check if a word is present in a string
-func containsWord(note string, word string) bool {
-	return strings.Contains(strings.ToLower(note), strings.ToLower(word))
-}
@@ -0,0 +1,113 @@
+package openai
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultPerspective is used when a request doesn't name a medical type.
+const DefaultPerspective = "general"
+
+var ErrUnknownPerspective = errors.New("unknown medical type")
+
+//go:embed perspectives/*.json
+var embeddedPerspectives embed.FS
+
+// Perspective is a medical tradition the insights can be written from.
+// Bump Version whenever the prompt text changes so cached insights built
+// from the old wording are regenerated.
+type Perspective struct {
+	Name         string `json:"name"`
+	Version      int    `json:"version"`
+	Description  string `json:"description"`
+	SystemPrompt string `json:"system_prompt"`
+	Guidance     string `json:"guidance"`
+}
+
+// Perspectives is the set of templates available to the insights endpoint.
+type Perspectives struct {
+	byName map[string]Perspective
+}
+
+// LoadPerspectives reads the embedded templates and, when dir is set, the
+// *.json files in dir. A file in dir replaces the embedded template with the
+// same name.
+func LoadPerspectives(dir string) (*Perspectives, error) {
+	p := &Perspectives{byName: map[string]Perspective{}}
+
+	if err := p.loadFS(embeddedPerspectives, "perspectives"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := p.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := p.byName[DefaultPerspective]; !ok {
+		return nil, fmt.Errorf("missing %q perspective", DefaultPerspective)
+	}
+	return p, nil
+}
+
+func (p *Perspectives) loadFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error listing perspectives: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("error reading perspective %s: %w", file, err)
+		}
+
+		var perspective Perspective
+		if err := json.Unmarshal(data, &perspective); err != nil {
+			return fmt.Errorf("error parsing perspective %s: %w", file, err)
+		}
+		perspective.Name = normalizePerspective(perspective.Name)
+		if perspective.Name == "" || perspective.Guidance == "" {
+			return fmt.Errorf("perspective %s needs a name and guidance", file)
+		}
+
+		p.byName[perspective.Name] = perspective
+	}
+	return nil
+}
+
+// Get looks up a perspective by name, case-insensitively. An empty name
+// selects DefaultPerspective.
+func (p *Perspectives) Get(name string) (Perspective, error) {
+	name = normalizePerspective(name)
+	if name == "" {
+		name = DefaultPerspective
+	}
+	perspective, ok := p.byName[name]
+	if !ok {
+		return Perspective{}, fmt.Errorf("%w: %q", ErrUnknownPerspective, name)
+	}
+	return perspective, nil
+}
+
+// List returns every perspective sorted by name.
+func (p *Perspectives) List() []Perspective {
+	perspectives := make([]Perspective, 0, len(p.byName))
+	for _, perspective := range p.byName {
+		perspectives = append(perspectives, perspective)
+	}
+	sort.Slice(perspectives, func(i, j int) bool {
+		return perspectives[i].Name < perspectives[j].Name
+	})
+	return perspectives
+}
+
+func normalizePerspective(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,176 @@
+package openai
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PIICategory is a kind of personal information masked out of notes before
+// they are sent to OpenAI.
+type PIICategory string
+
+const (
+	PIIEmail    PIICategory = "email"
+	PIIPhone    PIICategory = "phone"
+	PIIIDNumber PIICategory = "id_number"
+	PIIAddress  PIICategory = "address"
+	PIIName     PIICategory = "name"
+	PIILocation PIICategory = "location"
+)
+
+// PIICategories lists every category in the order the rules are applied.
+var PIICategories = []PIICategory{
+	PIIEmail,
+	PIIIDNumber,
+	PIIPhone,
+	PIIAddress,
+	PIIName,
+	PIILocation,
+}
+
+// ParsePIICategory validates a category name coming from a client.
+func ParsePIICategory(name string) (PIICategory, error) {
+	for _, category := range PIICategories {
+		if string(category) == strings.ToLower(strings.TrimSpace(name)) {
+			return category, nil
+		}
+	}
+	return "", fmt.Errorf("unknown PII category %q", name)
+}
+
+type redactionRule struct {
+	category PIICategory
+	pattern  *regexp.Regexp
+	// group is the submatch to mask; 0 masks the whole match
+	group int
+	// keep reports whether a matched value is a false positive
+	keep func(value string) bool
+}
+
+// Capitalized words after "in", "at" etc. that are dates, not places
+var notLocations = map[string]bool{
+	"january": true, "february": true, "march": true, "april": true,
+	"may": true, "june": true, "july": true, "august": true,
+	"september": true, "october": true, "november": true, "december": true,
+	"monday": true, "tuesday": true, "wednesday": true, "thursday": true,
+	"friday": true, "saturday": true, "sunday": true,
+	"i": true,
+}
+
+var redactionRules = []redactionRule{
+	{
+		category: PIIEmail,
+		pattern:  regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		// US social security and payment card numbers
+		category: PIIIDNumber,
+		pattern:  regexp.MustCompile(`\b(?:\d{3}-\d{2}-\d{4}|(?:\d[ -]?){12,15}\d)\b`),
+	},
+	{
+		category: PIIPhone,
+		pattern:  regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`),
+	},
+	{
+		category: PIIAddress,
+		pattern: regexp.MustCompile(
+			`\b\d{1,5}\s+(?:[A-Z][a-z]+\s+){1,3}` +
+				`(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl|Terrace|Circle)\b\.?`,
+		),
+	},
+	{
+		category: PIIName,
+		pattern:  regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.?\s+[A-Z][a-z]+(?:\s+[A-Z][a-z]+)?`),
+	},
+	{
+		// "my name is Sam", "my sister Jane", "a friend named Alex"
+		category: PIIName,
+		pattern: regexp.MustCompile(
+			`(?i:\b(?:my name is|named|called|my (?:wife|husband|partner|son|daughter|mom|mother|dad|father|sister|brother|friend|boss|coworker|roommate|doctor|kid|child))\s+)` +
+				`([A-Z][a-z]+(?:\s+[A-Z][a-z]+)?)`,
+		),
+		group: 1,
+		keep:  func(value string) bool { return notLocations[strings.ToLower(value)] },
+	},
+	{
+		category: PIILocation,
+		pattern:  regexp.MustCompile(`\b(?:[Ii]n|at|from|near|to|visited|visiting)\s+([A-Z][a-z]+(?:\s+[A-Z][a-z]+)*)`),
+		group:    1,
+		keep: func(value string) bool {
+			return notLocations[strings.ToLower(strings.Fields(value)[0])]
+		},
+	},
+}
+
+// RedactionReport counts how many values of each category were masked.
+type RedactionReport map[PIICategory]int
+
+func (r RedactionReport) Total() int {
+	total := 0
+	for _, count := range r {
+		total += count
+	}
+	return total
+}
+
+// String renders the counts for audit logging, never the values themselves.
+func (r RedactionReport) String() string {
+	parts := make([]string, 0, len(r))
+	for category, count := range r {
+		parts = append(parts, fmt.Sprintf("%s=%d", category, count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// Redact masks PII in text, skipping the categories in optOut.
+func Redact(text string, optOut map[PIICategory]bool) (string, RedactionReport) {
+	report := RedactionReport{}
+	for _, rule := range redactionRules {
+		if optOut[rule.category] {
+			continue
+		}
+		text = rule.apply(text, report)
+	}
+	return text, report
+}
+
+func (rule redactionRule) apply(text string, report RedactionReport) string {
+	placeholder := "[" + strings.ToUpper(string(rule.category)) + "]"
+	matches := rule.pattern.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var redacted strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[2*rule.group], match[2*rule.group+1]
+		if start < 0 || (rule.keep != nil && rule.keep(text[start:end])) {
+			continue
+		}
+		redacted.WriteString(text[last:start])
+		redacted.WriteString(placeholder)
+		last = end
+		report[rule.category]++
+	}
+	redacted.WriteString(text[last:])
+	return redacted.String()
+}
+
+// RedactLogs returns a copy of logs with PII masked out of the notes.
+func RedactLogs(logs []SymptomLog, optOut map[PIICategory]bool) ([]SymptomLog, RedactionReport) {
+	report := RedactionReport{}
+	redacted := make([]SymptomLog, len(logs))
+	for i, log := range logs {
+		notes, noteReport := Redact(log.Notes, optOut)
+		for category, count := range noteReport {
+			report[category] += count
+		}
+		log.Notes = notes
+		redacted[i] = log
+	}
+	return redacted, report
+}
@@ -0,0 +1,58 @@
+package openai
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		note     string
+		optOut   map[PIICategory]bool
+		expected string
+	}{
+		{
+			name:     "email and phone",
+			note:     "Called (555) 123-4567 and emailed jane.doe@example.com about it",
+			expected: "Called [PHONE] and emailed [EMAIL] about it",
+		},
+		{
+			name:     "names",
+			note:     "Saw Dr. Patel, then lunch with my sister Maria",
+			expected: "Saw [NAME], then lunch with my sister [NAME]",
+		},
+		{
+			name:     "address and location",
+			note:     "Moved to 42 Elm Street, the pollen in Denver is bad",
+			expected: "Moved to [ADDRESS], the pollen in [LOCATION] is bad",
+		},
+		{
+			name:     "dates are not locations",
+			note:     "Worse in March, better on Monday at home",
+			expected: "Worse in March, better on Monday at home",
+		},
+		{
+			name:     "id numbers",
+			note:     "SSN 123-45-6789 card 4111 1111 1111 1111",
+			expected: "SSN [ID_NUMBER] card [ID_NUMBER]",
+		},
+		{
+			name:     "opt out keeps category",
+			note:     "Flared up after hiking near Boulder with Dr Chen",
+			optOut:   map[PIICategory]bool{PIILocation: true},
+			expected: "Flared up after hiking near Boulder with [NAME]",
+		},
+		{
+			name:     "symptom notes are untouched",
+			note:     "Headache 7/10 after 2 coffees and 10000 steps",
+			expected: "Headache 7/10 after 2 coffees and 10000 steps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redacted, _ := Redact(tt.note, tt.optOut)
+			if redacted != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, redacted)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Default gpt-4o-mini pricing in USD per million tokens.
+const (
+	defaultInputCostPerMTok  = 0.15
+	defaultOutputCostPerMTok = 0.60
+)
+
+// completionTokenAllowance is held against the quota for the model's answer
+// until the call reports what it actually used.
+const completionTokenAllowance = 1000
+
+// Quota caps how many tokens a single user may spend. A zero limit means the
+// period is unlimited.
+type Quota struct {
+	DailyTokens   int
+	MonthlyTokens int
+}
+
+// Pricing is what the model costs in USD per million tokens.
+type Pricing struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// LoadQuota reads AI_DAILY_TOKEN_QUOTA and AI_MONTHLY_TOKEN_QUOTA.
+func LoadQuota() Quota {
+	return Quota{
+		DailyTokens:   envInt("AI_DAILY_TOKEN_QUOTA", 0),
+		MonthlyTokens: envInt("AI_MONTHLY_TOKEN_QUOTA", 0),
+	}
+}
+
+// LoadPricing reads OPENAI_INPUT_COST_PER_MTOK and OPENAI_OUTPUT_COST_PER_MTOK,
+// falling back to gpt-4o-mini list prices.
+func LoadPricing() Pricing {
+	return Pricing{
+		InputPerMTok:  envFloat("OPENAI_INPUT_COST_PER_MTOK", defaultInputCostPerMTok),
+		OutputPerMTok: envFloat("OPENAI_OUTPUT_COST_PER_MTOK", defaultOutputCostPerMTok),
+	}
+}
+
+// Cost estimates the USD cost of a completion.
+func (p Pricing) Cost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)*p.InputPerMTok/1e6 +
+		float64(completionTokens)*p.OutputPerMTok/1e6
+}
+
+// EstimateInsightTokens approximates what Openaimain will be billed for req,
+// so quota can be reserved before the call is made.
+func EstimateInsightTokens(req InsightRequest) int {
+	prompt := buildPrompt(req, LoadPromptBudget())
+	return EstimateTokens(req.Perspective.SystemPrompt) + EstimateTokens(prompt) + completionTokenAllowance
+}
+
+// DayStart returns the beginning of the UTC day containing t.
+func DayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// MonthStart returns the beginning of the UTC month containing t.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
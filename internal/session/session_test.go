@@ -0,0 +1,78 @@
+package session
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hash != HashToken(token) || hash == token {
+		t.Errorf("Expected the stored hash to differ from and match the token")
+	}
+	other, _, _ := NewToken()
+	if other == token {
+		t.Error("Expected random tokens")
+	}
+}
+
+func TestNewCipherKeyLength(t *testing.T) {
+	for name, key := range map[string]string{
+		"too short":  base64.StdEncoding.EncodeToString([]byte("short")),
+		"not base64": strings.Repeat("!", 44),
+		"empty":      "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewCipher(key); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	c, err := NewCipher(testKey)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	sealed, err := c.Seal("refresh-token", "session-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(sealed, "refresh-token") {
+		t.Error("Expected the sealed value not to contain the plaintext")
+	}
+	got, err := c.Open(sealed, "session-a")
+	if err != nil || got != "refresh-token" {
+		t.Fatalf("Expected refresh-token, got %q, %v", got, err)
+	}
+
+	otherKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 32)))
+	other, _ := NewCipher(otherKey)
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tests := map[string]struct {
+		cipher  *Cipher
+		sealed  string
+		context string
+	}{
+		"other session": {c, sealed, "session-b"},
+		"other key":     {other, sealed, "session-a"},
+		"tampered":      {c, base64.StdEncoding.EncodeToString(raw), "session-a"},
+		"garbage":       {c, "not sealed", "session-a"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tt.cipher.Open(tt.sealed, tt.context); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Expected ErrDecrypt, got %v", err)
+			}
+		})
+	}
+}
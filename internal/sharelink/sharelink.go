@@ -0,0 +1,103 @@
+// Package sharelink signs and verifies tokens for public tracker report links.
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLength is the shortest signing secret accepted, in bytes
+const minSecretLength = 32
+
+var (
+	// ErrInvalidLink means the token is malformed or its signature is wrong.
+	ErrInvalidLink = errors.New("invalid share link")
+	// ErrLinkExpired means the token was signed by us but has expired.
+	ErrLinkExpired = errors.New("share link expired")
+)
+
+// Claims identify the link a token opens. Nonce is stored with the link so a
+// token only matches the link it was issued for.
+type Claims struct {
+	LinkID    int
+	ExpiresAt time.Time
+	Nonce     string
+}
+
+// Signer issues and checks link tokens with an HMAC-SHA256 key.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer for secret, which must be at least 32 bytes.
+func NewSigner(secret string) (*Signer, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("share link secret must be at least %d bytes", minSecretLength)
+	}
+	return &Signer{key: []byte(secret)}, nil
+}
+
+// NewNonce returns a random hex nonce for a new link.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns a URL-safe token for claims.
+func (s *Signer) Sign(claims Claims) string {
+	payload := fmt.Sprintf("%d.%d.%s", claims.LinkID, claims.ExpiresAt.Unix(), claims.Nonce)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+// Verify checks token's signature and expiry and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidLink
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return Claims{}, ErrInvalidLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidLink
+	}
+	parts := strings.Split(string(payload), ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidLink
+	}
+	linkID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidLink
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidLink
+	}
+
+	claims := Claims{LinkID: linkID, ExpiresAt: time.Unix(expires, 0).UTC(), Nonce: parts[2]}
+	if !now.Before(claims.ExpiresAt) {
+		return claims, ErrLinkExpired
+	}
+	return claims, nil
+}
+
+func (s *Signer) mac(data string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package sharelink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := NewSigner(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	claims := Claims{LinkID: 42, ExpiresAt: now.Add(time.Hour), Nonce: "abc123"}
+
+	token := signer.Sign(claims)
+	got, err := signer.Verify(token, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != claims {
+		t.Errorf("Expected %+v, got %+v", claims, got)
+	}
+
+	if _, err := signer.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("Expected ErrLinkExpired, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	signer, _ := NewSigner(testSecret)
+	other, _ := NewSigner(strings.Repeat("x", 32))
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	token := signer.Sign(Claims{LinkID: 1, ExpiresAt: now.Add(time.Hour), Nonce: "n"})
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := other.Sign(Claims{LinkID: 2, ExpiresAt: now.Add(time.Hour), Nonce: "n"})
+
+	tests := map[string]string{
+		"wrong key":         forged,
+		"swapped payload":   strings.Split(forged, ".")[0] + "." + signature,
+		"missing signature": payload,
+		"garbage":           "not a token",
+		"empty":             "",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := signer.Verify(token, now); !errors.Is(err, ErrInvalidLink) {
+				t.Errorf("Expected ErrInvalidLink, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewSignerRequiresLongSecret(t *testing.T) {
+	if _, err := NewSigner("short"); err == nil {
+		t.Errorf("Expected an error for a short secret")
+	}
+}
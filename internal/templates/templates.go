@@ -0,0 +1,119 @@
+// Package templates provides the predefined trackers users can start from
+// during onboarding instead of building a tracker from scratch.
+package templates
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+var ErrUnknownTemplate = errors.New("unknown tracker template")
+
+//go:embed templates/*.json
+var embeddedTemplates embed.FS
+
+// SeverityScale is the inclusive range of numeric severities a tracker accepts.
+type SeverityScale struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Template is a ready-made tracker: a name, default symptoms, a severity
+// scale and custom fields.
+type Template struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Symptoms      []string          `json:"symptoms"`
+	SeverityScale SeverityScale     `json:"severity_scale"`
+	Fields        []db.TrackerField `json:"fields"`
+}
+
+// Library is the set of templates available to onboarding.
+type Library struct {
+	byID map[string]Template
+}
+
+// Load reads the embedded templates and, when dir is set, the *.json files in
+// dir. A file in dir replaces the embedded template with the same ID.
+func Load(dir string) (*Library, error) {
+	l := &Library{byID: map[string]Template{}}
+
+	if err := l.loadFS(embeddedTemplates, "templates"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := l.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *Library) loadFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error listing tracker templates: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("error reading tracker template %s: %w", file, err)
+		}
+
+		var template Template
+		if err := json.Unmarshal(data, &template); err != nil {
+			return fmt.Errorf("error parsing tracker template %s: %w", file, err)
+		}
+		template.ID = normalizeID(template.ID)
+		if template.ID == "" || template.Name == "" {
+			return fmt.Errorf("tracker template %s needs an id and name", file)
+		}
+		if template.SeverityScale.Min >= template.SeverityScale.Max {
+			return fmt.Errorf("tracker template %s has an invalid severity scale", file)
+		}
+		for i := range template.Fields {
+			if err := template.Fields[i].Validate(); err != nil {
+				return fmt.Errorf("tracker template %s: %w", file, err)
+			}
+		}
+
+		l.byID[template.ID] = template
+	}
+	return nil
+}
+
+// Get looks up a template by ID, case-insensitively.
+func (l *Library) Get(id string) (Template, error) {
+	template, ok := l.byID[normalizeID(id)]
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %q", ErrUnknownTemplate, id)
+	}
+	return template, nil
+}
+
+// List returns every template sorted by name.
+func (l *Library) List() []Template {
+	templates := make([]Template, 0, len(l.byID))
+	for _, template := range l.byID {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
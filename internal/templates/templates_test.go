@@ -0,0 +1,31 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadEmbeddedTemplates(t *testing.T) {
+	library, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+
+	for _, id := range []string{"migraine", "ibs", "eczema", "menstrual-cycle"} {
+		template, err := library.Get(id)
+		if err != nil {
+			t.Errorf("Expected template %q: %v", id, err)
+			continue
+		}
+		if len(template.Symptoms) == 0 || len(template.Fields) == 0 {
+			t.Errorf("Expected %q to have symptoms and fields", id)
+		}
+	}
+
+	if _, err := library.Get(" Migraine "); err != nil {
+		t.Errorf("Expected lookup to ignore case and spaces: %v", err)
+	}
+	if _, err := library.Get("gout"); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Expected ErrUnknownTemplate, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+)
+
+var interventionKinds = map[string]bool{
+	"medication": true,
+	"supplement": true,
+	"therapy":    true,
+	"lifestyle":  true,
+	"other":      true,
+}
+
+// interventionUpdate is the body of PATCH /interventions/{id}. Fields left out
+// are unchanged.
+type interventionUpdate struct {
+	Name     *string `json:"name"`
+	Kind     *string `json:"kind"`
+	Dose     *string `json:"dose"`
+	Schedule *string `json:"schedule"`
+	Active   *bool   `json:"active"`
+}
+
+func (c *config) getInterventions(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker := access.tracker
+
+	interventions, err := database.GetInterventionsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get interventions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(interventions)
+	if err != nil {
+		http.Error(w, "Failed to serialize interventions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createIntervention(w http.ResponseWriter, r *http.Request, user db.User) {
+	var intervention db.Intervention
+	if err := json.NewDecoder(r.Body).Decode(&intervention); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if intervention.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if intervention.Kind == "" {
+		intervention.Kind = "medication"
+	}
+	if !interventionKinds[intervention.Kind] {
+		http.Error(w, "Invalid intervention kind", http.StatusBadRequest)
+		return
+	}
+	intervention.Active = true
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	tracker, err := database.GetTrackerByIDAndUserID(intervention.TrackerID, user.ID)
+	if err != nil {
+		http.Error(w, "Tracker not found", http.StatusNotFound)
+		return
+	}
+	intervention.TrackerID = tracker.ID
+
+	id, err := database.CreateIntervention(intervention)
+	if err != nil {
+		http.Error(w, "Failed to create intervention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := database.GetInterventionByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get intervention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "Failed to serialize intervention", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+func (c *config) updateIntervention(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid intervention id", http.StatusBadRequest)
+		return
+	}
+
+	var update interventionUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	intervention, err := database.GetInterventionByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Intervention not found", http.StatusNotFound)
+		return
+	}
+
+	if update.Name != nil {
+		if *update.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		intervention.Name = *update.Name
+	}
+	if update.Kind != nil {
+		if !interventionKinds[*update.Kind] {
+			http.Error(w, "Invalid intervention kind", http.StatusBadRequest)
+			return
+		}
+		intervention.Kind = *update.Kind
+	}
+	if update.Dose != nil {
+		intervention.Dose = *update.Dose
+	}
+	if update.Schedule != nil {
+		intervention.Schedule = *update.Schedule
+	}
+	if update.Active != nil {
+		intervention.Active = *update.Active
+	}
+
+	if err := database.UpdateIntervention(intervention); err != nil {
+		http.Error(w, "Failed to update intervention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(intervention)
+	if err != nil {
+		http.Error(w, "Failed to serialize intervention", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) deleteIntervention(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid intervention id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	intervention, err := database.GetInterventionByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Intervention not found", http.StatusNotFound)
+		return
+	}
+
+	if err := database.DeleteIntervention(intervention.ID); err != nil {
+		http.Error(w, "Failed to delete intervention: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *config) getIntakeLogs(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+	tracker, owner := access.tracker, access.owner
+
+	intakes, err := database.GetIntakeLogsByTrackerID(tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get intake logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	db.LocalizeIntakeLogs(intakes, owner.Location())
+
+	jsonData, err := json.Marshal(intakes)
+	if err != nil {
+		http.Error(w, "Failed to serialize intake logs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createIntakeLog(w http.ResponseWriter, r *http.Request, user db.User) {
+	var intake db.IntakeLog
+	if err := json.NewDecoder(r.Body).Decode(&intake); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Intakes default to now; an explicit taken_at keeps its offset
+	takenAt := time.Now()
+	if intake.TakenAt != "" {
+		parsed, err := time.Parse(time.RFC3339, intake.TakenAt)
+		if err != nil {
+			http.Error(w, "taken_at must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		takenAt = parsed
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	intervention, err := database.GetInterventionByIDAndUserID(intake.InterventionID, user.ID)
+	if err != nil {
+		http.Error(w, "Intervention not found", http.StatusNotFound)
+		return
+	}
+	intake.InterventionID = intervention.ID
+
+	id, err := database.CreateIntakeLog(intake, takenAt)
+	if err != nil {
+		http.Error(w, "Failed to create intake log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := database.GetIntakeLogByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get intake log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created.LocalTime = takenAt.In(user.Location()).Format(time.RFC3339)
+
+	jsonData, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "Failed to serialize intake log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+func (c *config) deleteIntakeLog(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid intake log id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	intake, err := database.GetIntakeLogByIDAndUserID(id, user.ID)
+	if err != nil {
+		http.Error(w, "Intake log not found", http.StatusNotFound)
+		return
+	}
+
+	if err := database.DeleteIntakeLog(intake.ID); err != nil {
+		http.Error(w, "Failed to delete intake log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadIntakes returns a tracker's intake history for the insights prompt, with
+// times in loc and each intake's intervention details.
+func loadIntakes(database *db.Database, trackerID int, loc *time.Location) ([]openai.Intake, error) {
+	interventions, err := database.GetInterventionsByTrackerID(trackerID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]db.Intervention, len(interventions))
+	for _, intervention := range interventions {
+		byID[intervention.ID] = intervention
+	}
+
+	intakeLogs, err := database.GetIntakeLogsByTrackerID(trackerID)
+	if err != nil {
+		return nil, err
+	}
+	db.LocalizeIntakeLogs(intakeLogs, loc)
+
+	intakes := make([]openai.Intake, 0, len(intakeLogs))
+	for _, intakeLog := range intakeLogs {
+		intervention := byID[intakeLog.InterventionID]
+		intakes = append(intakes, openai.Intake{
+			TakenAt:  intakeLog.LocalTime,
+			Name:     intakeLog.InterventionName,
+			Kind:     intervention.Kind,
+			Dose:     intakeLog.Dose,
+			Schedule: intervention.Schedule,
+			Notes:    intakeLog.Notes,
+		})
+	}
+	return intakes, nil
+}
@@ -2,24 +2,54 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
+	// Embed the zone database so user time zones resolve on minimal images
+	_ "time/tzdata"
 
+	"github.com/ArvoyaDev/health-trackers-backend/internal/analysis"
 	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
 	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/session"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/sharelink"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/templates"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
-	"github.com/lestrrat-go/jwx/v2/jwk"
-	"github.com/lestrrat-go/jwx/v2/jwt"
 	"golang.org/x/time/rate"
 )
 
+// memoryIssuer is the iss claim of tokens from the in-memory identity
+// provider
+const memoryIssuer = "health-trackers-local"
+
 type config struct {
 	dataSourceName string
-	AuthClient     *auth.CognitoClient
+	AuthClient     auth.IdentityProvider
 	dbClientData   db.DBClientData
+	aiQuota        openai.Quota
+	aiPricing      openai.Pricing
+	perspectives   *openai.Perspectives
+	categorizer    *openai.Categorizer
+	flareOptions   analysis.FlareOptions
+	templates      *templates.Library
+	users          *userResolver
+	// shareLinks is nil when SHARE_LINK_SECRET isn't set
+	shareLinks *sharelink.Signer
+	tokens     *auth.TokenValidator
+	// oauth is nil when COGNITO_DOMAIN isn't set
+	oauth        *auth.OAuthClient
+	oauthLogins  *pendingLogins
+	postLoginURL string
+	// sessionCipher encrypts the refresh tokens stored with sessions
+	sessionCipher *session.Cipher
+	openSessions  func() (sessionDatabase, error)
+	openProfiles  func() (profileDatabase, error)
+	openLogs      func() (logDatabase, error)
 }
 
 func main() {
@@ -31,17 +61,116 @@ func main() {
 	}
 	dataSourceName := os.Getenv("AWS_DATABASE_URL")
 	port := os.Getenv("PORT")
-	authClient := auth.Init()
+	perspectives, err := openai.LoadPerspectives(os.Getenv("OPENAI_PERSPECTIVES_DIR"))
+	if err != nil {
+		log.Fatalf("Error loading medical perspectives: %v", err)
+	}
+	categorizer, err := openai.LoadCategorizer(os.Getenv("NOTE_CATEGORIES_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading note categories: %v", err)
+	}
+	trackerTemplates, err := templates.Load(os.Getenv("TRACKER_TEMPLATES_DIR"))
+	if err != nil {
+		log.Fatalf("Error loading tracker templates: %v", err)
+	}
 	clientData := db.DBClientData{
 		AwsRegion:   os.Getenv("AWS_REGION"),
 		DbName:      os.Getenv("DATABASE_NAME"),
 		DbUser:      os.Getenv("DATABASE_USER"),
 		RdsEndpoint: os.Getenv("RDS_ENDPOINT"),
 	}
+	var authClient auth.IdentityProvider
+	if os.Getenv("IDENTITY_PROVIDER") == "memory" {
+		authClient, err = auth.NewMemoryProvider(memoryIssuer, os.Getenv("COGNITO_APP_CLIENT_ID"), nil)
+		if err != nil {
+			log.Fatalf("Error setting up the in-memory identity provider: %v", err)
+		}
+		log.Printf("Using the in-memory identity provider; accounts are lost on restart")
+	} else {
+		authClient = auth.Init()
+	}
+	var shareLinks *sharelink.Signer
+	if secret := os.Getenv("SHARE_LINK_SECRET"); secret != "" {
+		shareLinks, err = sharelink.NewSigner(secret)
+		if err != nil {
+			log.Fatalf("Error setting up share links: %v", err)
+		}
+	} else {
+		log.Printf("SHARE_LINK_SECRET is not set; share links are disabled")
+	}
+
+	sessionCipher, err := session.NewCipher(os.Getenv("SESSION_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatalf("Error setting up sessions: SESSION_ENCRYPTION_KEY: %v", err)
+	}
+
+	var signingKeys auth.KeySource
+	issuer := os.Getenv("COGNITO_ISSUER")
+	if provider, ok := authClient.(*auth.MemoryProvider); ok {
+		// The in-memory provider signs its own tokens
+		signingKeys, issuer = provider, memoryIssuer
+	} else {
+		signingKeys, err = auth.NewJWKS(
+			context.Background(),
+			os.Getenv("AWS_TOKEN_SIGNING_KEY"),
+			auth.DefaultJWKSRefreshInterval,
+		)
+		if err != nil {
+			log.Fatalf("Error setting up signing keys: %v", err)
+		}
+	}
+	clockSkew := auth.DefaultClockSkew
+	if skew := os.Getenv("JWT_CLOCK_SKEW"); skew != "" {
+		clockSkew, err = time.ParseDuration(skew)
+		if err != nil || clockSkew < 0 {
+			log.Fatalf("Invalid JWT_CLOCK_SKEW: %q", skew)
+		}
+	}
+	if issuer == "" {
+		issuer = auth.CognitoIssuer(os.Getenv("AWS_REGION"), os.Getenv("COGNITO_USER_POOL_ID"))
+	}
+	validator := &auth.TokenValidator{
+		Keys:     signingKeys,
+		Issuer:   issuer,
+		ClientID: os.Getenv("COGNITO_APP_CLIENT_ID"),
+		Skew:     clockSkew,
+	}
+
+	var oauth *auth.OAuthClient
+	if domain := os.Getenv("COGNITO_DOMAIN"); domain != "" {
+		oauth = &auth.OAuthClient{
+			Domain:       domain,
+			ClientID:     os.Getenv("COGNITO_APP_CLIENT_ID"),
+			ClientSecret: os.Getenv("COGNITO_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OAUTH_REDIRECT_URL"),
+		}
+		if oauth.RedirectURL == "" || os.Getenv("OAUTH_POST_LOGIN_URL") == "" {
+			log.Fatal("COGNITO_DOMAIN requires OAUTH_REDIRECT_URL and OAUTH_POST_LOGIN_URL")
+		}
+	} else {
+		log.Printf("COGNITO_DOMAIN is not set; social login is disabled")
+	}
+
 	config := config{
 		dataSourceName: dataSourceName,
 		AuthClient:     authClient,
 		dbClientData:   clientData,
+		aiQuota:        openai.LoadQuota(),
+		aiPricing:      openai.LoadPricing(),
+		perspectives:   perspectives,
+		categorizer:    categorizer,
+		flareOptions:   analysis.LoadFlareOptions(),
+		templates:      trackerTemplates,
+		users:          newUserResolver(),
+		shareLinks:     shareLinks,
+		tokens:         validator,
+		oauth:          oauth,
+		oauthLogins:    newPendingLogins(),
+		postLoginURL:   os.Getenv("OAUTH_POST_LOGIN_URL"),
+		sessionCipher:  sessionCipher,
+		openSessions:   openSessionDatabase,
+		openProfiles:   openProfileDatabase,
+		openLogs:       openLogDatabase,
 	}
 
 	// Main router with subrouting
@@ -50,13 +179,54 @@ func main() {
 	// DB Mux & routes
 	dbMux := http.NewServeMux()
 
-	dbMux.HandleFunc("POST /openai", config.openai)
-	dbMux.HandleFunc("GET /user", config.getUser)
+	dbMux.HandleFunc("POST /openai", config.withUser(config.openai))
+	dbMux.HandleFunc("GET /ai-usage", config.withUser(config.getAIUsage))
+	dbMux.HandleFunc("GET /perspectives", config.getPerspectives)
+	dbMux.HandleFunc("GET /redaction-settings", config.withUser(config.getRedactionSettings))
+	dbMux.HandleFunc("POST /redaction-settings", config.withUser(config.updateRedactionSettings))
+	dbMux.HandleFunc("GET /user", config.withUser(config.getUser))
 	dbMux.HandleFunc("POST /make-user", config.createUser)
-	dbMux.HandleFunc("POST /make-tracker", config.createTracker)
-	dbMux.HandleFunc("POST /make-symptoms", config.createSymptoms)
-	dbMux.HandleFunc("POST /create-symptom-log", config.createSymptomLog)
-	dbMux.HandleFunc("GET /get-symptom-logs", config.getSymptomLogs)
+	dbMux.HandleFunc("POST /time-zone", config.withUser(config.updateTimeZone))
+	dbMux.HandleFunc("GET /profile", config.withUser(config.getProfile))
+	dbMux.HandleFunc("PATCH /profile", config.withUser(config.updateProfile))
+	dbMux.HandleFunc("POST /make-tracker", config.withUser(config.createTracker))
+	dbMux.HandleFunc("GET /tracker-templates", config.getTrackerTemplates)
+	dbMux.HandleFunc("POST /make-symptoms", config.withUser(config.createSymptoms))
+	dbMux.HandleFunc("POST /create-symptom-log", config.withUser(config.createSymptomLog))
+	dbMux.HandleFunc("GET /get-symptom-logs", config.withUser(config.getSymptomLogs))
+	dbMux.HandleFunc("GET /tracker-fields", config.withUser(config.getTrackerFields))
+	dbMux.HandleFunc("POST /tracker-fields", config.withUser(config.createTrackerField))
+	dbMux.HandleFunc("DELETE /tracker-fields/{id}", config.withUser(config.deleteTrackerField))
+	dbMux.HandleFunc("GET /interventions", config.withUser(config.getInterventions))
+	dbMux.HandleFunc("POST /interventions", config.withUser(config.createIntervention))
+	dbMux.HandleFunc("PATCH /interventions/{id}", config.withUser(config.updateIntervention))
+	dbMux.HandleFunc("DELETE /interventions/{id}", config.withUser(config.deleteIntervention))
+	dbMux.HandleFunc("GET /intake-logs", config.withUser(config.getIntakeLogs))
+	dbMux.HandleFunc("POST /intake-logs", config.withUser(config.createIntakeLog))
+	dbMux.HandleFunc("DELETE /intake-logs/{id}", config.withUser(config.deleteIntakeLog))
+	dbMux.HandleFunc("GET /cycles", config.withUser(config.getCycles))
+	dbMux.HandleFunc("POST /cycles", config.withUser(config.createCycle))
+	dbMux.HandleFunc("PATCH /cycles/{id}", config.withUser(config.updateCycle))
+	dbMux.HandleFunc("DELETE /cycles/{id}", config.withUser(config.deleteCycle))
+	dbMux.HandleFunc("GET /tracker-triggers", config.withUser(config.getTrackerTriggers))
+	dbMux.HandleFunc("GET /tracker-stats", config.withUser(config.getTrackerStats))
+	dbMux.HandleFunc("GET /tracker-flares", config.withUser(config.getTrackerFlares))
+
+	dbMux.HandleFunc("GET /shares", config.withUser(config.getTrackerShares))
+	dbMux.HandleFunc("POST /shares", config.withUser(config.createTrackerShare))
+	dbMux.HandleFunc("POST /shares/{id}/accept", config.withUser(config.acceptTrackerShare))
+	dbMux.HandleFunc("DELETE /shares/{id}", config.withUser(config.revokeTrackerShare))
+	dbMux.HandleFunc("GET /tracker-comments", config.withUser(config.getTrackerComments))
+	dbMux.HandleFunc("POST /tracker-comments", config.withUser(config.createTrackerComment))
+	dbMux.HandleFunc("GET /share-links", config.withUser(config.getShareLinks))
+	dbMux.HandleFunc("POST /share-links", config.withUser(config.createShareLink))
+	dbMux.HandleFunc("GET /share-links/{id}/accesses", config.withUser(config.getShareLinkAccesses))
+	dbMux.HandleFunc("DELETE /share-links/{id}", config.withUser(config.revokeShareLink))
+	dbMux.HandleFunc("GET /sessions", config.getSessions)
+	dbMux.HandleFunc("DELETE /sessions", config.revokeAllSessions)
+	dbMux.HandleFunc("DELETE /sessions/{id}", config.revokeSession)
+	dbMux.HandleFunc("GET /admin/users", requireRole(config.adminSearchUsers, auth.RoleAdmin))
+	dbMux.HandleFunc("GET /admin/users/{id}", requireRole(config.adminGetUser, auth.RoleAdmin))
 
 	dbMux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		state := os.Getenv("ENV")
@@ -64,11 +234,14 @@ func main() {
 		w.Write([]byte(state))
 	})
 
+	// Share links are public; the signed token is the credential
+	mainMux.HandleFunc("GET /share/{token}", config.viewShareLink)
+
 	mainMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 	})
 
-	authMux := TokenAuthMiddleware(dbMux)
+	authMux := TokenAuthMiddleware(validator, dbMux)
 
 	mainMux.Handle("/db/", http.StripPrefix("/db", authMux))
 
@@ -83,6 +256,11 @@ func main() {
 	cognitoMux.HandleFunc("POST /sign-out", config.SignOut)
 	cognitoMux.HandleFunc("POST /request-verification-code", config.RequestVerificationCode)
 	cognitoMux.HandleFunc("POST /sign-in", config.SignIn)
+	cognitoMux.HandleFunc("POST /respond-to-challenge", config.RespondToChallenge)
+	cognitoMux.HandleFunc("POST /mfa/totp/associate", config.AssociateTOTP)
+	cognitoMux.HandleFunc("POST /mfa/totp/verify", config.VerifyTOTP)
+	cognitoMux.HandleFunc("GET /oauth/start", config.oauthStart)
+	cognitoMux.HandleFunc("GET /oauth/callback", config.oauthCallback)
 	cognitoMux.HandleFunc("POST /forgot-password", config.ForgotPassword)
 	cognitoMux.HandleFunc("POST /confirm-forgot-password", config.ConfirmForgottenPassword)
 
@@ -115,8 +293,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST ")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Share-Pin")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -140,7 +318,7 @@ func rateLimitMiddleware(next http.Handler) http.HandlerFunc {
 	}
 }
 
-func TokenAuthMiddleware(next http.Handler) http.Handler {
+func TokenAuthMiddleware(validator *auth.TokenValidator, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -154,29 +332,32 @@ func TokenAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Fetch JWK set
-		keySet, err := jwk.Fetch(r.Context(), os.Getenv("AWS_TOKEN_SIGNING_KEY"))
-		if err != nil {
-			http.Error(w, "Error fetching keys", http.StatusInternalServerError)
+		// Verify signature, expiry, issuer, client_id and token_use
+		token, err := validator.Validate(r.Context(), []byte(splitAuthHeader[1]))
+		switch {
+		case errors.Is(err, auth.ErrNoSigningKeys):
+			log.Printf("Failed to get signing keys: %v", err)
+			http.Error(w, "Signing keys unavailable", http.StatusServiceUnavailable)
 			return
-		}
-
-		// Parse and validate token
-		token, err := jwt.Parse([]byte(splitAuthHeader[1]), jwt.WithKeySet(keySet))
-		if err != nil {
-			http.Error(w, "Error parsing token", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrTokenExpired):
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token_expired"`)
+			http.Error(w, "token_expired", http.StatusUnauthorized)
+			return
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="invalid_token"`)
+			http.Error(w, "invalid_token", http.StatusUnauthorized)
 			return
 		}
 
-		// Extract claims
-		claims := token.PrivateClaims()
-		if claims == nil {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		// Local users are keyed by the Cognito username
+		principal := auth.PrincipalFromToken(token)
+		if principal.Username == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="invalid_token"`)
+			http.Error(w, "invalid_token", http.StatusUnauthorized)
 			return
 		}
 
-		// Attach claims to request context
-		ctx := context.WithValue(r.Context(), "User-claims", claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// Attach the principal to the request context
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 	})
 }
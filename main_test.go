@@ -1,10 +1,30 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/session"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 func TestRateLimitMiddleware(t *testing.T) {
@@ -49,3 +69,1260 @@ func TestRateLimitMiddleware(t *testing.T) {
 
 	t.Logf("Success count: %d, Rate limit count: %d", successCount, rateLimitCount)
 }
+
+// testSigner signs tokens with an RSA key published by a local JWKS server.
+type testSigner struct {
+	server  *httptest.Server
+	key     jwk.Key
+	fetches atomic.Int32
+	down    atomic.Bool
+}
+
+func newTestSigner(t *testing.T, kid string) *testSigner {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatalf("Failed to create JWK: %v", err)
+	}
+	key.Set(jwk.KeyIDKey, kid)
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	s := &testSigner{key: key}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		if s.down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		public, _ := jwk.PublicKeyOf(s.key)
+		set := jwk.NewSet()
+		set.AddKey(public)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+const (
+	testIssuer   = "https://cognito-idp.us-east-1.amazonaws.com/us-east-1_test"
+	testClientID = "test-client"
+)
+
+// validator returns a token validator that trusts the signer's keys.
+func (s *testSigner) validator(t *testing.T) *auth.TokenValidator {
+	t.Helper()
+	keys, err := auth.NewJWKS(context.Background(), s.server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWKS: %v", err)
+	}
+	return &auth.TokenValidator{
+		Keys:     keys,
+		Issuer:   testIssuer,
+		ClientID: testClientID,
+		Skew:     auth.DefaultClockSkew,
+	}
+}
+
+// token signs an access token expiring at exp.
+func (s *testSigner) token(t *testing.T, exp time.Time) string {
+	t.Helper()
+	token, err := jwt.NewBuilder().
+		Issuer(testIssuer).
+		Claim("client_id", testClientID).
+		Claim("token_use", "access").
+		Claim("username", "test-user").
+		Expiration(exp).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to build token: %v", err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, s.key))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return string(signed)
+}
+
+func authorizedRequest(t *testing.T, handler http.Handler, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/db/user", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func authorizedStatus(t *testing.T, handler http.Handler, token string) int {
+	t.Helper()
+	return authorizedRequest(t, handler, token).Code
+}
+
+func TestTokenAuthMiddlewareCachesKeys(t *testing.T) {
+	signer := newTestSigner(t, "current")
+	handler := TokenAuthMiddleware(signer.validator(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok || principal.Username != "test-user" {
+			t.Errorf("Expected principal for test-user, got %+v", principal)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token := signer.token(t, time.Now().Add(time.Hour))
+	for i := 0; i < 5; i++ {
+		if status := authorizedStatus(t, handler, token); status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+	}
+	if fetches := signer.fetches.Load(); fetches != 1 {
+		t.Errorf("Expected keys to be fetched once, got %d fetches", fetches)
+	}
+}
+
+func TestTokenAuthMiddlewareRotatedKey(t *testing.T) {
+	signer := newTestSigner(t, "old")
+	handler := TokenAuthMiddleware(signer.validator(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Rotate to a new key that the cache hasn't seen
+	rotated := newTestSigner(t, "new")
+	signer.key = rotated.key
+	if status := authorizedStatus(t, handler, signer.token(t, time.Now().Add(time.Hour))); status != http.StatusOK {
+		t.Fatalf("Expected status 200 after rotation, got %d", status)
+	}
+	if fetches := signer.fetches.Load(); fetches != 2 {
+		t.Errorf("Expected a refetch for the new key, got %d fetches", fetches)
+	}
+}
+
+func TestTokenAuthMiddlewareNoKeys(t *testing.T) {
+	signer := newTestSigner(t, "current")
+	signer.down.Store(true)
+	handler := TokenAuthMiddleware(signer.validator(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Handler should not be reached without signing keys")
+	}))
+
+	if status := authorizedStatus(t, handler, signer.token(t, time.Now().Add(time.Hour))); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+}
+
+func TestTokenAuthMiddlewareRejections(t *testing.T) {
+	signer := newTestSigner(t, "current")
+	handler := TokenAuthMiddleware(signer.validator(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	other := newTestSigner(t, "current")
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"valid", signer.token(t, time.Now().Add(time.Hour)), http.StatusOK, ""},
+		{"expired", signer.token(t, time.Now().Add(-time.Hour)), http.StatusUnauthorized, "token_expired"},
+		{"wrong key", other.token(t, time.Now().Add(time.Hour)), http.StatusUnauthorized, "invalid_token"},
+		{"malformed", "not-a-token", http.StatusUnauthorized, "invalid_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := authorizedRequest(t, handler, tt.token)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if body := strings.TrimSpace(rec.Body.String()); body != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, body)
+			}
+			if header := rec.Header().Get("WWW-Authenticate"); !strings.Contains(header, tt.wantBody) {
+				t.Errorf("Expected WWW-Authenticate to mention %s, got %q", tt.wantBody, header)
+			}
+		})
+	}
+}
+
+func TestWithUser(t *testing.T) {
+	lookups := 0
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &config{users: &userResolver{
+		lookup: func(username string) (db.User, error) {
+			lookups++
+			if username != "test-user" {
+				return db.User{}, fmt.Errorf("error scanning user: %w", sql.ErrNoRows)
+			}
+			return db.User{ID: 7, CognitoSub: username}, nil
+		},
+		now:   func() time.Time { return now },
+		cache: make(map[string]cachedUser),
+	}}
+	handler := c.withUser(func(w http.ResponseWriter, r *http.Request, user db.User) {
+		if user.ID != 7 {
+			t.Errorf("Expected user 7, got %d", user.ID)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(principal *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		if principal != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), *principal))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := request(&auth.Principal{Username: "test-user"}); rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected the user to be looked up once, got %d", lookups)
+	}
+
+	// Cached rows expire and can be invalidated
+	now = now.Add(userCacheTTL)
+	request(&auth.Principal{Username: "test-user"})
+	c.users.invalidate("test-user")
+	request(&auth.Principal{Username: "test-user"})
+	if lookups != 3 {
+		t.Errorf("Expected expired and invalidated rows to be looked up again, got %d lookups", lookups)
+	}
+
+	rec := request(&auth.Principal{Username: "new-user"})
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for unknown user, got %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["error"] != "user_not_found" || body["onboarding"] == "" {
+		t.Errorf("Expected onboarding response, got %v", body)
+	}
+
+	if rec := request(nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a principal, got %d", rec.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := requireRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, auth.RoleAdmin)
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized},
+		{"plain user", &auth.Principal{Username: "patient"}, http.StatusForbidden},
+		{"other group", &auth.Principal{Username: "helper", Groups: []string{"support"}}, http.StatusForbidden},
+		{"admin", &auth.Principal{Username: "root", Groups: []string{"admin"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), *tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+// insightsByKey is an insightCache holding one stored insight per key.
+type insightsByKey map[string]string
+
+func (c insightsByKey) GetAIInsight(userID, trackerID int, medicalType, logsHash string) (db.AIInsight, error) {
+	insight, ok := c[fmt.Sprintf("%d/%d/%s/%s", userID, trackerID, medicalType, logsHash)]
+	if !ok {
+		return db.AIInsight{}, sql.ErrNoRows
+	}
+	return db.AIInsight{Insight: insight}, nil
+}
+
+func TestDistributionLabel(t *testing.T) {
+	tests := []struct {
+		unit   string
+		bucket int
+		want   string
+	}{
+		{"day_of_week", 1, "Sunday"},
+		{"day_of_week", 7, "Saturday"},
+		{"hour", 0, "00:00"},
+		{"hour", 23, "23:00"},
+	}
+	for _, tt := range tests {
+		if got := distributionLabel(tt.unit, tt.bucket); got != tt.want {
+			t.Errorf("Expected %s for %s %d, got %s", tt.want, tt.unit, tt.bucket, got)
+		}
+	}
+}
+
+func TestCachedInsight(t *testing.T) {
+	cache := insightsByKey{"1/2/general/abc": `{"insight": "cached"}`}
+	tests := []struct {
+		name         string
+		userID       int
+		medicalType  string
+		logsHash     string
+		forceRefresh bool
+		wantHit      bool
+	}{
+		{"hit", 1, "general", "abc", false, true},
+		{"tracker changed", 1, "general", "def", false, false},
+		{"other perspective", 1, "ayurveda", "abc", false, false},
+		{"other user", 3, "general", "abc", false, false},
+		{"force refresh", 1, "general", "abc", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			insight, hit := cachedInsight(cache, tt.userID, 2, tt.medicalType, tt.logsHash, tt.forceRefresh)
+			if hit != tt.wantHit {
+				t.Fatalf("Expected hit %v, got %v", tt.wantHit, hit)
+			}
+			if hit && insight != `{"insight": "cached"}` {
+				t.Errorf("Expected the cached insight, got %s", insight)
+			}
+		})
+	}
+}
+
+// usageSince returns fixed totals per window start.
+type usageSince map[time.Time]db.AIUsageTotals
+
+func (u usageSince) GetAIUsageSince(userID int, since time.Time) (db.AIUsageTotals, error) {
+	totals, ok := u[since]
+	if !ok {
+		return db.AIUsageTotals{}, fmt.Errorf("unexpected window start %s", since)
+	}
+	return totals, nil
+}
+
+func TestLoadUsage(t *testing.T) {
+	// 23:30 in Denver is already the next UTC day
+	denver, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatalf("Failed to load zone: %v", err)
+	}
+	now := time.Date(2024, 4, 14, 23, 30, 0, 0, denver)
+	dayStart := time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	store := usageSince{
+		dayStart:   {Requests: 1, PromptTokens: 300, CompletionTokens: 200},
+		monthStart: {Requests: 4, PromptTokens: 1500, CompletionTokens: 500},
+	}
+
+	usage, err := loadUsage(store, 1, openai.Quota{DailyTokens: 1000, MonthlyTokens: 5000}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage.Daily.UsedTokens != 500 || usage.Monthly.UsedTokens != 2000 {
+		t.Errorf("Expected 500 tokens today and 2000 this month, got %+v", usage)
+	}
+	if !usage.Daily.ResetAt.Equal(time.Date(2024, 4, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the day to reset at the next UTC midnight, got %s", usage.Daily.ResetAt)
+	}
+	if !usage.Monthly.ResetAt.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the month to reset on May 1 UTC, got %s", usage.Monthly.ResetAt)
+	}
+	if _, exceeded := usage.exceeded(); exceeded {
+		t.Error("Expected usage under quota")
+	}
+}
+
+func TestAIUsageExceeded(t *testing.T) {
+	daily := usagePeriod{Period: "daily", UsedTokens: 1000, LimitTokens: 1000}
+	monthly := usagePeriod{Period: "monthly", UsedTokens: 5000, LimitTokens: 5000}
+	tests := []struct {
+		name  string
+		usage aiUsage
+		want  string
+	}{
+		{"under quota", aiUsage{Daily: usagePeriod{UsedTokens: 999, LimitTokens: 1000}}, ""},
+		{"unlimited", aiUsage{Daily: usagePeriod{UsedTokens: 1 << 20}}, ""},
+		{"daily", aiUsage{Daily: daily}, "daily"},
+		{"monthly", aiUsage{Monthly: monthly}, "monthly"},
+		{"both prefer monthly", aiUsage{Daily: daily, Monthly: monthly}, "monthly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period, exceeded := tt.usage.exceeded()
+			if exceeded != (tt.want != "") || period.Period != tt.want {
+				t.Errorf("Expected %q, got %q (exceeded %v)", tt.want, period.Period, exceeded)
+			}
+		})
+	}
+}
+
+func TestParseRedactionOptOuts(t *testing.T) {
+	got, err := parseRedactionOptOuts([]string{"email", "EMAIL", " Phone ", "phone"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"email", "phone"}) {
+		t.Errorf("Expected [email phone], got %v", got)
+	}
+	if _, err := parseRedactionOptOuts([]string{"email", "shoe_size"}); err == nil {
+		t.Error("Expected an error for an unknown category")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		want      string
+	}{
+		{"no header", nil, "192.0.2.1"},
+		{"load balancer hop", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed hops ignored", []string{"10.0.0.1, 198.51.100.2, 203.0.113.7"}, "203.0.113.7"},
+		{"last header wins", []string{"10.0.0.1", "203.0.113.7"}, "203.0.113.7"},
+		{"garbage", []string{"203.0.113.7, not-an-ip"}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSharePINPattern(t *testing.T) {
+	for pin, want := range map[string]bool{
+		"482193":        true,
+		"123456789012":  true,
+		"4821":          false,
+		"48219":         false,
+		"1234567890123": false,
+		"48a193":        false,
+	} {
+		if got := sharePINPattern.MatchString(pin); got != want {
+			t.Errorf("Expected %v for %q, got %v", want, pin, got)
+		}
+	}
+}
+
+func TestBuildShareReport(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+	link := db.ShareLink{TrackerName: "Migraine", StartDate: "2024-03-01", EndDate: "2024-03-02"}
+	symptoms := []db.Symptom{{SymptomName: "Headache"}, {SymptomName: "Nausea"}}
+	symptomLogs := []db.SymptomLog{
+		// 2024-02-29 23:30 in New York, before the range
+		{LogTime: "2024-03-01T04:30:00Z", Severity: "9", Symptoms: "Headache", Notes: "red wine"},
+		{LogTime: "2024-03-01T15:00:00Z", Severity: "4", Symptoms: "Headache, Nausea", Notes: "skipped lunch", CycleDay: 3, CyclePhase: "menstrual"},
+		{LogTime: "2024-03-02T15:00:00Z", Severity: "6", Symptoms: "Headache", Notes: "slept badly"},
+		{LogTime: "2024-03-02T16:00:00Z", Severity: "Mild", Symptoms: "Nausea"},
+		// 2024-03-02 22:00 in New York, inside the range
+		{LogTime: "2024-03-03T03:00:00Z", Severity: "2", Symptoms: "Headache"},
+	}
+
+	report := buildShareReport(link, symptoms, symptomLogs, loc)
+	if report.TotalLogs != 4 || report.DaysLogged != 2 {
+		t.Errorf("Expected 4 logs over 2 days, got %d over %d", report.TotalLogs, report.DaysLogged)
+	}
+	if report.MeanSeverity == nil || *report.MeanSeverity != 4 {
+		t.Errorf("Expected mean severity 4, got %v", report.MeanSeverity)
+	}
+	if len(report.TopSymptoms) == 0 || report.TopSymptoms[0].Symptom != "Headache" || report.TopSymptoms[0].Count != 3 {
+		t.Errorf("Expected Headache 3 times first, got %v", report.TopSymptoms)
+	}
+	for _, reportLog := range report.Logs {
+		if reportLog.Notes != "" {
+			t.Errorf("Expected notes to be left out, got %q", reportLog.Notes)
+		}
+		if reportLog.CycleDay != 0 || reportLog.CyclePhase != "" {
+			t.Errorf("Expected cycle data to be left out, got day %d %q", reportLog.CycleDay, reportLog.CyclePhase)
+		}
+	}
+	if report.Logs[0].LocalTime != "2024-03-01T10:00:00-05:00" {
+		t.Errorf("Expected local time in the owner's zone, got %s", report.Logs[0].LocalTime)
+	}
+
+	link.IncludeNotes = true
+	report = buildShareReport(link, symptoms, symptomLogs, loc)
+	if report.Logs[0].Notes != "skipped lunch" {
+		t.Errorf("Expected notes when the link includes them, got %q", report.Logs[0].Notes)
+	}
+	if report.Logs[0].CycleDay != 0 {
+		t.Errorf("Expected notes not to bring cycle data along, got day %d", report.Logs[0].CycleDay)
+	}
+
+	link.IncludeCycle = true
+	report = buildShareReport(link, symptoms, symptomLogs, loc)
+	if report.Logs[0].CycleDay != 3 || report.Logs[0].CyclePhase != "menstrual" {
+		t.Errorf("Expected cycle data when the link includes it, got day %d %q", report.Logs[0].CycleDay, report.Logs[0].CyclePhase)
+	}
+}
+
+// memorySessions is a sessionDatabase backed by a slice.
+type memorySessions struct {
+	sessions []db.Session
+}
+
+func (m *memorySessions) open() (sessionDatabase, error) { return m, nil }
+
+func (m *memorySessions) Close() error { return nil }
+
+func (m *memorySessions) CreateSession(s db.Session, now time.Time) (int, error) {
+	s.ID = len(m.sessions) + 1
+	s.CreatedAt = now.UTC().Format(time.RFC3339)
+	s.LastSeenAt = s.CreatedAt
+	m.sessions = append(m.sessions, s)
+	return s.ID, nil
+}
+
+func (m *memorySessions) GetSessionByTokenHash(tokenHash string) (db.Session, error) {
+	for _, s := range m.sessions {
+		if s.TokenHash == tokenHash {
+			return s, nil
+		}
+	}
+	return db.Session{}, sql.ErrNoRows
+}
+
+func (m *memorySessions) GetSessionByID(id int) (db.Session, error) {
+	if id < 1 || id > len(m.sessions) {
+		return db.Session{}, sql.ErrNoRows
+	}
+	return m.sessions[id-1], nil
+}
+
+func (m *memorySessions) GetActiveSessionsByUsername(username string, now time.Time) ([]db.Session, error) {
+	active := []db.Session{}
+	for _, s := range m.sessions {
+		if s.Username == username && s.ActiveAt(now) {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+func (m *memorySessions) TouchSession(id int, userAgent, ipAddress string, now time.Time) error {
+	s := &m.sessions[id-1]
+	s.UserAgent, s.IPAddress, s.LastSeenAt = userAgent, ipAddress, now.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (m *memorySessions) RevokeSession(id int, now time.Time) error {
+	if m.sessions[id-1].RevokedAt == "" {
+		m.sessions[id-1].RevokedAt = now.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+func (m *memorySessions) RevokeSessionsByUsername(username string, now time.Time) error {
+	for _, s := range m.sessions {
+		if s.Username == username {
+			m.RevokeSession(s.ID, now)
+		}
+	}
+	return nil
+}
+
+func newTestSessionCipher(t *testing.T) *session.Cipher {
+	t.Helper()
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	c, err := session.NewCipher(key)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	return c
+}
+
+// memoryProfiles is a profileDatabase backed by a map.
+type memoryProfiles map[int]db.UserProfile
+
+func (m memoryProfiles) open() (profileDatabase, error) { return m, nil }
+
+func (m memoryProfiles) Close() error { return nil }
+
+func (m memoryProfiles) GetUserProfile(user db.User) (db.UserProfile, error) {
+	if profile, ok := m[user.ID]; ok {
+		return profile, nil
+	}
+	return db.DefaultProfile(user), nil
+}
+
+func (m memoryProfiles) SaveUserProfile(profile db.UserProfile) error {
+	m[profile.UserID] = profile
+	return nil
+}
+
+func TestSeedProfile(t *testing.T) {
+	codes := map[string]string{}
+	provider, err := auth.NewMemoryProvider(memoryIssuer, "client", func(username, code string) {
+		codes[username] = code
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := provider.SignUp(context.Background(), "pat@example.com", "Pat", "Lee", "correct-horse"); err != nil {
+		t.Fatalf("Failed to sign up: %v", err)
+	}
+	config := &config{AuthClient: provider}
+	profiles := memoryProfiles{}
+	req := httptest.NewRequest(http.MethodPost, "/make-user", nil)
+
+	pat := db.User{ID: 1, CognitoSub: "pat@example.com", Email: "pat@example.com", TimeZone: "America/Denver"}
+	config.seedProfile(req, profiles, pat)
+	want := db.DefaultProfile(pat)
+	want.FirstName, want.LastName = "Pat", "Lee"
+	if profiles[1] != want {
+		t.Errorf("Expected %+v, got %+v", want, profiles[1])
+	}
+
+	// Without identity provider attributes the defaults are still saved
+	unknown := db.User{ID: 2, CognitoSub: "nobody", TimeZone: "UTC"}
+	config.seedProfile(req, profiles, unknown)
+	if profiles[2] != db.DefaultProfile(unknown) {
+		t.Errorf("Expected the default profile, got %+v", profiles[2])
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	perspectives, err := openai.LoadPerspectives("")
+	if err != nil {
+		t.Fatalf("Failed to load perspectives: %v", err)
+	}
+	user := db.User{ID: 1, CognitoSub: "pat", Email: "pat@example.com", TimeZone: "UTC"}
+	original := db.DefaultProfile(user)
+	original.FirstName = "Pat"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		check  func(t *testing.T, profile db.UserProfile)
+	}{
+		{"invalid json", `{"units":`, http.StatusBadRequest, nil},
+		{"unknown time zone", `{"time_zone": "Mars/Olympus"}`, http.StatusBadRequest, nil},
+		{"empty time zone", `{"time_zone": ""}`, http.StatusBadRequest, nil},
+		{"unknown perspective", `{"preferred_perspective": "astrology"}`, http.StatusBadRequest, nil},
+		{"unknown units", `{"units": "furlongs"}`, http.StatusBadRequest, nil},
+		{"reminder time not HH:MM", `{"reminder_time": "8pm"}`, http.StatusBadRequest, nil},
+		{
+			"partial update keeps other fields",
+			`{"last_name": "Lee", "units": "imperial"}`,
+			http.StatusOK,
+			func(t *testing.T, profile db.UserProfile) {
+				if profile.FirstName != "Pat" || profile.LastName != "Lee" || profile.Units != "imperial" {
+					t.Errorf("Unexpected profile %+v", profile)
+				}
+				if profile.ReminderTime != original.ReminderTime || profile.TimeZone != "UTC" {
+					t.Errorf("Expected untouched fields to keep their values, got %+v", profile)
+				}
+			},
+		},
+		{
+			"normalized perspective and settings",
+			`{"time_zone": "America/Denver", "preferred_perspective": " Ayurveda ", "reminders_enabled": true, "reminder_time": "07:30"}`,
+			http.StatusOK,
+			func(t *testing.T, profile db.UserProfile) {
+				if profile.TimeZone != "America/Denver" || profile.PreferredPerspective != "ayurveda" {
+					t.Errorf("Unexpected profile %+v", profile)
+				}
+				if !profile.RemindersEnabled || profile.ReminderTime != "07:30" {
+					t.Errorf("Expected reminders at 07:30, got %+v", profile)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := memoryProfiles{user.ID: original}
+			config := &config{perspectives: perspectives, users: newUserResolver(), openProfiles: profiles.open}
+
+			rr := httptest.NewRecorder()
+			config.updateProfile(rr, httptest.NewRequest(http.MethodPatch, "/profile", strings.NewReader(tt.body)), user)
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.check == nil {
+				if profiles[user.ID] != original {
+					t.Errorf("Expected a rejected update to leave the profile alone, got %+v", profiles[user.ID])
+				}
+				return
+			}
+			tt.check(t, profiles[user.ID])
+
+			// GET returns what was saved
+			rr = httptest.NewRecorder()
+			config.getProfile(rr, httptest.NewRequest(http.MethodGet, "/profile", nil), user)
+			var got db.UserProfile
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to decode profile: %v", err)
+			}
+			if got != profiles[user.ID] {
+				t.Errorf("Expected GET to return %+v, got %+v", profiles[user.ID], got)
+			}
+		})
+	}
+}
+
+func TestShareInvitationNeedsVerifiedEmail(t *testing.T) {
+	codes := map[string]string{}
+	provider, err := auth.NewMemoryProvider(memoryIssuer, "client", func(username, code string) {
+		codes[username] = code
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	config := &config{AuthClient: provider}
+	ctx := context.Background()
+	for _, email := range []string{"victim@example.com", "mallory@example.com"} {
+		if err := provider.SignUp(ctx, email, "", "", "correct-horse"); err != nil {
+			t.Fatalf("Failed to sign up %s: %v", email, err)
+		}
+	}
+	if err := provider.ConfirmSignUp(ctx, "mallory@example.com", codes["mallory@example.com"]); err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/shares/1/accept", nil)
+	share := db.TrackerShare{ID: 1, GranteeEmail: "Victim@example.com"}
+
+	// An account that never proved it owns the invited address
+	email, err := config.verifiedEmail(req, db.User{CognitoSub: "victim@example.com", Email: "victim@example.com"})
+	if err != nil || email != "" {
+		t.Fatalf("Expected no verified email before confirming, got %q, %v", email, err)
+	}
+	if invitedAs(share, email) {
+		t.Error("Expected an unverified email to be refused")
+	}
+
+	// A verified account that claimed the victim's address in users.email
+	email, err = config.verifiedEmail(req, db.User{CognitoSub: "mallory@example.com", Email: "victim@example.com"})
+	if err != nil || email != "mallory@example.com" {
+		t.Fatalf("Expected the verified email, got %q, %v", email, err)
+	}
+	if invitedAs(share, email) {
+		t.Error("Expected a mismatched email to be refused")
+	}
+
+	if !invitedAs(db.TrackerShare{GranteeEmail: "Mallory@example.com"}, email) {
+		t.Error("Expected an invitation to the verified email to match")
+	}
+	if invitedAs(db.TrackerShare{GranteeEmail: "mallory@example.com", GranteeID: 7}, email) {
+		t.Error("Expected an accepted share not to match by email")
+	}
+}
+
+// memoryLogs is a logDatabase backed by slices and maps.
+type memoryLogs struct {
+	users    map[int]db.User
+	trackers map[int]db.Tracker
+	shares   []db.TrackerShare
+	logs     []db.SymptomLog
+	cycles   map[int][]db.Cycle
+}
+
+func (m *memoryLogs) open() (logDatabase, error) { return m, nil }
+
+func (m *memoryLogs) Close() error { return nil }
+
+func (m *memoryLogs) GetTrackerByID(trackerID int) (db.Tracker, error) {
+	if tracker, ok := m.trackers[trackerID]; ok {
+		return tracker, nil
+	}
+	return db.Tracker{}, sql.ErrNoRows
+}
+
+func (m *memoryLogs) GetActiveTrackerShare(trackerID, granteeID int, now time.Time) (db.TrackerShare, error) {
+	for _, share := range m.shares {
+		if share.TrackerID == trackerID && share.GranteeID == granteeID && share.StatusAt(now) == db.ShareStatusActive {
+			return share, nil
+		}
+	}
+	return db.TrackerShare{}, sql.ErrNoRows
+}
+
+func (m *memoryLogs) GetUserByID(userID int) (db.User, error) {
+	if user, ok := m.users[userID]; ok {
+		return user, nil
+	}
+	return db.User{}, sql.ErrNoRows
+}
+
+func (m *memoryLogs) GetCyclesByUserID(userID int) ([]db.Cycle, error) {
+	return m.cycles[userID], nil
+}
+
+func (m *memoryLogs) GetSymptomLogsByTag(userID int, filter db.LogTagFilter) ([]db.SymptomLog, error) {
+	return m.GetSymptomLogsByUserID(userID)
+}
+
+func (m *memoryLogs) GetSymptomLogsByTrackerID(trackerID int) ([]db.SymptomLog, error) {
+	logs := []db.SymptomLog{}
+	for _, symptomLog := range m.logs {
+		if symptomLog.TrackerID == trackerID {
+			logs = append(logs, symptomLog)
+		}
+	}
+	return logs, nil
+}
+
+func (m *memoryLogs) GetSymptomLogsByUserID(userID int) ([]db.SymptomLog, error) {
+	logs := []db.SymptomLog{}
+	for _, symptomLog := range m.logs {
+		if symptomLog.UserID == userID {
+			logs = append(logs, symptomLog)
+		}
+	}
+	return logs, nil
+}
+
+// newSharedTrackerLogs has a tracker owned by user 1, who tracks their cycle,
+// shared read-only with user 2.
+func newSharedTrackerLogs() *memoryLogs {
+	return &memoryLogs{
+		users: map[int]db.User{
+			1: {ID: 1, CognitoSub: "owner", TimeZone: "UTC"},
+			2: {ID: 2, CognitoSub: "caregiver", TimeZone: "UTC"},
+		},
+		trackers: map[int]db.Tracker{10: {ID: 10, UserID: 1, TrackerName: "Migraines"}},
+		shares: []db.TrackerShare{{
+			ID: 1, TrackerID: 10, OwnerID: 1, GranteeID: 2,
+			Permission: db.SharePermissionRead, AcceptedAt: "2024-03-01T00:00:00Z",
+		}},
+		logs: []db.SymptomLog{{
+			ID: 100, UserID: 1, TrackerID: 10, LogTime: "2024-03-05T12:00:00Z", Severity: "6", Symptoms: "Headache",
+		}},
+		cycles: map[int][]db.Cycle{1: {{ID: 1, UserID: 1, StartDate: "2024-03-01", EndDate: "2024-03-05", Flow: "medium"}}},
+	}
+}
+
+func TestGetSymptomLogsHidesOwnerCycles(t *testing.T) {
+	database := newSharedTrackerLogs()
+	config := &config{openLogs: database.open}
+
+	tests := []struct {
+		name       string
+		user       db.User
+		wantCycles bool
+	}{
+		{"owner", database.users[1], true},
+		{"read grantee", database.users[2], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/get-symptom-logs?tracker_id=10", nil)
+			config.getSymptomLogs(w, req, tt.user)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var logs []map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil || len(logs) != 1 {
+				t.Fatalf("Expected one log, got %s", w.Body.String())
+			}
+			_, hasDay := logs[0]["cycle_day"]
+			_, hasPhase := logs[0]["cycle_phase"]
+			if hasDay != tt.wantCycles || hasPhase != tt.wantCycles {
+				t.Errorf("Expected cycle fields %v, got %s", tt.wantCycles, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetSymptomLogsTrackerAccess(t *testing.T) {
+	database := newSharedTrackerLogs()
+	for id := 3; id <= 6; id++ {
+		database.users[id] = db.User{ID: id, TimeZone: "UTC"}
+	}
+	database.shares = append(database.shares,
+		// Never accepted
+		db.TrackerShare{ID: 2, TrackerID: 10, OwnerID: 1, GranteeID: 4, Permission: db.SharePermissionRead},
+		db.TrackerShare{
+			ID: 3, TrackerID: 10, OwnerID: 1, GranteeID: 5, Permission: db.SharePermissionComment,
+			AcceptedAt: "2024-03-01T00:00:00Z", RevokedAt: "2024-03-02T00:00:00Z",
+		},
+		db.TrackerShare{
+			ID: 4, TrackerID: 10, OwnerID: 1, GranteeID: 6, Permission: db.SharePermissionRead,
+			AcceptedAt: "2024-03-01T00:00:00Z", ExpiresAt: "2024-04-01T00:00:00Z",
+		},
+	)
+	config := &config{openLogs: database.open}
+
+	tests := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"owner", 1, http.StatusOK},
+		{"active grantee", 2, http.StatusOK},
+		{"no share", 3, http.StatusNotFound},
+		{"pending share", 4, http.StatusNotFound},
+		{"revoked share", 5, http.StatusNotFound},
+		{"expired share", 6, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/get-symptom-logs?tracker_id=10", nil)
+			config.getSymptomLogs(w, req, database.users[tt.userID])
+			if w.Code != tt.want {
+				t.Fatalf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want != http.StatusOK && strings.Contains(w.Body.String(), "Headache") {
+				t.Errorf("Expected no logs in a refused response, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteAuthResult(t *testing.T) {
+	sessions := &memorySessions{}
+	config := &config{sessionCipher: newTestSessionCipher(t), openSessions: sessions.open}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/sign-in", nil)
+	config.writeAuthResult(rr, req, auth.AuthResult{Challenge: &auth.Challenge{
+		Name:       "SOFTWARE_TOKEN_MFA",
+		Session:    "session-1",
+		Parameters: map[string]string{"USER_ID_FOR_SRP": "user-1"},
+	}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var challenge SignInChallenge
+	if err := json.Unmarshal(rr.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	if challenge.ChallengeName != "SOFTWARE_TOKEN_MFA" || challenge.Session != "session-1" {
+		t.Errorf("Expected the challenge to be returned, got %+v", challenge)
+	}
+	if len(rr.Result().Cookies()) != 0 || len(sessions.sessions) != 0 {
+		t.Error("Expected no session before the challenge is answered")
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"sub-1","cognito:username":"user-1"}`))
+	rr = httptest.NewRecorder()
+	req.Header.Set("User-Agent", "test-browser")
+	config.writeAuthResult(rr, req, auth.AuthResult{Tokens: &auth.Tokens{
+		AccessToken:  "access",
+		IDToken:      "header." + payload + ".signature",
+		RefreshToken: "refresh",
+		TokenType:    "Bearer",
+		ExpiresIn:    3600,
+	}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	cookies := map[string]string{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	if cookies[sessionCookie] == "" || cookies["refreshToken"] != "" || cookies["userSub"] != "" {
+		t.Errorf("Expected only an opaque session cookie, got %v", cookies)
+	}
+	if len(sessions.sessions) != 1 {
+		t.Fatalf("Expected 1 stored session, got %d", len(sessions.sessions))
+	}
+	stored := sessions.sessions[0]
+	if stored.Username != "user-1" || stored.Subject != "sub-1" || stored.UserAgent != "test-browser" {
+		t.Errorf("Unexpected session %+v", stored)
+	}
+	if stored.TokenHash != session.HashToken(cookies[sessionCookie]) || stored.RefreshToken == "refresh" {
+		t.Error("Expected the session ID hashed and the refresh token encrypted")
+	}
+	if !strings.Contains(rr.Body.String(), `"accessToken":"access"`) {
+		t.Errorf("Expected the access token in the body, got %s", rr.Body.String())
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	var code string
+	provider, err := auth.NewMemoryProvider(memoryIssuer, "client", func(username, c string) { code = c })
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	ctx := context.Background()
+	if err := provider.SignUp(ctx, "pat@example.com", "Pat", "", "correct-horse"); err != nil {
+		t.Fatalf("Failed to sign up: %v", err)
+	}
+	if err := provider.ConfirmSignUp(ctx, "pat@example.com", code); err != nil {
+		t.Fatalf("Failed to confirm sign up: %v", err)
+	}
+	sessions := &memorySessions{}
+	config := &config{
+		AuthClient:    provider,
+		sessionCipher: newTestSessionCipher(t),
+		openSessions:  sessions.open,
+	}
+	now := time.Now()
+	for _, s := range []db.Session{
+		{TokenHash: session.HashToken("phone"), Username: "pat@example.com", UserAgent: "phone"},
+		{TokenHash: session.HashToken("laptop"), Username: "pat@example.com", UserAgent: "laptop"},
+		{TokenHash: session.HashToken("other"), Username: "sam", UserAgent: "other"},
+	} {
+		s.ExpiresAt = now.Add(time.Hour).UTC().Format(time.RFC3339)
+		sessions.CreateSession(s, now)
+	}
+
+	serve := func(method, path, username, cookie string) *httptest.ResponseRecorder {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /sessions", config.getSessions)
+		mux.HandleFunc("DELETE /sessions", config.revokeAllSessions)
+		mux.HandleFunc("DELETE /sessions/{id}", config.revokeSession)
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Username: username}))
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie})
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/sessions", "pat@example.com", "laptop")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var listed []db.Session
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Failed to decode sessions: %v", err)
+	}
+	if len(listed) != 2 || listed[0].Current || !listed[1].Current {
+		t.Errorf("Expected pat's two sessions with the laptop current, got %+v", listed)
+	}
+	if strings.Contains(rr.Body.String(), "token_hash") || strings.Contains(rr.Body.String(), session.HashToken("laptop")) {
+		t.Errorf("Expected no secrets in the listing, got %s", rr.Body.String())
+	}
+
+	if rr := serve(http.MethodDelete, "/sessions/3", "pat@example.com", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for another user's session, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := serve(http.MethodDelete, "/sessions/1", "pat@example.com", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if sessions.sessions[0].RevokedAt == "" || sessions.sessions[1].RevokedAt != "" {
+		t.Error("Expected only the phone session to be revoked")
+	}
+
+	if rr := serve(http.MethodDelete, "/sessions", "pat@example.com", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if sessions.sessions[1].RevokedAt == "" || sessions.sessions[2].RevokedAt != "" {
+		t.Error("Expected all of pat's sessions and no one else's to be revoked")
+	}
+}
+
+func TestIdentityErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"wrong code", fmt.Errorf("wrapped: %w", auth.ErrCodeMismatch), http.StatusUnauthorized},
+		{"bad credentials", auth.ErrNotAuthorized, http.StatusUnauthorized},
+		{"unconfirmed", auth.ErrUserNotConfirmed, http.StatusForbidden},
+		{"taken username", auth.ErrUserExists, http.StatusConflict},
+		{"weak password", auth.ErrInvalidRequest, http.StatusBadRequest},
+		{"other", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identityErrorStatus(tt.err); got != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAuthHandlersWithMemoryProvider(t *testing.T) {
+	codes := map[string]string{}
+	provider, err := auth.NewMemoryProvider(memoryIssuer, "client", func(username, code string) {
+		codes[username] = code
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	sessions := &memorySessions{}
+	config := &config{
+		AuthClient:    provider,
+		sessionCipher: newTestSessionCipher(t),
+		openSessions:  sessions.open,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /signup", config.signUp)
+	mux.HandleFunc("POST /confirm-signup", config.ConfirmSignup)
+	mux.HandleFunc("POST /sign-in", config.SignIn)
+	mux.HandleFunc("POST /refresh-token", config.RefreshToken)
+	mux.HandleFunc("POST /sign-out", config.SignOut)
+	mux.HandleFunc("POST /forgot-password", config.ForgotPassword)
+	mux.HandleFunc("POST /confirm-forgot-password", config.ConfirmForgottenPassword)
+	mux.HandleFunc("POST /mfa/totp/associate", config.AssociateTOTP)
+
+	var cookies []*http.Cookie
+	post := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	expect := func(rr *httptest.ResponseRecorder, status int) {
+		t.Helper()
+		if rr.Code != status {
+			t.Fatalf("Expected status %d, got %d: %s", status, rr.Code, rr.Body.String())
+		}
+	}
+
+	signUp := `{"username": "pat@example.com", "password": "correct-horse", "first_name": "Pat"}`
+	expect(post("/signup", signUp), http.StatusCreated)
+	expect(post("/signup", signUp), http.StatusConflict)
+	expect(post("/sign-in", `{"username": "pat@example.com", "password": "correct-horse"}`), http.StatusForbidden)
+	expect(post("/confirm-signup", `{"email": "pat@example.com", "confirmationCode": "000000x"}`), http.StatusUnauthorized)
+	confirm := fmt.Sprintf(`{"email": "pat@example.com", "confirmationCode": %q}`, codes["pat@example.com"])
+	expect(post("/confirm-signup", confirm), http.StatusOK)
+	expect(post("/sign-in", `{"username": "pat@example.com", "password": "wrong-horse"}`), http.StatusUnauthorized)
+
+	rr := post("/sign-in", `{"username": "pat@example.com", "password": "correct-horse"}`)
+	expect(rr, http.StatusOK)
+	cookies = rr.Result().Cookies()
+	var signIn struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &signIn); err != nil {
+		t.Fatalf("Failed to decode sign-in response: %v", err)
+	}
+
+	// The access token passes the same checks as a Cognito token
+	validator := &auth.TokenValidator{Keys: provider, Issuer: memoryIssuer, ClientID: "client"}
+	token, err := validator.Validate(context.Background(), []byte(signIn.AccessToken))
+	if err != nil {
+		t.Fatalf("Expected the access token to validate, got %v", err)
+	}
+	if principal := auth.PrincipalFromToken(token); principal.Username == "" {
+		t.Error("Expected the access token to carry a username")
+	}
+
+	expect(post("/refresh-token", ""), http.StatusOK)
+	expect(post("/mfa/totp/associate", `{"session": "s"}`), http.StatusNotImplemented)
+	expect(post("/sign-out", ""), http.StatusOK)
+	expect(post("/refresh-token", ""), http.StatusUnauthorized)
+
+	cookies = nil
+	expect(post("/forgot-password", `{"email": "pat@example.com"}`), http.StatusOK)
+	reset := fmt.Sprintf(
+		`{"email": "pat@example.com", "confirmationCode": %q, "password": "battery-staple"}`,
+		codes["pat@example.com"],
+	)
+	expect(post("/confirm-forgot-password", reset), http.StatusOK)
+	expect(post("/sign-in", `{"username": "pat@example.com", "password": "battery-staple"}`), http.StatusOK)
+}
+
+func TestPendingLogins(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	logins := newPendingLogins()
+	logins.now = func() time.Time { return now }
+
+	logins.put("a", pendingLogin{verifier: "v"})
+	if login, ok := logins.take("a"); !ok || login.verifier != "v" {
+		t.Fatalf("Expected the pending login, got %+v, %v", login, ok)
+	}
+	if _, ok := logins.take("a"); ok {
+		t.Error("Expected a login to be usable once")
+	}
+
+	logins.put("b", pendingLogin{})
+	now = now.Add(oauthLoginTTL)
+	if _, ok := logins.take("b"); ok {
+		t.Error("Expected an expired login to be refused")
+	}
+}
+
+func TestOAuthStartAndCallback(t *testing.T) {
+	config := &config{
+		oauth: &auth.OAuthClient{
+			Domain:      "https://auth.example.com",
+			ClientID:    "client",
+			RedirectURL: "https://api.example.com/aws-cognito/oauth/callback",
+		},
+		oauthLogins:  newPendingLogins(),
+		postLoginURL: "https://app.example.com/login/complete",
+	}
+
+	rr := httptest.NewRecorder()
+	config.oauthStart(rr, httptest.NewRequest(http.MethodGet, "/oauth/start?provider=myspace", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown provider, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	config.oauthStart(rr, httptest.NewRequest(http.MethodGet, "/oauth/start?provider=google", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, rr.Code)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect: %v", err)
+	}
+	state := location.Query().Get("state")
+	if location.Query().Get("identity_provider") != "Google" || location.Query().Get("code_challenge") == "" {
+		t.Errorf("Unexpected authorize URL %s", location)
+	}
+	var stateCookie *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == oauthStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || stateCookie.Value != state {
+		t.Fatalf("Expected a state cookie matching %q, got %v", state, stateCookie)
+	}
+
+	callback := func(query string, cookie *http.Cookie) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/oauth/callback?"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		config.oauthCallback(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("Expected status %d, got %d", http.StatusFound, rr.Code)
+		}
+		return rr.Header().Get("Location")
+	}
+
+	if got := callback("error=access_denied", stateCookie); !strings.HasSuffix(got, "?error=access_denied") {
+		t.Errorf("Expected the provider error to be passed on, got %s", got)
+	}
+	// Without the cookie another browser could complete the login
+	if got := callback("code=c&state="+state, nil); !strings.HasSuffix(got, "?error=invalid_state") {
+		t.Errorf("Expected invalid_state without the cookie, got %s", got)
+	}
+	forged := &http.Cookie{Name: oauthStateCookie, Value: "forged"}
+	if got := callback("code=c&state=forged", forged); !strings.HasSuffix(got, "?error=invalid_state") {
+		t.Errorf("Expected invalid_state for an unknown state, got %s", got)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+const (
+	// oauthLoginTTL is how long a user has to finish signing in with the
+	// identity provider
+	oauthLoginTTL = 10 * time.Minute
+	// oauthStateCookie binds a pending login to the browser that started it
+	oauthStateCookie = "oauthState"
+)
+
+// pendingLogin is what the callback needs from the start of a social login.
+type pendingLogin struct {
+	verifier string
+	nonce    string
+	timeZone string
+	expires  time.Time
+}
+
+// pendingLogins holds social logins between the redirect to the identity
+// provider and its callback. Logins are single use and held in memory, so
+// the callback must reach the instance that started the login.
+type pendingLogins struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	logins map[string]pendingLogin
+}
+
+func newPendingLogins() *pendingLogins {
+	return &pendingLogins{now: time.Now, logins: make(map[string]pendingLogin)}
+}
+
+// put stores login under state and drops logins that have expired.
+func (p *pendingLogins) put(state string, login pendingLogin) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for key, pending := range p.logins {
+		if !now.Before(pending.expires) {
+			delete(p.logins, key)
+		}
+	}
+	login.expires = now.Add(oauthLoginTTL)
+	p.logins[state] = login
+}
+
+// take removes and returns the login for state if it hasn't expired.
+func (p *pendingLogins) take(state string) (pendingLogin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	login, ok := p.logins[state]
+	delete(p.logins, state)
+	if !ok || !p.now().Before(login.expires) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+// oauthStart redirects to the hosted UI to sign in with ?provider=google or
+// apple. An optional time_zone is used if the login creates the account.
+func (c *config) oauthStart(w http.ResponseWriter, r *http.Request) {
+	if c.oauth == nil {
+		http.Error(w, "Social login is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	provider, ok := auth.OAuthProviders[r.URL.Query().Get("provider")]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusBadRequest)
+		return
+	}
+	timeZone := r.URL.Query().Get("time_zone")
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		http.Error(w, "Invalid time zone", http.StatusBadRequest)
+		return
+	}
+
+	pkce, err := auth.NewPKCE()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	state, err := auth.NewState()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := auth.NewState()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	c.oauthLogins.put(state, pendingLogin{verifier: pkce.Verifier, nonce: nonce, timeZone: timeZone})
+
+	// Lax so the cookie comes back on the provider's top-level redirect
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/aws-cognito/oauth",
+		MaxAge:   int(oauthLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, c.oauth.AuthorizeURL(provider, state, nonce, pkce.Challenge), http.StatusFound)
+}
+
+// oauthCallback finishes a social login: it checks state, exchanges the code
+// with the PKCE verifier, verifies the ID token's nonce, provisions the local
+// account on first login and starts a session like /sign-in. It always
+// redirects to the post-login page, with ?error= on failure; the page then
+// calls /refresh-token for an access token.
+func (c *config) oauthCallback(w http.ResponseWriter, r *http.Request) {
+	if c.oauth == nil {
+		http.Error(w, "Social login is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	query := r.URL.Query()
+
+	// The state cookie is single use whatever the outcome
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/aws-cognito/oauth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if providerError := query.Get("error"); providerError != "" {
+		c.finishOAuth(w, r, providerError)
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oauthStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		c.finishOAuth(w, r, "invalid_state")
+		return
+	}
+	login, ok := c.oauthLogins.take(state)
+	if !ok {
+		c.finishOAuth(w, r, "invalid_state")
+		return
+	}
+
+	tokens, err := c.oauth.Exchange(r.Context(), query.Get("code"), login.verifier)
+	if err != nil {
+		log.Printf("Failed to exchange authorization code: %v", err)
+		c.finishOAuth(w, r, "exchange_failed")
+		return
+	}
+	idToken, err := c.tokens.ValidateIDToken(r.Context(), []byte(tokens.IDToken), login.nonce)
+	if err != nil {
+		log.Printf("Rejected ID token from social login: %v", err)
+		c.finishOAuth(w, r, "invalid_token")
+		return
+	}
+	principal := auth.PrincipalFromToken(idToken)
+	if principal.Username == "" || principal.Email == "" {
+		c.finishOAuth(w, r, "invalid_token")
+		return
+	}
+	if !principal.EmailVerified {
+		c.finishOAuth(w, r, "email_not_verified")
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		c.finishOAuth(w, r, "provisioning_failed")
+		return
+	}
+	defer database.Close()
+	user, created, err := c.provisionUser(r, database, principal.Email, principal.Username, login.timeZone)
+	if err != nil {
+		log.Printf("Failed to provision user %s: %v", principal.Username, err)
+		c.finishOAuth(w, r, "provisioning_failed")
+		return
+	}
+	if created {
+		log.Printf("Provisioned user %d on first social login", user.ID)
+	}
+
+	if err := c.startSession(w, r, &tokens); err != nil {
+		log.Printf("Failed to start session for %s: %v", principal.Username, err)
+		c.finishOAuth(w, r, "session_failed")
+		return
+	}
+	c.finishOAuth(w, r, "")
+}
+
+// finishOAuth redirects to the post-login page, reporting errorCode if set.
+func (c *config) finishOAuth(w http.ResponseWriter, r *http.Request, errorCode string) {
+	target := c.postLoginURL
+	if errorCode != "" {
+		if parsed, err := url.Parse(target); err == nil {
+			query := parsed.Query()
+			query.Set("error", errorCode)
+			parsed.RawQuery = query.Encode()
+			target = parsed.String()
+		}
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
 	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-func (cfg *config) openai(w http.ResponseWriter, r *http.Request) {
+func (cfg *config) openai(w http.ResponseWriter, r *http.Request, user db.User) {
 	var selectedTracker openai.SelectedTracker
 
 	err := json.NewDecoder(r.Body).Decode(&selectedTracker)
@@ -17,11 +21,140 @@ func (cfg *config) openai(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := openai.Openaimain(
-		selectedTracker.MedicalType,
-		selectedTracker.Logs,
-	)
+	database, err := db.New()
 	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	// Without an explicit medical_type, use the user's preferred perspective
+	if selectedTracker.MedicalType == "" {
+		profile, err := database.GetUserProfile(user)
+		if err != nil {
+			http.Error(w, "Failed to get profile: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		selectedTracker.MedicalType = profile.PreferredPerspective
+	}
+
+	perspective, err := cfg.perspectives.Get(selectedTracker.MedicalType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	medicalType := perspective.Name
+
+	// Redaction settings change the prompt, so they're part of the cache key
+	optOut, err := loadRedactionOptOuts(database, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get redaction settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Clients from before tracker_id send their logs instead. They're served
+	// as before, uncached, until they move to tracker_id.
+	legacy := selectedTracker.TrackerID == 0 && len(selectedTracker.Logs) > 0
+	var trackerID int
+	var logs []openai.SymptomLog
+	var intakes []openai.Intake
+	var logsHash string
+	if legacy {
+		logs = selectedTracker.Logs
+		w.Header().Set("Deprecation", "true")
+		log.Printf("User %d sent logs to /openai without tracker_id", user.ID)
+	} else {
+		tracker, err := database.GetTrackerByIDAndUserID(selectedTracker.TrackerID, user.ID)
+		if err != nil {
+			http.Error(w, "Tracker not found", http.StatusNotFound)
+			return
+		}
+		trackerID = tracker.ID
+
+		symptomLogs, err := database.GetSymptomLogsByTrackerID(tracker.ID)
+		if err != nil {
+			http.Error(w, "Failed to get logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The model sees log times in the user's own time zone
+		db.LocalizeLogs(symptomLogs, user.Location())
+		annotateCycles(database, user, symptomLogs)
+		logs = make([]openai.SymptomLog, 0, len(symptomLogs))
+		for _, symptomLog := range symptomLogs {
+			logs = append(logs, openai.SymptomLog{
+				LogTime:    symptomLog.LocalTime,
+				Notes:      symptomLog.Notes,
+				Severity:   symptomLog.Severity,
+				Symptoms:   symptomLog.Symptoms,
+				CycleDay:   symptomLog.CycleDay,
+				CyclePhase: symptomLog.CyclePhase,
+			})
+		}
+
+		intakes, err = loadIntakes(database, tracker.ID, user.Location())
+		if err != nil {
+			http.Error(w, "Failed to get intake logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logsHash, err = openai.HashLogs(perspective, logs, intakes, optOut)
+		if err != nil {
+			http.Error(w, "Failed to hash logs", http.StatusInternalServerError)
+			return
+		}
+
+		// Serve the cached insight unless the tracker changed or a refresh was requested
+		insight, ok := cachedInsight(database, user.ID, tracker.ID, medicalType, logsHash, selectedTracker.ForceRefresh)
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Insight-Cache", "HIT")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(insight))
+			return
+		}
+	}
+
+	insightRequest := openai.InsightRequest{
+		Perspective: perspective,
+		Logs:        logs,
+		Intakes:     intakes,
+		OptOut:      optOut,
+		Categorizer: cfg.categorizer,
+	}
+
+	// Enforce the per-user quota before spending anything on OpenAI. The
+	// estimate is reserved under a lock so parallel requests can't all pass.
+	now := time.Now()
+	var usage aiUsage
+	reservationID, reserved, err := database.ReserveAIUsage(db.AIUsage{
+		UserID:       user.ID,
+		TrackerID:    trackerID,
+		PromptTokens: openai.EstimateInsightTokens(insightRequest),
+	}, now, func(store db.AIUsageReader) (bool, error) {
+		var loadErr error
+		usage, loadErr = loadUsage(store, user.ID, cfg.aiQuota, now)
+		if loadErr != nil {
+			return false, loadErr
+		}
+		_, exceeded := usage.exceeded()
+		return !exceeded, nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to reserve AI usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !reserved {
+		period, _ := usage.exceeded()
+		writeQuotaExceeded(w, period)
+		return
+	}
+
+	res, err := openai.Openaimain(insightRequest)
+	if err != nil {
+		if err := database.ReleaseAIUsage(reservationID); err != nil {
+			log.Printf("Failed to release AI usage for user %d: %v", user.ID, err)
+		}
 		http.Error(
 			w,
 			"Failed to get response from OpenAI: "+err.Error(),
@@ -29,8 +162,302 @@ func (cfg *config) openai(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	if res.Redactions.Total() > 0 {
+		log.Printf(
+			"Redacted PII for user %d tracker %d: %s",
+			user.ID,
+			trackerID,
+			res.Redactions,
+		)
+	}
+
+	err = database.SettleAIUsage(reservationID, db.AIUsage{
+		UserID:           user.ID,
+		TrackerID:        trackerID,
+		Model:            res.Model,
+		PromptTokens:     res.PromptTokens,
+		CompletionTokens: res.CompletionTokens,
+		CostUSD:          cfg.aiPricing.Cost(res.PromptTokens, res.CompletionTokens),
+	})
+	if err != nil {
+		log.Printf("Failed to record AI usage for user %d: %v", user.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !legacy {
+		err = database.SaveAIInsight(db.AIInsight{
+			UserID:      user.ID,
+			TrackerID:   trackerID,
+			MedicalType: medicalType,
+			LogsHash:    logsHash,
+			Insight:     res.Content,
+		})
+		if err != nil {
+			log.Printf("Failed to cache insight: %v", err)
+		}
+		w.Header().Set("X-Insight-Cache", "MISS")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(res.Content))
+}
+
+// insightCache is the part of *db.Database cachedInsight reads.
+type insightCache interface {
+	GetAIInsight(userID, trackerID int, medicalType, logsHash string) (db.AIInsight, error)
+}
+
+// cachedInsight returns the insight stored for this tracker state and
+// perspective, unless the client asked for a fresh one.
+func cachedInsight(cache insightCache, userID, trackerID int, medicalType, logsHash string, forceRefresh bool) (string, bool) {
+	if forceRefresh {
+		return "", false
+	}
+	cached, err := cache.GetAIInsight(userID, trackerID, medicalType, logsHash)
+	if err != nil {
+		return "", false
+	}
+	return cached.Insight, true
+}
+
+func (cfg *config) getAIUsage(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	usage, err := loadUsage(database, user.ID, cfg.aiQuota, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to get AI usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(usage)
+	if err != nil {
+		http.Error(w, "Failed to serialize AI usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (cfg *config) getPerspectives(w http.ResponseWriter, r *http.Request) {
+	type perspectiveResponse struct {
+		Name        string `json:"name"`
+		Version     int    `json:"version"`
+		Description string `json:"description"`
+	}
+
+	perspectives := cfg.perspectives.List()
+	response := make([]perspectiveResponse, 0, len(perspectives))
+	for _, perspective := range perspectives {
+		response = append(response, perspectiveResponse{
+			Name:        perspective.Name,
+			Version:     perspective.Version,
+			Description: perspective.Description,
+		})
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to serialize perspectives", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(res))
+	w.Write(jsonData)
+}
+
+type redactionSettings struct {
+	Categories []openai.PIICategory `json:"categories"`
+	OptOut     []string             `json:"opt_out"`
+}
+
+func (cfg *config) getRedactionSettings(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	optOut, err := database.GetRedactionOptOuts(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get redaction settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(redactionSettings{
+		Categories: openai.PIICategories,
+		OptOut:     optOut,
+	})
+	if err != nil {
+		http.Error(w, "Failed to serialize redaction settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (cfg *config) updateRedactionSettings(w http.ResponseWriter, r *http.Request, user db.User) {
+	var req struct {
+		OptOut []string `json:"opt_out"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	optOut, err := parseRedactionOptOuts(req.OptOut)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	err = database.SetRedactionOptOuts(user.ID, optOut)
+	if err != nil {
+		http.Error(w, "Failed to update redaction settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseRedactionOptOuts validates category names and drops repeats such as
+// "email" and "EMAIL", which would collide in the opt-out table.
+func parseRedactionOptOuts(names []string) ([]string, error) {
+	optOut := make([]string, 0, len(names))
+	seen := map[openai.PIICategory]bool{}
+	for _, name := range names {
+		category, err := openai.ParsePIICategory(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[category] {
+			continue
+		}
+		seen[category] = true
+		optOut = append(optOut, string(category))
+	}
+	return optOut, nil
+}
+
+// loadRedactionOptOuts returns the PII categories the user wants sent as-is.
+func loadRedactionOptOuts(database *db.Database, userID int) (map[openai.PIICategory]bool, error) {
+	categories, err := database.GetRedactionOptOuts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	optOut := map[openai.PIICategory]bool{}
+	for _, name := range categories {
+		category, err := openai.ParsePIICategory(name)
+		if err != nil {
+			continue
+		}
+		optOut[category] = true
+	}
+	return optOut, nil
+}
+
+type usagePeriod struct {
+	Period      string           `json:"period"`
+	Used        db.AIUsageTotals `json:"used"`
+	UsedTokens  int              `json:"used_tokens"`
+	LimitTokens int              `json:"limit_tokens"`
+	ResetAt     time.Time        `json:"reset_at"`
+}
+
+func (p usagePeriod) exceeded() bool {
+	return p.LimitTokens > 0 && p.UsedTokens >= p.LimitTokens
+}
+
+type aiUsage struct {
+	Daily   usagePeriod `json:"daily"`
+	Monthly usagePeriod `json:"monthly"`
+}
+
+// exceeded returns the period whose quota is used up, preferring the one that
+// resets last so the client isn't told to retry too early.
+func (u aiUsage) exceeded() (usagePeriod, bool) {
+	if u.Monthly.exceeded() {
+		return u.Monthly, true
+	}
+	if u.Daily.exceeded() {
+		return u.Daily, true
+	}
+	return usagePeriod{}, false
+}
+
+// loadUsage totals the user's usage for the UTC day and month containing now.
+func loadUsage(database db.AIUsageReader, userID int, quota openai.Quota, now time.Time) (aiUsage, error) {
+	dayStart := openai.DayStart(now)
+	monthStart := openai.MonthStart(now)
+
+	daily, err := database.GetAIUsageSince(userID, dayStart)
+	if err != nil {
+		return aiUsage{}, err
+	}
+	monthly, err := database.GetAIUsageSince(userID, monthStart)
+	if err != nil {
+		return aiUsage{}, err
+	}
+
+	return aiUsage{
+		Daily: usagePeriod{
+			Period:      "daily",
+			Used:        daily,
+			UsedTokens:  daily.TotalTokens(),
+			LimitTokens: quota.DailyTokens,
+			ResetAt:     dayStart.AddDate(0, 0, 1),
+		},
+		Monthly: usagePeriod{
+			Period:      "monthly",
+			Used:        monthly,
+			UsedTokens:  monthly.TotalTokens(),
+			LimitTokens: quota.MonthlyTokens,
+			ResetAt:     monthStart.AddDate(0, 1, 0),
+		},
+	}, nil
+}
+
+func writeQuotaExceeded(w http.ResponseWriter, period usagePeriod) {
+	type Response struct {
+		Error       string    `json:"error"`
+		Period      string    `json:"period"`
+		UsedTokens  int       `json:"used_tokens"`
+		LimitTokens int       `json:"limit_tokens"`
+		ResetAt     time.Time `json:"reset_at"`
+	}
+
+	jsonData, err := json.Marshal(Response{
+		Error:       "AI usage quota exceeded",
+		Period:      period.Period,
+		UsedTokens:  period.UsedTokens,
+		LimitTokens: period.LimitTokens,
+		ResetAt:     period.ResetAt,
+	})
+	if err != nil {
+		http.Error(w, "AI usage quota exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	retryAfter := int(time.Until(period.ResetAt).Seconds()) + 1
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(jsonData)
 }
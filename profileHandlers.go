@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+// profileUpdate is the body of PATCH /profile. Fields left out are unchanged.
+type profileUpdate struct {
+	FirstName            *string `json:"first_name"`
+	LastName             *string `json:"last_name"`
+	TimeZone             *string `json:"time_zone"`
+	PreferredPerspective *string `json:"preferred_perspective"`
+	Units                *string `json:"units"`
+	RemindersEnabled     *bool   `json:"reminders_enabled"`
+	ReminderTime         *string `json:"reminder_time"`
+	WeeklySummary        *bool   `json:"weekly_summary"`
+}
+
+var validUnits = map[string]bool{"metric": true, "imperial": true}
+
+// profileDatabase is the part of *db.Database the profile handlers use.
+type profileDatabase interface {
+	GetUserProfile(user db.User) (db.UserProfile, error)
+	SaveUserProfile(profile db.UserProfile) error
+	Close() error
+}
+
+func openProfileDatabase() (profileDatabase, error) {
+	return db.New()
+}
+
+func (c *config) getProfile(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := c.openProfiles()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	profile, err := database.GetUserProfile(user)
+	if err != nil {
+		http.Error(w, "Failed to get profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(profile)
+	if err != nil {
+		http.Error(w, "Failed to serialize profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) updateProfile(w http.ResponseWriter, r *http.Request, user db.User) {
+	var update profileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	database, err := c.openProfiles()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	profile, err := database.GetUserProfile(user)
+	if err != nil {
+		http.Error(w, "Failed to get profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if update.FirstName != nil {
+		profile.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		profile.LastName = *update.LastName
+	}
+	if update.TimeZone != nil {
+		if _, err := time.LoadLocation(*update.TimeZone); err != nil || *update.TimeZone == "" {
+			http.Error(w, "Invalid time zone", http.StatusBadRequest)
+			return
+		}
+		profile.TimeZone = *update.TimeZone
+	}
+	if update.PreferredPerspective != nil {
+		perspective, err := c.perspectives.Get(*update.PreferredPerspective)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile.PreferredPerspective = perspective.Name
+	}
+	if update.Units != nil {
+		if !validUnits[*update.Units] {
+			http.Error(w, `units must be "metric" or "imperial"`, http.StatusBadRequest)
+			return
+		}
+		profile.Units = *update.Units
+	}
+	if update.RemindersEnabled != nil {
+		profile.RemindersEnabled = *update.RemindersEnabled
+	}
+	if update.ReminderTime != nil {
+		if _, err := time.Parse("15:04", *update.ReminderTime); err != nil {
+			http.Error(w, "reminder_time must be HH:MM", http.StatusBadRequest)
+			return
+		}
+		profile.ReminderTime = *update.ReminderTime
+	}
+	if update.WeeklySummary != nil {
+		profile.WeeklySummary = *update.WeeklySummary
+	}
+
+	if err := database.SaveUserProfile(profile); err != nil {
+		http.Error(w, "Failed to save profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The profile's time zone is copied onto the users row
+	c.users.invalidate(user.CognitoSub)
+
+	jsonData, err := json.Marshal(profile)
+	if err != nil {
+		http.Error(w, "Failed to serialize profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// seedProfile creates a new user's profile from their Cognito attributes.
+// Failures are logged; the user can still fill in their profile later.
+func (c *config) seedProfile(r *http.Request, database profileDatabase, user db.User) {
+	profile := db.DefaultProfile(user)
+	attributes, err := c.AuthClient.GetUserAttributes(r.Context(), user.CognitoSub)
+	if err != nil {
+		log.Printf("Failed to get Cognito attributes for user %d: %v", user.ID, err)
+	} else {
+		profile.FirstName = attributes["name"]
+		profile.LastName = attributes["family_name"]
+	}
+	if err := database.SaveUserProfile(profile); err != nil {
+		log.Printf("Failed to seed profile for user %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/session"
+)
+
+const (
+	// sessionCookie holds the opaque session ID
+	sessionCookie = "session"
+	// sessionTTL matches the default Cognito refresh token lifetime
+	sessionTTL = 30 * 24 * time.Hour
+)
+
+// errNoSession means the request has no usable session cookie.
+var errNoSession = errors.New("no active session")
+
+// sessionDatabase is the part of *db.Database the session handlers use.
+type sessionDatabase interface {
+	CreateSession(session db.Session, now time.Time) (int, error)
+	GetSessionByTokenHash(tokenHash string) (db.Session, error)
+	GetSessionByID(id int) (db.Session, error)
+	GetActiveSessionsByUsername(username string, now time.Time) ([]db.Session, error)
+	TouchSession(id int, userAgent, ipAddress string, now time.Time) error
+	RevokeSession(id int, now time.Time) error
+	RevokeSessionsByUsername(username string, now time.Time) error
+	Close() error
+}
+
+func openSessionDatabase() (sessionDatabase, error) {
+	return db.New()
+}
+
+// startSession stores the refresh token server-side, encrypted, and gives
+// the browser an opaque session cookie in its place.
+func (c *config) startSession(w http.ResponseWriter, r *http.Request, tokens *auth.Tokens) error {
+	sub, username, err := idTokenIdentity(tokens.IDToken)
+	if err != nil {
+		return err
+	}
+	token, tokenHash, err := session.NewToken()
+	if err != nil {
+		return err
+	}
+	sealed, err := c.sessionCipher.Seal(tokens.RefreshToken, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	database, err := c.openSessions()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	now := time.Now()
+	_, err = database.CreateSession(db.Session{
+		TokenHash:    tokenHash,
+		Username:     username,
+		Subject:      sub,
+		RefreshToken: sealed,
+		UserAgent:    truncate(r.UserAgent(), 255),
+		IPAddress:    clientIP(r),
+		ExpiresAt:    now.Add(sessionTTL).UTC().Format(time.RFC3339),
+	}, now)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	// Browsers signed in before sessions existed still hold these
+	clearCookie(w, "refreshToken")
+	clearCookie(w, "userSub")
+	return nil
+}
+
+// currentSession returns the active session named by the request's cookie.
+// Errors wrap errNoSession when there isn't one.
+func (c *config) currentSession(r *http.Request, database sessionDatabase) (db.Session, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return db.Session{}, errNoSession
+	}
+	current, err := database.GetSessionByTokenHash(session.HashToken(cookie.Value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Session{}, errNoSession
+	}
+	if err != nil {
+		return db.Session{}, err
+	}
+	if !current.ActiveAt(time.Now()) {
+		return db.Session{}, errNoSession
+	}
+	return current, nil
+}
+
+// endSession revokes s with the identity provider and locally. A provider
+// failure is only logged since the refresh token can't be used without the
+// session anyway.
+func (c *config) endSession(r *http.Request, database sessionDatabase, s db.Session) error {
+	if refreshToken, err := c.sessionCipher.Open(s.RefreshToken, s.TokenHash); err == nil {
+		if err := c.AuthClient.RevokeRefreshToken(r.Context(), refreshToken); err != nil {
+			log.Printf("Failed to revoke refresh token for session %d: %v", s.ID, err)
+		}
+	}
+	return database.RevokeSession(s.ID, time.Now())
+}
+
+func (c *config) getSessions(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	database, err := c.openSessions()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	sessions, err := database.GetActiveSessionsByUsername(principal.Username, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to get sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if current, err := c.currentSession(r, database); err == nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.ID
+		}
+	}
+
+	jsonData, err := json.Marshal(sessions)
+	if err != nil {
+		http.Error(w, "Failed to serialize sessions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// revokeSession signs one of the caller's devices out.
+func (c *config) revokeSession(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid session id", http.StatusBadRequest)
+		return
+	}
+	database, err := c.openSessions()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	target, err := database.GetSessionByID(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && target.Username != principal.Username) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if target.RevokedAt == "" {
+		if err := c.endSession(r, database, target); err != nil {
+			http.Error(w, "Failed to revoke session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessions signs the caller out everywhere, including sessions the
+// identity provider issued outside this API.
+func (c *config) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	if err := c.AuthClient.SignOut(r.Context(), principal.Username); err != nil {
+		http.Error(w, "Failed to sign out user", identityErrorStatus(err))
+		return
+	}
+	database, err := c.openSessions()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+	if err := database.RevokeSessionsByUsername(principal.Username, time.Now()); err != nil {
+		http.Error(w, "Failed to revoke sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// idTokenIdentity reads the sub and username claims from an ID token the
+// identity provider just returned.
+func idTokenIdentity(idToken string) (sub, username string, err error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("invalid ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", errors.New("failed to decode ID token")
+	}
+	var claims struct {
+		Sub      string `json:"sub"`
+		Username string `json:"cognito:username"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", errors.New("failed to parse ID token")
+	}
+	if claims.Sub == "" || claims.Username == "" {
+		return "", "", errors.New("ID token is missing sub or cognito:username")
+	}
+	return claims.Sub, claims.Username, nil
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Expires:  time.Unix(0, 0), // Set expiration to a past time
+		MaxAge:   -1,              // Ensure the cookie is removed immediately
+	})
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+// maxCommentLength bounds a comment's body, in bytes
+const maxCommentLength = 4000
+
+var (
+	// errNoTrackerAccess means the tracker doesn't exist or isn't shared
+	// with the caller; both look the same so tracker IDs can't be probed
+	errNoTrackerAccess = errors.New("tracker not found")
+	// errReadOnlyShare means the caller can see the tracker but not comment
+	errReadOnlyShare = errors.New("tracker is shared read-only")
+)
+
+// trackerAccess is a tracker the caller may read, with the account that owns
+// it. Times should come from owner, not the caller, and only the owner sees
+// their cycles.
+type trackerAccess struct {
+	tracker db.Tracker
+	owner   db.User
+	// share is the grant used, or nil when the caller owns the tracker
+	share *db.TrackerShare
+}
+
+func (a trackerAccess) isOwner() bool {
+	return a.share == nil
+}
+
+// trackerDatabase is the part of *db.Database authorizeTracker uses.
+type trackerDatabase interface {
+	GetTrackerByID(trackerID int) (db.Tracker, error)
+	GetActiveTrackerShare(trackerID, granteeID int, now time.Time) (db.TrackerShare, error)
+	GetUserByID(userID int) (db.User, error)
+}
+
+// authorizeTracker checks that user owns trackerID or holds an active share
+// with at least permission.
+func authorizeTracker(database trackerDatabase, user db.User, trackerID int, permission string) (trackerAccess, error) {
+	tracker, err := database.GetTrackerByID(trackerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return trackerAccess{}, errNoTrackerAccess
+	}
+	if err != nil {
+		return trackerAccess{}, err
+	}
+	if tracker.UserID == user.ID {
+		return trackerAccess{tracker: tracker, owner: user}, nil
+	}
+
+	share, err := database.GetActiveTrackerShare(trackerID, user.ID, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return trackerAccess{}, errNoTrackerAccess
+	}
+	if err != nil {
+		return trackerAccess{}, err
+	}
+	if permission == db.SharePermissionComment && share.Permission != db.SharePermissionComment {
+		return trackerAccess{}, errReadOnlyShare
+	}
+
+	owner, err := database.GetUserByID(tracker.UserID)
+	if err != nil {
+		return trackerAccess{}, err
+	}
+	return trackerAccess{tracker: tracker, owner: owner, share: &share}, nil
+}
+
+// writeTrackerAccessError responds to an authorizeTracker error.
+func writeTrackerAccessError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNoTrackerAccess):
+		http.Error(w, "Tracker not found", http.StatusNotFound)
+	case errors.Is(err, errReadOnlyShare):
+		http.Error(w, "Tracker is shared with you read-only", http.StatusForbidden)
+	default:
+		http.Error(w, "Failed to get tracker: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *config) getTrackerShares(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	now := time.Now()
+	outgoing, err := database.GetTrackerSharesByOwnerID(user.ID, now)
+	if err != nil {
+		http.Error(w, "Failed to get shares: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	email, err := c.verifiedEmail(r, user)
+	if err != nil {
+		http.Error(w, "Failed to get verified email: "+err.Error(), identityErrorStatus(err))
+		return
+	}
+	incoming, err := database.GetTrackerSharesForGrantee(user.ID, email, now)
+	if err != nil {
+		http.Error(w, "Failed to get shares: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type Response struct {
+		// Outgoing are shares of the caller's trackers
+		Outgoing []db.TrackerShare `json:"outgoing"`
+		// Incoming are shares and invitations addressed to the caller
+		Incoming []db.TrackerShare `json:"incoming"`
+	}
+
+	jsonData, err := json.Marshal(Response{Outgoing: outgoing, Incoming: incoming})
+	if err != nil {
+		http.Error(w, "Failed to serialize shares", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createTrackerShare(w http.ResponseWriter, r *http.Request, user db.User) {
+	type Request struct {
+		TrackerID  int    `json:"tracker_id"`
+		Email      string `json:"email"`
+		Permission string `json:"permission"`
+		// ExpiresAt is an optional RFC 3339 instant
+		ExpiresAt string `json:"expires_at"`
+	}
+
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	if !strings.Contains(request.Email, "@") {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(request.Email, user.Email) {
+		http.Error(w, "You can't share a tracker with yourself", http.StatusBadRequest)
+		return
+	}
+	if request.Permission == "" {
+		request.Permission = db.SharePermissionRead
+	}
+	if request.Permission != db.SharePermissionRead && request.Permission != db.SharePermissionComment {
+		http.Error(w, "permission must be read or comment", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if request.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, request.ExpiresAt)
+		if err != nil {
+			http.Error(w, "expires_at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		if !expiresAt.After(now) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	// Only the owner can share a tracker
+	tracker, err := database.GetTrackerByIDAndUserID(request.TrackerID, user.ID)
+	if err != nil {
+		http.Error(w, "Tracker not found", http.StatusNotFound)
+		return
+	}
+
+	existing, err := database.GetTrackerSharesByOwnerID(user.ID, now)
+	if err != nil {
+		http.Error(w, "Failed to get shares: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, share := range existing {
+		open := share.Status == db.ShareStatusPending || share.Status == db.ShareStatusActive
+		if open && share.TrackerID == tracker.ID && strings.EqualFold(share.GranteeEmail, request.Email) {
+			http.Error(w, "This tracker is already shared with that email", http.StatusConflict)
+			return
+		}
+	}
+
+	id, err := database.CreateTrackerShare(db.TrackerShare{
+		TrackerID:    tracker.ID,
+		OwnerID:      user.ID,
+		GranteeEmail: request.Email,
+		Permission:   request.Permission,
+		ExpiresAt:    request.ExpiresAt,
+	}, now)
+	if err != nil {
+		http.Error(w, "Failed to share tracker: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	share, err := database.GetTrackerShareByID(id, now)
+	if err != nil {
+		http.Error(w, "Failed to get share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(share)
+	if err != nil {
+		http.Error(w, "Failed to serialize share", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+// acceptTrackerShare lets the account whose email an invitation was sent to
+// start viewing the tracker.
+func (c *config) acceptTrackerShare(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid share id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	email, err := c.verifiedEmail(r, user)
+	if err != nil {
+		http.Error(w, "Failed to get verified email: "+err.Error(), identityErrorStatus(err))
+		return
+	}
+	if email == "" {
+		http.Error(w, "Verify your email address to accept shares", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	share, err := database.GetTrackerShareByID(id, now)
+	if err != nil || !invitedAs(share, email) || share.OwnerID == user.ID {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+	if share.Status != db.ShareStatusPending {
+		http.Error(w, "Share is "+share.Status, http.StatusConflict)
+		return
+	}
+
+	// The status may change between the read above and the update
+	accepted, err := database.AcceptTrackerShare(share.ID, user.ID, now)
+	if err != nil {
+		http.Error(w, "Failed to accept share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !accepted {
+		http.Error(w, "Share is no longer pending", http.StatusConflict)
+		return
+	}
+	share, err = database.GetTrackerShareByID(share.ID, now)
+	if err != nil {
+		http.Error(w, "Failed to get share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(share)
+	if err != nil {
+		http.Error(w, "Failed to serialize share", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// revokeTrackerShare ends a share. The owner revokes it; the grantee can also
+// use it to decline an invitation or stop viewing.
+func (c *config) revokeTrackerShare(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid share id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	share, err := database.GetTrackerShareByID(id, time.Now())
+	if err != nil {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+	isGrantee := share.GranteeID == user.ID
+	if share.OwnerID != user.ID && !isGrantee {
+		email, err := c.verifiedEmail(r, user)
+		if err != nil {
+			http.Error(w, "Failed to get verified email: "+err.Error(), identityErrorStatus(err))
+			return
+		}
+		isGrantee = invitedAs(share, email)
+	}
+	if share.OwnerID != user.ID && !isGrantee {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	if err := database.RevokeTrackerShare(share.ID, time.Now()); err != nil {
+		http.Error(w, "Failed to revoke share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifiedEmail returns the caller's email as verified by the identity
+// provider, or "" if it isn't verified. Invitations are matched against it
+// rather than users.email, which older accounts could set to any address.
+func (c *config) verifiedEmail(r *http.Request, user db.User) (string, error) {
+	email, err := auth.VerifiedEmail(r.Context(), c.AuthClient, user.CognitoSub)
+	if errors.Is(err, auth.ErrEmailNotVerified) {
+		return "", nil
+	}
+	return email, err
+}
+
+// invitedAs reports whether share is an open invitation to email, a
+// verified address.
+func invitedAs(share db.TrackerShare, email string) bool {
+	return share.GranteeID == 0 && email != "" && strings.EqualFold(share.GranteeEmail, email)
+}
+
+func (c *config) getTrackerComments(w http.ResponseWriter, r *http.Request, user db.User) {
+	trackerID, err := queryInt(r, "tracker_id", 0)
+	if err != nil || trackerID == 0 {
+		http.Error(w, "tracker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, trackerID, db.SharePermissionRead)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+
+	comments, err := database.GetTrackerCommentsByTrackerID(access.tracker.ID)
+	if err != nil {
+		http.Error(w, "Failed to get comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(comments)
+	if err != nil {
+		http.Error(w, "Failed to serialize comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) createTrackerComment(w http.ResponseWriter, r *http.Request, user db.User) {
+	var comment db.TrackerComment
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" || len(comment.Body) > maxCommentLength {
+		http.Error(w, "body is required and must be at most 4000 bytes", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	access, err := authorizeTracker(database, user, comment.TrackerID, db.SharePermissionComment)
+	if err != nil {
+		writeTrackerAccessError(w, err)
+		return
+	}
+
+	// A comment about a log must be about one of this tracker's logs
+	if comment.SymptomLogID != 0 {
+		symptomLog, err := database.GetSymptomLogByID(comment.SymptomLogID)
+		if err != nil || symptomLog.TrackerID != access.tracker.ID {
+			http.Error(w, "Symptom log not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	comment.AuthorID = user.ID
+	comment.AuthorEmail = user.Email
+	now := time.Now()
+	comment.ID, err = database.CreateTrackerComment(comment, now)
+	if err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment.CreatedAt = now.UTC().Format(time.RFC3339)
+
+	jsonData, err := json.Marshal(comment)
+	if err != nil {
+		http.Error(w, "Failed to serialize comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/analysis"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+	openai "github.com/ArvoyaDev/health-trackers-backend/internal/openai"
+	"github.com/ArvoyaDev/health-trackers-backend/internal/sharelink"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultShareLinkDays = 7
+	maxShareLinkDays     = 30
+	// maxPINFailures wrong PINs revoke a link. With at least a million
+	// possible PINs that leaves a guesser a 1 in 100,000 chance.
+	maxPINFailures = 10
+)
+
+// sharePINPattern is 6 to 12 digits
+var sharePINPattern = regexp.MustCompile(`^[0-9]{6,12}$`)
+
+// shareReport is the read-only summary a share link shows.
+type shareReport struct {
+	TrackerName string `json:"tracker_name"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	// TimeZone is the owner's; log times and days are in it
+	TimeZone     string                  `json:"time_zone"`
+	ExpiresAt    string                  `json:"expires_at"`
+	Symptoms     []string                `json:"symptoms"`
+	TotalLogs    int                     `json:"total_logs"`
+	DaysLogged   int                     `json:"days_logged"`
+	MeanSeverity *float64                `json:"mean_severity"`
+	TopSymptoms  []analysis.SymptomCount `json:"top_symptoms"`
+	Logs         []shareReportLog        `json:"logs"`
+}
+
+// shareReportLog is a log as shown in a report, without internal IDs and
+// without notes unless the owner chose to include them.
+type shareReportLog struct {
+	LocalTime  string          `json:"local_time"`
+	Severity   string          `json:"severity"`
+	Symptoms   string          `json:"symptoms"`
+	Notes      string          `json:"notes,omitempty"`
+	Fields     []db.FieldValue `json:"fields,omitempty"`
+	CycleDay   int             `json:"cycle_day,omitempty"`
+	CyclePhase string          `json:"cycle_phase,omitempty"`
+}
+
+func (c *config) createShareLink(w http.ResponseWriter, r *http.Request, user db.User) {
+	if c.shareLinks == nil {
+		http.Error(w, "Share links are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	type Request struct {
+		TrackerID     int    `json:"tracker_id"`
+		StartDate     string `json:"start_date"`
+		EndDate       string `json:"end_date"`
+		ExpiresInDays int    `json:"expires_in_days"`
+		PIN           string `json:"pin"`
+		IncludeNotes  bool   `json:"include_notes"`
+		IncludeCycle  bool   `json:"include_cycle"`
+	}
+
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	start, startErr := time.Parse(time.DateOnly, request.StartDate)
+	end, endErr := time.Parse(time.DateOnly, request.EndDate)
+	if startErr != nil || endErr != nil || end.Before(start) {
+		http.Error(w, "start_date and end_date must be YYYY-MM-DD with start_date first", http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = defaultShareLinkDays
+	}
+	if request.ExpiresInDays < 1 || request.ExpiresInDays > maxShareLinkDays {
+		http.Error(w, "expires_in_days must be between 1 and 30", http.StatusBadRequest)
+		return
+	}
+	if request.PIN != "" && !sharePINPattern.MatchString(request.PIN) {
+		http.Error(w, "pin must be 6 to 12 digits", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	// Only the owner can publish a tracker
+	tracker, err := database.GetTrackerByIDAndUserID(request.TrackerID, user.ID)
+	if err != nil {
+		http.Error(w, "Tracker not found", http.StatusNotFound)
+		return
+	}
+
+	nonce, err := sharelink.NewNonce()
+	if err != nil {
+		http.Error(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+	var pinHash string
+	if request.PIN != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(request.PIN), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Failed to create share link", http.StatusInternalServerError)
+			return
+		}
+		pinHash = string(hash)
+	}
+
+	now := time.Now()
+	id, err := database.CreateShareLink(db.ShareLink{
+		TrackerID:    tracker.ID,
+		OwnerID:      user.ID,
+		Nonce:        nonce,
+		StartDate:    request.StartDate,
+		EndDate:      request.EndDate,
+		IncludeNotes: request.IncludeNotes,
+		IncludeCycle: request.IncludeCycle,
+		PINHash:      pinHash,
+		ExpiresAt:    now.AddDate(0, 0, request.ExpiresInDays).UTC().Format(time.RFC3339),
+	}, now)
+	if err != nil {
+		http.Error(w, "Failed to create share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	link, err := database.GetShareLinkByID(id, now)
+	if err != nil {
+		http.Error(w, "Failed to get share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.signShareLink(&link)
+
+	jsonData, err := json.Marshal(link)
+	if err != nil {
+		http.Error(w, "Failed to serialize share link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonData)
+}
+
+func (c *config) getShareLinks(w http.ResponseWriter, r *http.Request, user db.User) {
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	links, err := database.GetShareLinksByOwnerID(user.ID, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to get share links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range links {
+		c.signShareLink(&links[i])
+	}
+
+	jsonData, err := json.Marshal(links)
+	if err != nil {
+		http.Error(w, "Failed to serialize share links", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) getShareLinkAccesses(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid share link id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	link, err := database.GetShareLinkByID(id, time.Now())
+	if err != nil || link.OwnerID != user.ID {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	accesses, err := database.GetShareLinkAccesses(link.ID)
+	if err != nil {
+		http.Error(w, "Failed to get share link accesses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(accesses)
+	if err != nil {
+		http.Error(w, "Failed to serialize share link accesses", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *config) revokeShareLink(w http.ResponseWriter, r *http.Request, user db.User) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid share link id", http.StatusBadRequest)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	link, err := database.GetShareLinkByID(id, time.Now())
+	if err != nil || link.OwnerID != user.ID {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	if err := database.RevokeShareLink(link.ID, time.Now()); err != nil {
+		http.Error(w, "Failed to revoke share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// viewShareLink serves the report behind a share link. It needs no account;
+// the signed token is the credential, plus the PIN in the X-Share-Pin header
+// when the owner set one.
+func (c *config) viewShareLink(w http.ResponseWriter, r *http.Request) {
+	if c.shareLinks == nil {
+		http.Error(w, "Share links are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	now := time.Now()
+	claims, err := c.shareLinks.Verify(r.PathValue("token"), now)
+	if errors.Is(err, sharelink.ErrLinkExpired) {
+		http.Error(w, "Share link expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	database, err := db.New()
+	if err != nil {
+		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		return
+	}
+	defer database.Close()
+
+	link, err := database.GetShareLinkByID(claims.LinkID, now)
+	if err != nil || subtle.ConstantTimeCompare([]byte(link.Nonce), []byte(claims.Nonce)) != 1 {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	if link.Status != db.ShareStatusActive {
+		http.Error(w, "Share link "+link.Status, http.StatusGone)
+		return
+	}
+
+	access := db.ShareLinkAccess{
+		ShareLinkID: link.ID,
+		IPAddress:   clientIP(r),
+		UserAgent:   truncate(r.UserAgent(), 255),
+		Granted:     true,
+	}
+	if link.HasPIN {
+		pin := r.Header.Get("X-Share-Pin")
+		if pin == "" {
+			http.Error(w, "pin_required", http.StatusUnauthorized)
+			return
+		}
+		reserved, err := database.ReserveShareLinkPINAttempt(link.ID, maxPINFailures)
+		if err != nil {
+			http.Error(w, "Failed to check share link: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			http.Error(w, "Share link locked after too many wrong PINs", http.StatusGone)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PINHash), []byte(pin)) != nil {
+			access.Granted = false
+			if err := database.RecordShareLinkAccess(access, now); err != nil {
+				log.Printf("Failed to record share link access: %v", err)
+			}
+			if err := database.RevokeExhaustedShareLink(link.ID, maxPINFailures, now); err != nil {
+				log.Printf("Failed to lock share link %d: %v", link.ID, err)
+			}
+			http.Error(w, "invalid_pin", http.StatusUnauthorized)
+			return
+		}
+		if err := database.ReleaseShareLinkPINAttempt(link.ID); err != nil {
+			log.Printf("Failed to release share link PIN attempt: %v", err)
+		}
+	}
+
+	owner, err := database.GetUserByID(link.OwnerID)
+	if err != nil {
+		http.Error(w, "Failed to get share link owner", http.StatusInternalServerError)
+		return
+	}
+	symptoms, err := database.GetSymptomsByTrackerID(link.TrackerID)
+	if err != nil {
+		http.Error(w, "Failed to get symptoms: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	symptomLogs, err := database.GetSymptomLogsByTrackerID(link.TrackerID)
+	if err != nil {
+		http.Error(w, "Failed to get logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	db.LocalizeLogs(symptomLogs, owner.Location())
+	if link.IncludeCycle {
+		annotateCycles(database, owner, symptomLogs)
+	}
+
+	report := buildShareReport(link, symptoms, symptomLogs, owner.Location())
+	report.TimeZone = owner.Location().String()
+
+	if err := database.RecordShareLinkAccess(access, now); err != nil {
+		log.Printf("Failed to record share link access: %v", err)
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Failed to serialize report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// buildShareReport summarizes the logs that fall within the link's dates in
+// loc. Notes and the tags derived from them, and the owner's cycle day and
+// phase, are left out unless the link includes them.
+func buildShareReport(link db.ShareLink, symptoms []db.Symptom, symptomLogs []db.SymptomLog, loc *time.Location) shareReport {
+	report := shareReport{
+		TrackerName: link.TrackerName,
+		StartDate:   link.StartDate,
+		EndDate:     link.EndDate,
+		ExpiresAt:   link.ExpiresAt,
+		Symptoms:    []string{},
+		Logs:        []shareReportLog{},
+	}
+	for _, symptom := range symptoms {
+		report.Symptoms = append(report.Symptoms, symptom.SymptomName)
+	}
+
+	days := map[string]bool{}
+	var symptomLists [][]string
+	var severityTotal float64
+	var severityCount int
+	for _, symptomLog := range symptomLogs {
+		loggedAt, err := time.Parse(time.RFC3339, symptomLog.LogTime)
+		if err != nil {
+			continue
+		}
+		day := loggedAt.In(loc).Format(time.DateOnly)
+		if day < link.StartDate || day > link.EndDate {
+			continue
+		}
+
+		days[day] = true
+		symptomLists = append(symptomLists, openai.SplitSymptoms(symptomLog.Symptoms))
+		if severity, err := strconv.ParseFloat(symptomLog.Severity, 64); err == nil {
+			severityTotal += severity
+			severityCount++
+		}
+
+		reportLog := shareReportLog{
+			LocalTime: symptomLog.LogTimeIn(loc),
+			Severity:  symptomLog.Severity,
+			Symptoms:  symptomLog.Symptoms,
+			Fields:    symptomLog.Fields,
+		}
+		if link.IncludeNotes {
+			reportLog.Notes = symptomLog.Notes
+		}
+		if link.IncludeCycle {
+			reportLog.CycleDay = symptomLog.CycleDay
+			reportLog.CyclePhase = symptomLog.CyclePhase
+		}
+		report.Logs = append(report.Logs, reportLog)
+	}
+
+	report.TotalLogs = len(report.Logs)
+	report.DaysLogged = len(days)
+	if severityCount > 0 {
+		mean := severityTotal / float64(severityCount)
+		report.MeanSeverity = &mean
+	}
+	report.TopSymptoms, _ = analysis.SymptomFrequencies(symptomLists)
+	return report
+}
+
+// signShareLink fills in the token for an active link.
+func (c *config) signShareLink(link *db.ShareLink) {
+	if c.shareLinks == nil || link.Status != db.ShareStatusActive {
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339, link.ExpiresAt)
+	if err != nil {
+		return
+	}
+	link.Token = c.shareLinks.Sign(sharelink.Claims{
+		LinkID:    link.ID,
+		ExpiresAt: expiresAt,
+		Nonce:     link.Nonce,
+	})
+}
+
+// clientIP is the caller's address. Behind the load balancer that's the
+// right-most X-Forwarded-For hop, the one the load balancer appended; hops to
+// its left come from the client and can be anything. Without the header it's
+// the connection's address.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+			return ip.String()
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return truncate(r.RemoteAddr, 64)
+	}
+	return host
+}
+
+// truncate cuts s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+const (
+	defaultSeverityMin = 1
+	defaultSeverityMax = 10
+)
+
+func (c *config) getTrackerTemplates(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := json.Marshal(c.templates.List())
+	if err != nil {
+		http.Error(w, "Failed to serialize tracker templates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// newTracker is a tracker ready to be created along with its symptoms and
+// custom fields.
+type newTracker struct {
+	tracker  db.Tracker
+	symptoms []string
+	fields   []db.TrackerField
+}
+
+// resolveTracker builds the tracker a request asks for. With a templateID the
+// template supplies the severity scale and fields, and the name and symptoms
+// unless the request sets its own.
+func (c *config) resolveTracker(name string, symptoms []string, templateID string) (newTracker, error) {
+	resolved := newTracker{
+		tracker: db.Tracker{
+			TrackerName: name,
+			SeverityMin: defaultSeverityMin,
+			SeverityMax: defaultSeverityMax,
+		},
+		symptoms: symptoms,
+	}
+	if templateID != "" {
+		template, err := c.templates.Get(templateID)
+		if err != nil {
+			return newTracker{}, err
+		}
+		resolved.tracker.TemplateID = template.ID
+		resolved.tracker.SeverityMin = template.SeverityScale.Min
+		resolved.tracker.SeverityMax = template.SeverityScale.Max
+		resolved.fields = template.Fields
+		if resolved.tracker.TrackerName == "" {
+			resolved.tracker.TrackerName = template.Name
+		}
+		if len(resolved.symptoms) == 0 {
+			resolved.symptoms = template.Symptoms
+		}
+	}
+	if resolved.tracker.TrackerName == "" {
+		return newTracker{}, fmt.Errorf("tracker_name or template_id is required")
+	}
+	return resolved, nil
+}
+
+// createResolvedTracker saves a resolved tracker for userID and returns it as
+// stored.
+func createResolvedTracker(database *db.Database, userID int, resolved newTracker) (db.Tracker, error) {
+	resolved.tracker.UserID = userID
+	if err := database.CreateTracker(resolved.tracker); err != nil {
+		return db.Tracker{}, err
+	}
+
+	created, err := database.GetTrackerByNameAndUserID(resolved.tracker.TrackerName, userID)
+	if err != nil {
+		return db.Tracker{}, err
+	}
+
+	for _, symptom := range resolved.symptoms {
+		if err := database.CreateSymptom(symptom, created.ID); err != nil {
+			return db.Tracker{}, err
+		}
+	}
+	for _, field := range resolved.fields {
+		field.TrackerID = created.ID
+		if _, err := database.CreateTrackerField(field); err != nil {
+			return db.Tracker{}, err
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ArvoyaDev/health-trackers-backend/internal/auth"
+	db "github.com/ArvoyaDev/health-trackers-backend/internal/mysql"
+)
+
+// userCacheTTL bounds how stale a cached users row can be, e.g. a time zone
+// changed by another instance
+const userCacheTTL = time.Minute
+
+// userHandler is a handler for routes that need the caller's users row.
+type userHandler func(w http.ResponseWriter, r *http.Request, user db.User)
+
+type cachedUser struct {
+	user    db.User
+	expires time.Time
+}
+
+// userResolver looks up the users row for a principal, caching rows briefly
+// so each request doesn't need its own lookup.
+type userResolver struct {
+	lookup func(username string) (db.User, error)
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedUser
+}
+
+func newUserResolver() *userResolver {
+	return &userResolver{
+		lookup: lookupUser,
+		now:    time.Now,
+		cache:  make(map[string]cachedUser),
+	}
+}
+
+func lookupUser(username string) (db.User, error) {
+	database, err := db.New()
+	if err != nil {
+		return db.User{}, err
+	}
+	defer database.Close()
+	return database.GetUserBySub(username)
+}
+
+// resolve returns the users row for username. Errors wrap sql.ErrNoRows when
+// the user hasn't onboarded yet.
+func (u *userResolver) resolve(username string) (db.User, error) {
+	u.mu.Lock()
+	cached, ok := u.cache[username]
+	u.mu.Unlock()
+	if ok && u.now().Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	user, err := u.lookup(username)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	u.mu.Lock()
+	u.cache[username] = cachedUser{user: user, expires: u.now().Add(userCacheTTL)}
+	u.mu.Unlock()
+	return user, nil
+}
+
+// invalidate drops the cached row after the user's record changes.
+func (u *userResolver) invalidate(username string) {
+	u.mu.Lock()
+	delete(u.cache, username)
+	u.mu.Unlock()
+}
+
+// withUser resolves the authenticated principal's users row and passes it
+// to next. Callers that haven't created their account yet get a 404 telling
+// them to onboard.
+func (c *config) withUser(next userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := c.users.resolve(principal.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeUserNotFound(w)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to resolve user %s: %v", principal.Username, err)
+			http.Error(w, "Failed to get user", http.StatusInternalServerError)
+			return
+		}
+
+		next(w, r, user)
+	}
+}
+
+// requireRole only lets callers holding one of roles reach next.
+func requireRole(next http.HandlerFunc, roles ...auth.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasRole(roles...) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeUserNotFound tells a signed-in caller without a users row to finish
+// onboarding.
+func writeUserNotFound(w http.ResponseWriter) {
+	response := struct {
+		Error      string `json:"error"`
+		Message    string `json:"message"`
+		Onboarding string `json:"onboarding"`
+	}{
+		Error:      "user_not_found",
+		Message:    "No account exists for this login yet; create one to continue",
+		Onboarding: "POST /db/make-user",
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(jsonData)
+}